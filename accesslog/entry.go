@@ -0,0 +1,137 @@
+package accesslog
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*Entry holds a single access log record in squid native format */
+type Entry struct {
+	Time      time.Time
+	Elapsed   time.Duration
+	Client    string
+	Result    string
+	Status    int
+	Bytes     int64
+	Method    string
+	URL       string
+	User      string
+	Hierarchy string
+	PeerHost  string
+	MimeType  string
+
+	// Extra holds the fields appended after the native ones by a custom logformat
+	Extra []string
+	// Fields maps the names configured on the Tailer to the Extra fields
+	Fields map[string]string
+}
+
+// nativeFields is the number of fields in the squid native log format:
+// time elapsed remotehost code/status bytes method URL rfc931 peerstatus/peerhost type
+const nativeFields = 10
+
+/*ParseEntry decodes a line written with the squid native logformat */
+func ParseEntry(line string) (*Entry, error) {
+	fields := strings.Fields(line)
+	if len(fields) < nativeFields {
+		return nil, errors.New("access log - could not parse line: " + line)
+	}
+
+	ts, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, errors.New("access log - invalid timestamp: " + fields[0])
+	}
+	sec, frac := math.Modf(ts)
+
+	e := &Entry{
+		Time:     time.Unix(int64(sec), int64(frac*1e9)),
+		Client:   fields[2],
+		Method:   fields[5],
+		URL:      fields[6],
+		User:     fields[7],
+		MimeType: fields[9],
+	}
+
+	if elapsed, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+		e.Elapsed = time.Duration(elapsed) * time.Millisecond
+	}
+
+	e.Result, e.Status = splitCodeStatus(fields[3])
+	if bytes, err := strconv.ParseInt(fields[4], 10, 64); err == nil {
+		e.Bytes = bytes
+	}
+
+	if idx := strings.Index(fields[8], "/"); idx >= 0 {
+		e.Hierarchy = fields[8][:idx]
+		e.PeerHost = fields[8][idx+1:]
+	} else {
+		e.Hierarchy = fields[8]
+	}
+
+	if len(fields) > nativeFields {
+		e.Extra = fields[nativeFields:]
+	}
+
+	return e, nil
+}
+
+/*Field returns the named extra field, or an empty string if it is not set. Squid logs "-" for missing values. */
+func (e *Entry) Field(name string) string {
+	if v := e.Fields[name]; v != "-" {
+		return v
+	}
+
+	return ""
+}
+
+/*HasUser reports whether the request was made by an identified user */
+func (e *Entry) HasUser() bool {
+	return e.User != "" && e.User != "-"
+}
+
+/*Host returns the destination host of the request without port */
+func (e *Entry) Host() string {
+	u := e.URL
+	if idx := strings.Index(u, "://"); idx >= 0 {
+		u = u[idx+3:]
+	}
+	if idx := strings.IndexAny(u, "/?#"); idx >= 0 {
+		u = u[:idx]
+	}
+	if idx := strings.LastIndex(u, "@"); idx >= 0 {
+		u = u[idx+1:]
+	}
+
+	if strings.HasPrefix(u, "[") {
+		if end := strings.Index(u, "]"); end > 0 {
+			return u[1:end]
+		}
+	}
+	if idx := strings.LastIndex(u, ":"); idx >= 0 && strings.Count(u, ":") == 1 {
+		u = u[:idx]
+	}
+
+	return strings.ToLower(u)
+}
+
+/*IsHit reports whether the request was served from the cache */
+func (e *Entry) IsHit() bool {
+	return strings.Contains(e.Result, "HIT")
+}
+
+func splitCodeStatus(field string) (string, int) {
+	idx := strings.Index(field, "/")
+	if idx < 0 {
+		return field, 0
+	}
+
+	status, err := strconv.Atoi(field[idx+1:])
+	if err != nil {
+		status = 0
+	}
+
+	return field[:idx], status
+}
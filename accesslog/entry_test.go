@@ -0,0 +1,90 @@
+package accesslog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingHandler struct {
+	entries []*Entry
+}
+
+func (h *recordingHandler) Handle(e *Entry) {
+	h.entries = append(h.entries, e)
+}
+
+func TestParseEntry(t *testing.T) {
+	line := "1286536308.779 180 192.168.0.224 TCP_MISS/200 411 GET http://www.example.com:8080/index.html alice DIRECT/93.184.216.34 text/html\n"
+
+	e, err := ParseEntry(line)
+
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1286536308, 779000000).Unix(), e.Time.Unix())
+	assert.Equal(t, 180*time.Millisecond, e.Elapsed)
+	assert.Equal(t, "192.168.0.224", e.Client)
+	assert.Equal(t, "TCP_MISS", e.Result)
+	assert.Equal(t, 200, e.Status)
+	assert.Equal(t, int64(411), e.Bytes)
+	assert.Equal(t, "alice", e.User)
+	assert.Equal(t, "DIRECT", e.Hierarchy)
+	assert.Equal(t, "93.184.216.34", e.PeerHost)
+	assert.Equal(t, "www.example.com", e.Host())
+	assert.True(t, e.HasUser())
+	assert.False(t, e.IsHit())
+	assert.Nil(t, e.Extra)
+}
+
+func TestParseEntryInvalid(t *testing.T) {
+	_, err := ParseEntry("not an access log line")
+
+	assert.EqualError(t, err, "access log - could not parse line: not an access log line")
+}
+
+func TestEntryHost(t *testing.T) {
+	tests := []struct {
+		url  string
+		host string
+	}{
+		{"www.example.com:443", "www.example.com"},
+		{"http://user:pw@Example.COM/path?q=1", "example.com"},
+		{"http://[2001:db8::1]:8080/", "2001:db8::1"},
+		{"ftp://ftp.example.org", "ftp.example.org"},
+	}
+
+	for _, tc := range tests {
+		e := &Entry{URL: tc.url}
+		assert.Equal(t, tc.host, e.Host(), tc.url)
+	}
+}
+
+func TestTailerFollowsRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	line := "1286536308.779 180 192.168.0.224 TCP_MISS/200 411 GET http://example.com/ - DIRECT/1.2.3.4 text/html\n"
+
+	assert.NoError(t, os.WriteFile(path, []byte(line), 0o644))
+
+	h := &recordingHandler{}
+	tailer := NewTailer(path, h)
+	assert.NoError(t, tailer.open(true))
+	defer tailer.close()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	f.WriteString(line)
+	f.WriteString(line[:20])
+	f.Close()
+
+	assert.NoError(t, tailer.poll())
+	assert.Len(t, h.entries, 1, "existing and partial lines must be skipped")
+
+	assert.NoError(t, os.Rename(path, path+".1"))
+	assert.NoError(t, os.WriteFile(path, []byte(line), 0o644))
+
+	assert.NoError(t, tailer.poll())
+	assert.NoError(t, tailer.poll())
+	assert.Len(t, h.entries, 2)
+}
@@ -0,0 +1,195 @@
+package accesslog
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultPollInterval = time.Second
+
+/*Handler receives every access log entry read by a Tailer */
+type Handler interface {
+	Handle(e *Entry)
+}
+
+/*Tailer follows a squid access log and dispatches new entries to its handlers */
+type Tailer struct {
+	path     string
+	interval time.Duration
+
+	mu       sync.Mutex
+	handlers []Handler
+	fields   []string
+
+	file    *os.File
+	reader  *bufio.Reader
+	offset  int64
+	partial string
+}
+
+/*NewTailer creates a tailer for the access log at path */
+func NewTailer(path string, handlers ...Handler) *Tailer {
+	return &Tailer{
+		path:     path,
+		interval: defaultPollInterval,
+		handlers: handlers,
+	}
+}
+
+/*AddHandler registers another handler for new entries */
+func (t *Tailer) AddHandler(h Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.handlers = append(t.handlers, h)
+}
+
+/*SetExtraFields names the fields appended to the native format by a custom logformat, in order */
+func (t *Tailer) SetExtraFields(names []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.fields = names
+}
+
+/*Run follows the log until stop is closed. Entries already in the file are skipped. */
+func (t *Tailer) Run(stop <-chan struct{}) {
+	if err := t.open(true); err != nil {
+		log.Printf("Could not open access log %q: %v", t.path, err)
+	}
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.poll(); err != nil {
+			log.Printf("Error reading access log %q: %v", t.path, err)
+		}
+
+		select {
+		case <-stop:
+			t.close()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tailer) open(seekEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	if seekEnd {
+		if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	t.file = f
+	t.reader = bufio.NewReader(f)
+	t.offset = offset
+	t.partial = ""
+
+	return nil
+}
+
+func (t *Tailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+		t.reader = nil
+	}
+}
+
+// rotated reports whether the file at path is no longer the one we are reading
+func (t *Tailer) rotated() bool {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return false
+	}
+
+	current, err := t.file.Stat()
+	if err != nil {
+		return true
+	}
+
+	return !os.SameFile(info, current) || info.Size() < t.offset
+}
+
+func (t *Tailer) poll() error {
+	if t.file == nil {
+		// The log did not exist yet, so everything in it is new.
+		if err := t.open(false); err != nil {
+			return nil
+		}
+	}
+
+	if err := t.readAvailable(); err != nil {
+		return err
+	}
+
+	if t.rotated() {
+		// Drain whatever was written to the old file before switching.
+		if err := t.readAvailable(); err != nil {
+			return err
+		}
+		t.close()
+
+		return t.open(false)
+	}
+
+	return nil
+}
+
+func (t *Tailer) readAvailable() error {
+	for {
+		line, err := t.reader.ReadString('\n')
+		t.offset += int64(len(line))
+
+		if err == io.EOF {
+			t.partial += line
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line = t.partial + line
+		t.partial = ""
+		t.dispatch(line)
+	}
+}
+
+func (t *Tailer) dispatch(line string) {
+	e, err := ParseEntry(line)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	t.mu.Lock()
+	handlers := t.handlers
+	fields := t.fields
+	t.mu.Unlock()
+
+	if len(fields) > 0 {
+		e.Fields = make(map[string]string, len(fields))
+		for i, name := range fields {
+			if i < len(e.Extra) {
+				e.Fields[name] = e.Extra[i]
+			}
+		}
+	}
+
+	for _, h := range handlers {
+		h.Handle(e)
+	}
+}
@@ -0,0 +1,146 @@
+package collector
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/boynux/squid-exporter/accesslog"
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Access log fields the adaptation collector reads, see Tailer.SetExtraFields
+	ICAPTimeField    = "icap_time"
+	ICAPServiceField = "icap_service"
+
+	// maxICAPServices bounds the number of distinct service names read from the access log
+	maxICAPServices = 50
+)
+
+/*AdaptationConfig configures the ICAP/eCAP adaptation collector */
+type AdaptationConfig struct {
+	// Page is the manager page reporting the adaptation services
+	Page   string
+	Labels config.Labels
+}
+
+/*AdaptationCollector exports ICAP/eCAP service state and ICAP transaction times */
+type AdaptationCollector struct {
+	*pageStatus
+
+	cfg    AdaptationConfig
+	client AdaptationClient
+
+	up           *prometheus.Desc
+	suspended    *prometheus.Desc
+	optionsValid *prometheus.Desc
+	fetching     *prometheus.Desc
+	failures     *prometheus.Desc
+	connections  *prometheus.Desc
+
+	durations    *prometheus.HistogramVec
+	servicesSeen map[string]bool
+}
+
+/*NewAdaptationCollector creates an adaptation collector */
+func NewAdaptationCollector(c *AdaptationConfig, client AdaptationClient) *AdaptationCollector {
+	labels := append([]string{"service"}, c.Labels.Keys...)
+	newDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "adaptation_service", name), help, labels, nil)
+	}
+
+	return &AdaptationCollector{
+		pageStatus: newPageStatus(c.Labels, c.Page),
+
+		cfg:    *c,
+		client: client,
+
+		up:           newDesc("up", "Whether squid considers the adaptation service up"),
+		suspended:    newDesc("suspended", "Whether the adaptation service is suspended after too many failures"),
+		optionsValid: newDesc("options_valid", "Whether squid holds valid and fresh OPTIONS for the service"),
+		fetching:     newDesc("options_fetching", "Whether an OPTIONS request to the service is in progress"),
+		failures:     newDesc("failures", "Recent failures squid remembers for the service"),
+		connections:  newDesc("connections", "Connections to the adaptation service"),
+
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "icap",
+			Name:      "transaction_duration_seconds",
+			Help:      "Total ICAP processing time of HTTP transactions, read from the access log",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, labels),
+		servicesSeen: map[string]bool{},
+	}
+}
+
+/*Handle accounts an access log entry, it implements accesslog.Handler */
+func (a *AdaptationCollector) Handle(e *accesslog.Entry) {
+	value := e.Field(ICAPTimeField)
+	if value == "" {
+		return
+	}
+
+	ms, err := strconv.ParseFloat(value, 64)
+	if err != nil || ms < 0 {
+		return
+	}
+
+	service := e.Field(ICAPServiceField)
+	if service == "" {
+		service = "unknown"
+	}
+	// Only the tailer goroutine calls Handle, so servicesSeen needs no locking.
+	if !a.servicesSeen[service] {
+		if len(a.servicesSeen) >= maxICAPServices {
+			service = otherLabel
+		} else {
+			a.servicesSeen[service] = true
+		}
+	}
+
+	a.durations.WithLabelValues(append([]string{service}, a.cfg.Labels.Values...)...).Observe(ms / 1000)
+}
+
+/*Describe implements prometheus.Collector */
+func (a *AdaptationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.up
+	ch <- a.suspended
+	ch <- a.optionsValid
+	ch <- a.fetching
+	ch <- a.failures
+	ch <- a.connections
+	a.durations.Describe(ch)
+	a.describeStatus(ch)
+}
+
+/*Collect implements prometheus.Collector */
+func (a *AdaptationCollector) Collect(ch chan<- prometheus.Metric) {
+	defer a.durations.Collect(ch)
+
+	services, err := a.client.GetAdaptationServices(a.cfg.Page)
+	a.collect(ch, a.cfg.Page, err)
+	if err != nil {
+		log.Println("Could not fetch adaptation services from squid instance: ", err)
+		return
+	}
+
+	for _, s := range services {
+		labels := append([]string{s.Name}, a.cfg.Labels.Values...)
+
+		ch <- prometheus.MustNewConstMetric(a.up, prometheus.GaugeValue, boolToFloat(s.Up), labels...)
+		ch <- prometheus.MustNewConstMetric(a.suspended, prometheus.GaugeValue, boolToFloat(s.Suspended), labels...)
+		ch <- prometheus.MustNewConstMetric(a.optionsValid, prometheus.GaugeValue, boolToFloat(s.OptionsValid), labels...)
+		ch <- prometheus.MustNewConstMetric(a.fetching, prometheus.GaugeValue, boolToFloat(s.Fetching), labels...)
+		ch <- prometheus.MustNewConstMetric(a.failures, prometheus.GaugeValue, s.Failures, labels...)
+		ch <- prometheus.MustNewConstMetric(a.connections, prometheus.GaugeValue, s.Connections, labels...)
+	}
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/accesslog"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAdaptationClient struct {
+	services types.AdaptationServices
+	err      error
+}
+
+func (m *mockAdaptationClient) GetAdaptationServices(page string) (types.AdaptationServices, error) {
+	return m.services, m.err
+}
+
+func TestDecodeAdaptationServices(t *testing.T) {
+	page := `Adaptation services:
+reqmod_av icap://127.0.0.1:1344/reqmod [up,fetch]
+	open connections: 3
+respmod_av icap://127.0.0.1:1344/respmod [down,susp,!opt,fail12]
+`
+	d := &adaptationDecoder{}
+	for _, line := range strings.SplitAfter(page, "\n") {
+		d.decode(line)
+	}
+
+	assert.Equal(t, types.AdaptationServices{
+		{Name: "reqmod_av", URI: "icap://127.0.0.1:1344/reqmod", Up: true, OptionsValid: true, Fetching: true, Connections: 3},
+		{Name: "respmod_av", URI: "icap://127.0.0.1:1344/respmod", Suspended: true, Failures: 12},
+	}, d.finish())
+}
+
+func TestDecodeAdaptationDetails(t *testing.T) {
+	page := `reqmod_av icap://127.0.0.1:1344/reqmod [up]
+	uri: icap://127.0.0.1:1344/reqmod
+	open connections:
+	idle connections: 2
+`
+	d := &adaptationDecoder{}
+	for _, line := range strings.SplitAfter(page, "\n") {
+		d.decode(line)
+	}
+
+	assert.Equal(t, types.AdaptationServices{
+		{Name: "reqmod_av", URI: "icap://127.0.0.1:1344/reqmod", Up: true, OptionsValid: true, Connections: 2},
+	}, d.finish())
+}
+
+func TestAdaptationCollect(t *testing.T) {
+	a := NewAdaptationCollector(&AdaptationConfig{Page: "adaptation"}, &mockAdaptationClient{services: types.AdaptationServices{
+		{Name: "reqmod_av", Up: true, OptionsValid: true},
+		{Name: "respmod_av", Suspended: true, Failures: 12},
+	}})
+
+	a.Handle(&accesslog.Entry{Fields: map[string]string{ICAPTimeField: "20", ICAPServiceField: "reqmod_av"}})
+	a.Handle(&accesslog.Entry{Fields: map[string]string{ICAPTimeField: "-"}})
+
+	expected := `
+# HELP squid_adaptation_service_up Whether squid considers the adaptation service up
+# TYPE squid_adaptation_service_up gauge
+squid_adaptation_service_up{service="reqmod_av"} 1
+squid_adaptation_service_up{service="respmod_av"} 0
+# HELP squid_adaptation_service_failures Recent failures squid remembers for the service
+# TYPE squid_adaptation_service_failures gauge
+squid_adaptation_service_failures{service="reqmod_av"} 0
+squid_adaptation_service_failures{service="respmod_av"} 12
+`
+	assert.NoError(t, testutil.CollectAndCompare(a, strings.NewReader(expected),
+		"squid_adaptation_service_up", "squid_adaptation_service_failures"))
+
+	assert.Equal(t, 1, testutil.CollectAndCount(a, "squid_icap_transaction_duration_seconds"))
+}
+
+func TestAdaptationCollectPageFailure(t *testing.T) {
+	client := &mockAdaptationClient{err: errors.New("connection refused")}
+	a := NewAdaptationCollector(&AdaptationConfig{Page: "adaptation"}, client)
+
+	expected := `
+# HELP squid_exporter_page_up Was the last fetch of the manager page successful?
+# TYPE squid_exporter_page_up gauge
+squid_exporter_page_up{page="adaptation"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(a, strings.NewReader(expected), "squid_exporter_page_up"))
+	assert.EqualError(t, a.lastScrapeError(), "connection refused")
+
+	client.err = nil
+	assert.Equal(t, 1, testutil.CollectAndCount(a, "squid_exporter_page_up"))
+	assert.NoError(t, a.lastScrapeError())
+}
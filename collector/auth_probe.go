@@ -0,0 +1,340 @@
+package collector
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	AuthSchemeBasic     = "basic"
+	AuthSchemeDigest    = "digest"
+	AuthSchemeNegotiate = "negotiate"
+)
+
+// Outcomes of an authentication probe, exported as the result label
+const (
+	authResultSuccess     = "success"
+	authResultRejected    = "rejected"
+	authResultTimeout     = "timeout"
+	authResultHelperError = "helper_error"
+	authResultUnsupported = "unsupported"
+	authResultError       = "error"
+)
+
+var authResults = []string{
+	authResultSuccess, authResultRejected, authResultTimeout, authResultHelperError, authResultUnsupported, authResultError,
+}
+
+/*AuthProbeConfig configures the proxy authentication probe */
+type AuthProbeConfig struct {
+	// Proxy is the squid proxy port to authenticate to, in host:port format
+	Proxy string
+	// Target is an http URL fetched through the proxy with the test credentials
+	Target  string
+	Schemes []string
+	Timeout time.Duration
+	// Login and Password are the test credentials for the Basic and Digest schemes
+	Login    string
+	Password string
+	// NegotiateCommand prints a base64 SPNEGO token for the proxy host given as its only argument
+	NegotiateCommand string
+	Labels           config.Labels
+}
+
+/*AuthProbeCollector authenticates through squid with test credentials on every scrape */
+type AuthProbeCollector struct {
+	cfg AuthProbeConfig
+
+	success    *prometheus.Desc
+	statusCode *prometheus.Desc
+	duration   *prometheus.Desc
+	result     *prometheus.Desc
+}
+
+// errNoChallenge is returned when squid does not offer the probed scheme
+var errNoChallenge = errors.New("scheme not offered by the proxy")
+
+/*NewAuthProbeCollector creates a proxy authentication probe collector */
+func NewAuthProbeCollector(c *AuthProbeConfig) (*AuthProbeCollector, error) {
+	if c.Timeout <= 0 {
+		return nil, errors.New("the authentication probe needs a timeout greater than 0")
+	}
+
+	for _, scheme := range c.Schemes {
+		switch scheme {
+		case AuthSchemeBasic, AuthSchemeDigest:
+		case AuthSchemeNegotiate:
+			if c.NegotiateCommand == "" {
+				return nil, errors.New("the negotiate scheme needs a command printing the token")
+			}
+		default:
+			return nil, fmt.Errorf("unknown authentication scheme %q", scheme)
+		}
+	}
+
+	newDesc := func(name, help string, extra ...string) *prometheus.Desc {
+		labels := append(append([]string{"scheme"}, extra...), c.Labels.Keys...)
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "auth_probe", name), help, labels, nil)
+	}
+
+	return &AuthProbeCollector{
+		cfg: *c,
+
+		success:    newDesc("success", "Whether the proxy accepted the test credentials"),
+		statusCode: newDesc("http_status_code", "HTTP status code of the authenticated request, 0 when none was received"),
+		duration:   newDesc("duration_seconds", "Duration of the authentication including the challenge round trip"),
+		result: newDesc("result", "Outcome of the authentication probe, 1 for the observed result: "+strings.Join(authResults, ", "),
+			"result"),
+	}, nil
+}
+
+/*Describe implements prometheus.Collector */
+func (a *AuthProbeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- a.success
+	ch <- a.statusCode
+	ch <- a.duration
+	ch <- a.result
+}
+
+/*Collect implements prometheus.Collector */
+func (a *AuthProbeCollector) Collect(ch chan<- prometheus.Metric) {
+	var wg sync.WaitGroup
+	for _, scheme := range a.cfg.Schemes {
+		wg.Add(1)
+		go func(scheme string) {
+			defer wg.Done()
+			a.collectScheme(ch, scheme)
+		}(scheme)
+	}
+	wg.Wait()
+}
+
+func (a *AuthProbeCollector) collectScheme(ch chan<- prometheus.Metric, scheme string) {
+	start := time.Now()
+	status, err := a.probe(scheme)
+	duration := time.Since(start).Seconds()
+
+	result := classifyAuthResult(status, err)
+	if err != nil {
+		log.Printf("Authentication probe with scheme %s through %s failed: %v", scheme, a.cfg.Proxy, err)
+	}
+
+	labels := append([]string{scheme}, a.cfg.Labels.Values...)
+	ch <- prometheus.MustNewConstMetric(a.success, prometheus.GaugeValue, boolToFloat(result == authResultSuccess), labels...)
+	ch <- prometheus.MustNewConstMetric(a.statusCode, prometheus.GaugeValue, float64(status), labels...)
+	ch <- prometheus.MustNewConstMetric(a.duration, prometheus.GaugeValue, duration, labels...)
+	for _, r := range authResults {
+		ch <- prometheus.MustNewConstMetric(a.result, prometheus.GaugeValue, boolToFloat(r == result),
+			append([]string{scheme, r}, a.cfg.Labels.Values...)...)
+	}
+}
+
+// classifyAuthResult tells rejected credentials (407 in reply to them) apart from
+// helpers that hang (probe timeout) or fail (squid answers with a server error).
+func classifyAuthResult(status int, err error) string {
+	switch {
+	case errors.Is(err, errNoChallenge):
+		return authResultUnsupported
+	case errors.Is(err, context.DeadlineExceeded):
+		return authResultTimeout
+	case err != nil:
+		return authResultError
+	case status == http.StatusProxyAuthRequired:
+		return authResultRejected
+	case status >= 500:
+		return authResultHelperError
+	case status >= 200 && status < 400:
+		return authResultSuccess
+	}
+
+	return authResultError
+}
+
+func (a *AuthProbeCollector) probe(scheme string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Timeout)
+	defer cancel()
+
+	transport := newProxyTransport(a.cfg.Proxy, false)
+	defer transport.CloseIdleConnections()
+
+	var credentials string
+	switch scheme {
+	case AuthSchemeBasic:
+		credentials = "Basic " + buildBasicAuthString(a.cfg.Login, a.cfg.Password)
+	default:
+		// Digest and Negotiate need the challenge squid sends with its first 407
+		status, challenge, err := a.roundTrip(ctx, transport, "")
+		if err != nil {
+			return status, err
+		}
+		if status != http.StatusProxyAuthRequired {
+			return status, fmt.Errorf("expected a %d challenge, got status %d", http.StatusProxyAuthRequired, status)
+		}
+
+		params, ok := findChallenge(challenge, scheme)
+		if !ok {
+			return status, errNoChallenge
+		}
+
+		if credentials, err = a.credentials(ctx, scheme, params); err != nil {
+			return 0, err
+		}
+	}
+
+	status, _, err := a.roundTrip(ctx, transport, credentials)
+
+	return status, err
+}
+
+// roundTrip fetches the target through the proxy and returns the status and the proxy challenges
+func (a *AuthProbeCollector) roundTrip(ctx context.Context, transport *http.Transport, credentials string) (int, []string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.cfg.Target, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if credentials != "" {
+		req.Header.Set("Proxy-Authorization", credentials)
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	return resp.StatusCode, resp.Header.Values("Proxy-Authenticate"), nil
+}
+
+func (a *AuthProbeCollector) credentials(ctx context.Context, scheme string, params map[string]string) (string, error) {
+	if scheme == AuthSchemeNegotiate {
+		host := a.cfg.Proxy
+		if u, err := url.Parse("http://" + a.cfg.Proxy); err == nil {
+			host = u.Hostname()
+		}
+
+		out, err := exec.CommandContext(ctx, a.cfg.NegotiateCommand, host).Output()
+		if err != nil {
+			return "", fmt.Errorf("negotiate command failed: %v", err)
+		}
+
+		return "Negotiate " + strings.TrimSpace(string(out)), nil
+	}
+
+	return digestCredentials(params, a.cfg.Login, a.cfg.Password, http.MethodGet, a.cfg.Target)
+}
+
+// findChallenge returns the parameters of the challenge for scheme among the Proxy-Authenticate headers
+func findChallenge(challenges []string, scheme string) (map[string]string, bool) {
+	for _, c := range challenges {
+		name, rest, _ := strings.Cut(strings.TrimSpace(c), " ")
+		if strings.EqualFold(name, scheme) {
+			return parseAuthParams(rest), true
+		}
+	}
+
+	return nil, false
+}
+
+// parseAuthParams parses comma separated key=value pairs, values may be quoted and contain commas
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			rest = rest[1:]
+			if end := strings.Index(rest, `"`); end >= 0 {
+				value, s = rest[:end], rest[end+1:]
+			} else {
+				value, s = rest, ""
+			}
+		} else {
+			value, s, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+
+	return params
+}
+
+// digestCredentials answers a Digest challenge as described in RFC 2617
+func digestCredentials(params map[string]string, login, password, method, uri string) (string, error) {
+	if alg := params["algorithm"]; alg != "" && !strings.EqualFold(alg, "MD5") {
+		return "", fmt.Errorf("unsupported digest algorithm %q", alg)
+	}
+
+	md5Hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	ha1 := md5Hex(login + ":" + params["realm"] + ":" + password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, login),
+		fmt.Sprintf(`realm="%s"`, params["realm"]),
+		fmt.Sprintf(`nonce="%s"`, params["nonce"]),
+		fmt.Sprintf(`uri="%s"`, uri),
+		`algorithm=MD5`,
+	}
+
+	var response string
+	if qops := strings.Split(params["qop"], ","); params["qop"] != "" {
+		if !containsFold(qops, "auth") {
+			return "", fmt.Errorf("unsupported digest qop %q", params["qop"])
+		}
+
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		cnonce, nc := hex.EncodeToString(buf), "00000001"
+
+		response = md5Hex(strings.Join([]string{ha1, params["nonce"], nc, cnonce, "auth", ha2}, ":"))
+		fields = append(fields, "qop=auth", "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	} else {
+		response = md5Hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+	}
+
+	fields = append(fields, fmt.Sprintf(`response="%s"`, response))
+	if opaque, ok := params["opaque"]; ok {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, opaque))
+	}
+
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+
+	return false
+}
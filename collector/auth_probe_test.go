@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testAuthRealm = "squid"
+	testAuthNonce = "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+)
+
+// testAuthProxy checks Basic and Digest credentials like squid auth helpers would,
+// delay and status simulate a hanging or failing helper.
+type testAuthProxy struct {
+	login    string
+	password string
+	delay    time.Duration
+	status   int
+}
+
+func (p *testAuthProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	credentials := r.Header.Get("Proxy-Authorization")
+	if credentials != "" && p.delay > 0 {
+		time.Sleep(p.delay)
+	}
+	if credentials != "" && p.status != 0 {
+		w.WriteHeader(p.status)
+		return
+	}
+
+	if p.valid(r.Method, credentials) {
+		w.Header().Set("X-Cache", "MISS from testproxy")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	w.Header().Add("Proxy-Authenticate", fmt.Sprintf(`Basic realm="%s"`, testAuthRealm))
+	w.Header().Add("Proxy-Authenticate",
+		fmt.Sprintf(`Digest realm="%s", nonce="%s", qop="auth,auth-int", stale=false`, testAuthRealm, testAuthNonce))
+	w.WriteHeader(http.StatusProxyAuthRequired)
+}
+
+func (p *testAuthProxy) valid(method, credentials string) bool {
+	scheme, rest, _ := strings.Cut(credentials, " ")
+	switch scheme {
+	case "Basic":
+		return rest == buildBasicAuthString(p.login, p.password)
+	case "Digest":
+		params := parseAuthParams(rest)
+		md5Hex := func(s string) string {
+			sum := md5.Sum([]byte(s))
+			return hex.EncodeToString(sum[:])
+		}
+
+		ha1 := md5Hex(params["username"] + ":" + testAuthRealm + ":" + p.password)
+		ha2 := md5Hex(method + ":" + params["uri"])
+		expected := md5Hex(strings.Join([]string{ha1, testAuthNonce, params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+
+		return params["username"] == p.login && params["response"] == expected
+	}
+
+	return false
+}
+
+func authProbeMetrics(scheme, result string, status int) string {
+	var results []string
+	for _, r := range authResults {
+		results = append(results, fmt.Sprintf(`squid_auth_probe_result{result="%s",scheme="%s"} %d`, r, scheme, map[bool]int{true: 1}[r == result]))
+	}
+
+	return fmt.Sprintf(`
+# HELP squid_auth_probe_http_status_code HTTP status code of the authenticated request, 0 when none was received
+# TYPE squid_auth_probe_http_status_code gauge
+squid_auth_probe_http_status_code{scheme="%s"} %d
+# HELP squid_auth_probe_result Outcome of the authentication probe, 1 for the observed result: success, rejected, timeout, helper_error, unsupported, error
+# TYPE squid_auth_probe_result gauge
+%s
+`, scheme, status, strings.Join(results, "\n"))
+}
+
+func TestAuthProbe(t *testing.T) {
+	origin := httptest.NewServer(newTestOrigin(http.StatusOK))
+	defer origin.Close()
+
+	tests := []struct {
+		name     string
+		proxy    *testAuthProxy
+		scheme   string
+		password string
+		result   string
+		status   int
+	}{
+		{"basic", &testAuthProxy{login: "probe", password: "secret"}, AuthSchemeBasic, "secret", authResultSuccess, 200},
+		{"digest", &testAuthProxy{login: "probe", password: "secret"}, AuthSchemeDigest, "secret", authResultSuccess, 200},
+		{"wrong password", &testAuthProxy{login: "probe", password: "secret"}, AuthSchemeDigest, "wrong", authResultRejected, 407},
+		{"helper timeout", &testAuthProxy{login: "probe", password: "secret", delay: 500 * time.Millisecond}, AuthSchemeBasic, "secret", authResultTimeout, 0},
+		{"helper failure", &testAuthProxy{login: "probe", password: "secret", status: 503}, AuthSchemeBasic, "secret", authResultHelperError, 503},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			proxy := httptest.NewServer(tc.proxy)
+			defer proxy.Close()
+
+			c, err := NewAuthProbeCollector(&AuthProbeConfig{
+				Proxy:    strings.TrimPrefix(proxy.URL, "http://"),
+				Target:   origin.URL,
+				Schemes:  []string{tc.scheme},
+				Timeout:  100 * time.Millisecond,
+				Login:    "probe",
+				Password: tc.password,
+				Labels:   config.Labels{},
+			})
+			assert.NoError(t, err)
+
+			assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(authProbeMetrics(tc.scheme, tc.result, tc.status)),
+				"squid_auth_probe_http_status_code", "squid_auth_probe_result"))
+		})
+	}
+}
+
+func TestAuthProbeConfig(t *testing.T) {
+	_, err := NewAuthProbeCollector(&AuthProbeConfig{Schemes: []string{AuthSchemeNegotiate}, Timeout: time.Second})
+	assert.EqualError(t, err, "the negotiate scheme needs a command printing the token")
+
+	_, err = NewAuthProbeCollector(&AuthProbeConfig{Schemes: []string{"ntlm"}, Timeout: time.Second})
+	assert.EqualError(t, err, `unknown authentication scheme "ntlm"`)
+
+	_, err = NewAuthProbeCollector(&AuthProbeConfig{Schemes: []string{AuthSchemeBasic}})
+	assert.EqualError(t, err, "the authentication probe needs a timeout greater than 0")
+}
+
+func TestParseAuthParams(t *testing.T) {
+	assert.Equal(t, map[string]string{"realm": "squid, proxy", "nonce": "abc", "stale": "false"},
+		parseAuthParams(`realm="squid, proxy", nonce="abc",stale=false`))
+}
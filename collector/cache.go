@@ -0,0 +1,209 @@
+package collector
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// scrapeReporter is implemented by collectors that can tell whether their last
+// Collect reached squid, so failed scrapes do not replace good cached data.
+type scrapeReporter interface {
+	lastScrapeError() error
+}
+
+// statusDescriber is implemented by collectors exporting whether squid could be
+// scraped, e.g. squid_up. Those metrics always come from the latest scrape, so
+// stale data does not hide an outage.
+type statusDescriber interface {
+	describeStatus(ch chan<- *prometheus.Desc)
+}
+
+// cacheEntry holds the metrics last served for one collector
+type cacheEntry struct {
+	metrics     []prometheus.Metric
+	lastSuccess time.Time
+	stale       bool
+}
+
+/*CachedCollectorConfig configures background scraping */
+type CachedCollectorConfig struct {
+	// Interval is the time between two background scrapes
+	Interval time.Duration
+	// MaxStale is how long the last good data is served while squid fails, 0 never serves stale data
+	MaxStale time.Duration
+	Labels   config.Labels
+}
+
+/*CachedCollector scrapes its collectors in the background and serves the cached metrics */
+type CachedCollector struct {
+	cfg        CachedCollectorConfig
+	collectors []prometheus.Collector
+	statuses   map[*prometheus.Desc]bool
+	now        func() time.Time
+
+	mu           sync.RWMutex
+	entries      []cacheEntry
+	lastSuccess  time.Time
+	scrapeErrors float64
+
+	lastScrape *prometheus.Desc
+	stale      *prometheus.Desc
+	errors     *prometheus.Desc
+}
+
+/*NewCachedCollector wraps collectors so they are scraped every interval instead of on every request */
+func NewCachedCollector(c *CachedCollectorConfig, collectors ...prometheus.Collector) *CachedCollector {
+	statuses := map[*prometheus.Desc]bool{}
+	for _, collector := range collectors {
+		if d, ok := collector.(statusDescriber); ok {
+			ch := make(chan *prometheus.Desc)
+			go func() {
+				d.describeStatus(ch)
+				close(ch)
+			}()
+			for desc := range ch {
+				statuses[desc] = true
+			}
+		}
+	}
+
+	return &CachedCollector{
+		cfg:        *c,
+		collectors: collectors,
+		statuses:   statuses,
+		now:        time.Now,
+		entries:    make([]cacheEntry, len(collectors)),
+
+		lastScrape: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "last_scrape_timestamp_seconds"),
+			"Time of the last successful background scrape of squid, the age of the served data", c.Labels.Keys, nil),
+		stale: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "serving_stale_data"),
+			"Whether metrics of an earlier background scrape are served because squid failed on the last one", c.Labels.Keys, nil),
+		errors: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "scrape_errors_total"),
+			"Background scrapes of squid that failed", c.Labels.Keys, nil),
+	}
+}
+
+/*Run scrapes the collectors every interval until stop is closed */
+func (c *CachedCollector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.Scrape()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*Scrape collects all wrapped collectors once and updates the cache */
+func (c *CachedCollector) Scrape() {
+	metrics := make([][]prometheus.Metric, len(c.collectors))
+	errs := make([]error, len(c.collectors))
+	for i, collector := range c.collectors {
+		metrics[i] = collectMetrics(collector)
+		if r, ok := collector.(scrapeReporter); ok {
+			errs[i] = r.lastScrapeError()
+		}
+	}
+
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := range c.collectors {
+		c.entries[i] = c.update(c.entries[i], metrics[i], errs[i], now)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		c.scrapeErrors++
+		return
+	}
+	c.lastSuccess = now
+}
+
+// update returns the entry of a collector after a scrape. A failed collector
+// keeps its last good metrics for a while, squid may only be restarting, but
+// its status metrics are taken from the failed scrape.
+func (c *CachedCollector) update(entry cacheEntry, metrics []prometheus.Metric, err error, now time.Time) cacheEntry {
+	if err == nil {
+		return cacheEntry{metrics: metrics, lastSuccess: now}
+	}
+	if entry.lastSuccess.IsZero() || now.Sub(entry.lastSuccess) > c.cfg.MaxStale {
+		return cacheEntry{metrics: metrics, lastSuccess: entry.lastSuccess}
+	}
+	log.Printf("Background scrape failed, serving data from %s: %v", entry.lastSuccess.Format(time.RFC3339), err)
+
+	var merged []prometheus.Metric
+	for _, m := range metrics {
+		if c.statuses[m.Desc()] {
+			merged = append(merged, m)
+		}
+	}
+	for _, m := range entry.metrics {
+		if !c.statuses[m.Desc()] {
+			merged = append(merged, m)
+		}
+	}
+
+	return cacheEntry{metrics: merged, lastSuccess: entry.lastSuccess, stale: true}
+}
+
+// collectMetrics returns the metrics of a single Collect of collector
+func collectMetrics(collector prometheus.Collector) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+
+	collector.Collect(ch)
+	close(ch)
+
+	return <-done
+}
+
+/*Describe implements prometheus.Collector */
+func (c *CachedCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors {
+		collector.Describe(ch)
+	}
+
+	ch <- c.lastScrape
+	ch <- c.stale
+	ch <- c.errors
+}
+
+/*Collect implements prometheus.Collector */
+func (c *CachedCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var stale bool
+	for _, entry := range c.entries {
+		for _, m := range entry.metrics {
+			ch <- m
+		}
+		stale = stale || entry.stale
+	}
+
+	if !c.lastSuccess.IsZero() {
+		ch <- prometheus.MustNewConstMetric(c.lastScrape, prometheus.GaugeValue,
+			float64(c.lastSuccess.UnixNano())/1e9, c.cfg.Labels.Values...)
+	}
+	ch <- prometheus.MustNewConstMetric(c.stale, prometheus.GaugeValue, boolToFloat(stale), c.cfg.Labels.Values...)
+	ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, c.scrapeErrors, c.cfg.Labels.Values...)
+}
@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSquidCollector exports the number of times it was collected and fails on demand
+type fakeSquidCollector struct {
+	desc  *prometheus.Desc
+	calls float64
+	err   error
+}
+
+func (f *fakeSquidCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+func (f *fakeSquidCollector) Collect(ch chan<- prometheus.Metric) {
+	f.calls++
+	if f.err == nil {
+		ch <- prometheus.MustNewConstMetric(f.desc, prometheus.CounterValue, f.calls)
+	}
+}
+
+func (f *fakeSquidCollector) lastScrapeError() error {
+	return f.err
+}
+
+func TestCachedCollector(t *testing.T) {
+	fake := &fakeSquidCollector{desc: prometheus.NewDesc("squid_fake_total", "Fake counter", nil, nil)}
+	c := NewCachedCollector(&CachedCollectorConfig{Interval: time.Second, MaxStale: time.Minute, Labels: config.Labels{}}, fake)
+
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+
+	expected := func(value int, timestamp int64, stale int, errors int) string {
+		return fmt.Sprintf(`
+# HELP squid_fake_total Fake counter
+# TYPE squid_fake_total counter
+squid_fake_total %d
+# HELP squid_exporter_last_scrape_timestamp_seconds Time of the last successful background scrape of squid, the age of the served data
+# TYPE squid_exporter_last_scrape_timestamp_seconds gauge
+squid_exporter_last_scrape_timestamp_seconds %d
+# HELP squid_exporter_serving_stale_data Whether metrics of an earlier background scrape are served because squid failed on the last one
+# TYPE squid_exporter_serving_stale_data gauge
+squid_exporter_serving_stale_data %d
+# HELP squid_exporter_scrape_errors_total Background scrapes of squid that failed
+# TYPE squid_exporter_scrape_errors_total counter
+squid_exporter_scrape_errors_total %d
+`, value, timestamp, stale, errors)
+	}
+
+	c.Scrape()
+	// Serving from the cache does not reach squid
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected(1, now.Unix(), 0, 0))))
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected(1, now.Unix(), 0, 0))))
+	assert.Equal(t, float64(1), fake.calls)
+
+	// Last good data is served while squid fails within the stale window
+	fake.err = errors.New("connection refused")
+	start := now
+	now = now.Add(30 * time.Second)
+	c.Scrape()
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected(1, start.Unix(), 1, 1))))
+
+	// Past the window the failed result replaces it
+	now = now.Add(time.Minute)
+	c.Scrape()
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected(0, start.Unix(), 0, 2)),
+		"squid_exporter_last_scrape_timestamp_seconds", "squid_exporter_serving_stale_data", "squid_exporter_scrape_errors_total"))
+	assert.Equal(t, 0, testutil.CollectAndCount(c, "squid_fake_total"))
+}
+
+func TestCachedCollectorStaleStatus(t *testing.T) {
+	client := &mockSquidClient{}
+	e := New(&CollectorConfig{Hostname: "localhost", Labels: config.Labels{}})
+	e.client = client
+	delayClient := &mockDelayPoolsClient{}
+	delay := NewDelayPoolsCollector(&DelayPoolsConfig{Labels: config.Labels{}}, delayClient)
+	c := NewCachedCollector(&CachedCollectorConfig{Interval: time.Second, MaxStale: time.Minute, Labels: config.Labels{}}, e, delay)
+
+	c.Scrape()
+	client.err = errors.New("connection refused")
+	c.Scrape()
+
+	// The cached counters are kept, but squid_up tells squid is down
+	expected := `
+# HELP squid_client_http_requests_total The total number of client requests
+# TYPE squid_client_http_requests_total counter
+squid_client_http_requests_total 1
+# HELP squid_exporter_serving_stale_data Whether metrics of an earlier background scrape are served because squid failed on the last one
+# TYPE squid_exporter_serving_stale_data gauge
+squid_exporter_serving_stale_data 1
+# HELP squid_up Was the last query of squid successful?
+# TYPE squid_up gauge
+squid_up{host="localhost"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_client_http_requests_total", "squid_exporter_serving_stale_data", "squid_up"))
+
+	// A failing page of another collector counts as a failed scrape
+	client.err = nil
+	delayClient.err = errors.New("connection reset")
+	c.Scrape()
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP squid_exporter_page_up Was the last fetch of the manager page successful?
+# TYPE squid_exporter_page_up gauge
+squid_exporter_page_up{page="delay"} 0
+# HELP squid_exporter_scrape_errors_total Background scrapes of squid that failed
+# TYPE squid_exporter_scrape_errors_total counter
+squid_exporter_scrape_errors_total 2
+# HELP squid_up Was the last query of squid successful?
+# TYPE squid_up gauge
+squid_up{host="localhost"} 1
+`), "squid_exporter_page_up", "squid_exporter_scrape_errors_total", "squid_up"))
+}
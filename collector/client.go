@@ -1,43 +1,51 @@
 package collector
 
 import (
-	"bufio"
 	"encoding/base64"
-	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode"
 
+	"github.com/boynux/squid-exporter/squidmgr"
 	"github.com/boynux/squid-exporter/types"
 )
 
-var kidType string = "kid"
-var kidId int = 0
-
 /*CacheObjectClient holds information about squid manager */
 type CacheObjectClient struct {
 	ch              connectionHandler
 	basicAuthString string
 	headers         []string
+	pool            *ConnPool
+	retry           *Retrier
+	failures        *ParseFailures
+
+	mu     sync.Mutex
+	server string // Server header of the last response
 }
 
 type CacheMemoryClient struct {
 	ch              connectionHandler
 	basicAuthString string
 	headers         []string
+	pool            *ConnPool
+	retry           *Retrier
+	failures        *ParseFailures
 }
 type connectionHandler interface {
 	connect() (net.Conn, error)
 }
 
 type connectionHandlerImpl struct {
-	hostname string
-	port     int
+	hostname    string
+	port        int
+	proxyHeader []byte
 }
 
 /*SquidClient provides functionality to fetch squid metrics */
@@ -50,8 +58,65 @@ type MemClient interface {
 	GetMems() (types.MemInstances, error)
 }
 
+/*ClientListClient fetches the per client statistics from squid */
+type ClientListClient interface {
+	GetClientList() (types.ClientInfos, error)
+}
+
+/*HelperClient fetches helper statistics from squid */
+type HelperClient interface {
+	GetHelperStats(page string) (types.HelperStats, error)
+}
+
+/*AdaptationClient fetches the ICAP/eCAP service state from squid */
+type AdaptationClient interface {
+	GetAdaptationServices(page string) (types.AdaptationServices, error)
+}
+
+/*StoreIOClient fetches disk and store I/O statistics from squid */
+type StoreIOClient interface {
+	GetStoreIO() (types.Counters, error)
+	GetIO() (types.Counters, error)
+	GetDiskd() (types.Counters, error)
+	GetAIOCounts() (types.Counters, error)
+}
+
+/*DigestClient fetches cache digest and refresh pattern statistics from squid */
+type DigestClient interface {
+	GetStoreDigest() (types.Counters, error)
+	GetRefresh() (types.Counters, error)
+}
+
+/*ObjectsClient streams the cached objects listed on the objects and vm_objects pages */
+type ObjectsClient interface {
+	GetObjects(page string, maxLines int, fn func(types.StoreObject)) (bool, error)
+}
+
+/*ForwardClient fetches forwarding and HTTP header statistics from squid */
+type ForwardClient interface {
+	GetForward() (types.Counters, error)
+	GetHTTPHeaders() (types.Counters, error)
+	GetHeaderValues(page string) (types.Counters, error)
+}
+
+/*EventsClient fetches the internal event queue from squid */
+type EventsClient interface {
+	GetEvents() (types.EventQueue, error)
+}
+
+/*VersionClient reports the squid version of the Server header, for info pages without one */
+type VersionClient interface {
+	ServerVersion() string
+}
+
+/*DelayPoolsClient fetches the delay pools state from squid */
+type DelayPoolsClient interface {
+	GetDelayPools() (types.DelayPools, error)
+}
+
 const (
-	requestProtocol = "GET cache_object://localhost/%s HTTP/1.0"
+	requestProtocol          = "GET cache_object://localhost/%s HTTP/1.0"
+	requestProtocolKeepAlive = "GET cache_object://localhost/%s HTTP/1.1"
 )
 
 func buildBasicAuthString(login string, password string) string {
@@ -68,17 +133,29 @@ type CacheObjectRequest struct {
 	Login    string
 	Password string
 	Headers  []string
+	// ProxyHeader is a PROXY protocol header written first on every connection, optional
+	ProxyHeader []byte
+	// Pool keeps connections open between requests, optional
+	Pool *ConnPool
+	// Retry retries failed connections and guards squid with a circuit breaker, optional
+	Retry *Retrier
+	// ParseFailures counts the pages a parser panicked on, optional
+	ParseFailures *ParseFailures
 }
 
 /*NewCacheObjectClient initializes a new cache client */
 func NewCacheObjectClient(cor *CacheObjectRequest) *CacheObjectClient {
 	return &CacheObjectClient{
-		&connectionHandlerImpl{
+		ch: &connectionHandlerImpl{
 			cor.Hostname,
 			cor.Port,
+			cor.ProxyHeader,
 		},
-		buildBasicAuthString(cor.Login, cor.Password),
-		cor.Headers,
+		basicAuthString: buildBasicAuthString(cor.Login, cor.Password),
+		headers:         cor.Headers,
+		pool:            cor.Pool,
+		retry:           cor.Retry,
+		failures:        cor.ParseFailures,
 	}
 }
 
@@ -87,253 +164,417 @@ func NewCacheMemoryClient(cor *CacheObjectRequest) *CacheMemoryClient {
 	// return &CacheMemoryClient{request: req}
 
 	return &CacheMemoryClient{
-		&connectionHandlerImpl{
+		ch: &connectionHandlerImpl{
 			cor.Hostname,
 			cor.Port,
+			cor.ProxyHeader,
 		},
-		buildBasicAuthString(cor.Login, cor.Password),
-		cor.Headers,
+		basicAuthString: buildBasicAuthString(cor.Login, cor.Password),
+		headers:         cor.Headers,
+		pool:            cor.Pool,
+		retry:           cor.Retry,
+		failures:        cor.ParseFailures,
 	}
 }
 
-func (c *CacheObjectClient) readFromSquid(endpoint string) (*bufio.Reader, error) {
-	conn, err := c.ch.connect()
+func (c *CacheObjectClient) readFromSquid(endpoint string) (io.ReadCloser, error) {
+	r, err := fetch(c.ch, c.pool, c.retry, endpoint, c.basicAuthString, c.headers)
 
 	if err != nil {
 		return nil, err
 	}
-	r, err := get(conn, endpoint, c.basicAuthString, c.headers)
 
-	if err != nil {
-		return nil, err
+	if server := r.Header.Get("Server"); server != "" {
+		c.mu.Lock()
+		c.server = server
+		c.mu.Unlock()
 	}
 
 	if r.StatusCode != 200 {
+		r.Body.Close()
 		return nil, fmt.Errorf("Non success code %d while fetching metrics", r.StatusCode)
 	}
 
-	return bufio.NewReader(r.Body), err
+	return r.Body, nil
 }
 
-func (c *CacheMemoryClient) readFromSquidMem(endpoint string) (*bufio.Reader, error) {
-	conn, err := c.ch.connect()
-
-	if err != nil {
-		return nil, err
-	}
-	r, err := get(conn, endpoint, c.basicAuthString, c.headers)
+func (c *CacheMemoryClient) readFromSquidMem(endpoint string) (io.ReadCloser, error) {
+	r, err := fetch(c.ch, c.pool, c.retry, endpoint, c.basicAuthString, c.headers)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if r.StatusCode != 200 {
+		r.Body.Close()
 		return nil, fmt.Errorf("Non success code %d while fetching metrics", r.StatusCode)
 	}
 
-	return bufio.NewReader(r.Body), err
+	return r.Body, nil
 }
 
-func readLines(reader *bufio.Reader, lines chan<- string) {
-	for {
-		line, err := reader.ReadString('\n')
+// fetch sends the request for endpoint through pool. Connection failures and
+// failures reading the response header are retried by retry.
+func fetch(ch connectionHandler, pool *ConnPool, retry *Retrier, endpoint string, basicAuthString string, headers []string) (*http.Response, error) {
+	var resp *http.Response
 
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			log.Printf("error reading from the bufio.Reader: %v", err)
-			break
-		}
-		// log.Printf("Line read: %s", line)
-		lines <- line
+	err := retry.do(func() error {
+		var err error
+		resp, err = pool.fetch(ch, endpoint, basicAuthString, headers)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	close(lines)
+
+	return resp, nil
+}
+
+// manager builds the typed squidmgr client on the pooled, retrying connections
+func (c *CacheObjectClient) manager() *squidmgr.Client {
+	return &squidmgr.Client{Fetcher: c}
+}
+
+/*ServerVersion returns the Server header of the last response, e.g. squid/6.10 */
+func (c *CacheObjectClient) ServerVersion() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.server
+}
+
+/*Fetch returns the body of a cache manager page, it implements squidmgr.Fetcher */
+func (c *CacheObjectClient) Fetch(page string) (io.ReadCloser, error) {
+	return c.readFromSquid(page)
+}
+
+/*Fetch returns the body of a cache manager page, it implements squidmgr.Fetcher */
+func (c *CacheMemoryClient) Fetch(page string) (io.ReadCloser, error) {
+	return c.readFromSquidMem(page)
 }
 
 /*GetCounters fetches counters from squid cache manager */
 func (c *CacheObjectClient) GetCounters() (types.Counters, error) {
-	var counters types.Counters
-
-	reader, err := c.readFromSquid("counters")
+	page, err := c.manager().Counters()
 	if err != nil {
-		return nil, fmt.Errorf("error getting counters: %v", err)
+		c.failures.record(err)
+		return nil, err
 	}
 
-	lines := make(chan string)
-	go readLines(reader, lines)
-
-	for line := range lines {
-		// log.Printf("Processing line: %s", line)
-		c, err := decodeCounterStrings(line)
-		if err != nil {
-			log.Println(err)
-		} else {
-			counters = append(counters, c)
-		}
+	counters := make(types.Counters, 0, len(page))
+	for _, counter := range page {
+		counters = append(counters, types.Counter{Key: counter.Name, Value: counter.Value})
 	}
 
-	return counters, err
+	return counters, nil
 }
 
 /*GetMems fetches Memory pool from squid cache manager */
 func (c *CacheMemoryClient) GetMems() (types.MemInstances, error) {
-	var Mems types.MemInstances
-	reader, err := c.readFromSquidMem("mem")
-
+	pools, err := (&squidmgr.Client{Fetcher: c}).MemPools()
 	if err != nil {
-		return nil, fmt.Errorf("error getting Mempools: %v", err)
+		c.failures.record(err)
+		return nil, err
 	}
 
-	lines := make(chan string)
-	go readLines(reader, lines)
-	kidId = 0
-	// fileName := "mem1.txt"
-
-	// // Open the file
-	// file, err := os.Open(fileName)
-	// if err != nil {
-	// 	log.Fatalf("Failed to open file: %v", err)
-	// }
-	// defer file.Close()
-
-	// // Create a slice to hold all lines
-	// var lines []string
-
-	// // Use a scanner to read the file line by line
-	// scanner := bufio.NewScanner(file)
-	// for scanner.Scan() {
-	// 	line := scanner.Text() // Read the current line
-	// 	lines = append(lines, line)
-	// }
-
 	var aggregatedMetrics = make(map[string]types.MemInstance)
+	for _, pool := range pools {
+		values := []struct {
+			key   string
+			value float64
+		}{
+			{"obj_size_bytes", pool.ObjSizeBytes},
+			{"chunks_kb_per_chunk", pool.ChunksKBPerChunk},
+			{"objs_per_chunk", pool.ObjsPerChunk},
+			{"alloc_bytes", pool.AllocBytes},
+			{"inuse_bytes", pool.InuseBytes},
+			{"idle_bytes", pool.IdleBytes},
+			{"fragmentation_pct", pool.FragmentationPct},
+			{"allocation_rate_per_sec", pool.AllocationRatePerSec},
+		}
 
-	for line := range lines {
-		// log.Printf("Processing line: %s", line)
-		c, err := decodeMemStrings(line)
-		if err != nil {
-			log.Println(err)
-		} else {
-			for i := 0; i < len(c.VarLabels); i++ {
-				var memTemp types.MemInstance
-
-				memTemp.KID = kidType
-				memTemp.Pool = c.Key
-				memValue, err := strconv.ParseFloat(c.VarLabels[i].Value, 64)
-				memTemp.Value = memValue
-				memTemp.Key = c.VarLabels[i].Key
-				if err == nil {
-				}
-
-				uniqueKey := fmt.Sprintf("%s_%s_%s", memTemp.Key, memTemp.KID, memTemp.Pool)
+		for _, v := range values {
+			uniqueKey := fmt.Sprintf("%s_%s_%s", v.key, pool.Kid, pool.Pool)
 
-				// Aggregate the values if the metric already exists
-				if existing, exists := aggregatedMetrics[uniqueKey]; exists {
-					existing.Value += memValue
-					aggregatedMetrics[uniqueKey] = existing
-				} else {
-					memTemp.Value = memValue
-					aggregatedMetrics[uniqueKey] = memTemp
-				}
+			// Aggregate the values if the metric already exists
+			if existing, exists := aggregatedMetrics[uniqueKey]; exists {
+				existing.Value += v.value
+				aggregatedMetrics[uniqueKey] = existing
+			} else {
+				aggregatedMetrics[uniqueKey] = types.MemInstance{Key: v.key, KID: pool.Kid, Pool: pool.Pool, Value: v.value}
 			}
 		}
 	}
 
-	Mems = make([]types.MemInstance, 0, len(aggregatedMetrics))
+	mems := make(types.MemInstances, 0, len(aggregatedMetrics))
 	for _, mem := range aggregatedMetrics {
-		Mems = append(Mems, mem)
+		mems = append(mems, mem)
 	}
 
-	log.Printf("kidType: %s", kidType)
-	// log.Printf("Processed Memory Pools: %+v", Mems)
-	return Mems, err
+	return mems, nil
 }
 
 /*GetServiceTimes fetches service times from squid cache manager */
 func (c *CacheObjectClient) GetServiceTimes() (types.Counters, error) {
-	var serviceTimes types.Counters
-
-	reader, err := c.readFromSquid("service_times")
+	page, err := c.manager().ServiceTimes()
 	if err != nil {
-		return nil, fmt.Errorf("error getting service times: %v", err)
+		c.failures.record(err)
+		return nil, err
 	}
 
-	lines := make(chan string)
-	go readLines(reader, lines)
-
-	for line := range lines {
-		s, err := decodeServiceTimeStrings(line)
-		if err != nil {
-			log.Println(err)
-		} else {
-			if s.Key != "" {
-				serviceTimes = append(serviceTimes, s)
-			}
-		}
+	serviceTimes := make(types.Counters, 0, len(page))
+	for _, s := range page {
+		serviceTimes = append(serviceTimes, types.Counter{Key: s.Key(), Value: s.FiveMin})
 	}
 
-	return serviceTimes, err
+	return serviceTimes, nil
 }
 
 /*GetInfos fetches info from squid cache manager */
 func (c *CacheObjectClient) GetInfos() (types.Counters, error) {
+	info, err := c.manager().Info()
+	if err != nil {
+		c.failures.record(err)
+		return nil, err
+	}
+
 	var infos types.Counters
+	for _, v := range info.Values {
+		infos = append(infos, types.Counter{Key: v.Name, Value: v.Value})
+	}
+	for _, avg := range info.Averages {
+		if !math.IsNaN(avg.FiveMin) {
+			infos = append(infos, types.Counter{Key: avg.Name + "_5min", Value: avg.FiveMin})
+		}
+		if !math.IsNaN(avg.SixtyMin) {
+			infos = append(infos, types.Counter{Key: avg.Name + "_60min", Value: avg.SixtyMin})
+		}
+	}
+
+	infoVarLabels := types.Counter{Key: "squid_info", Value: 1}
+	for _, d := range info.Details {
+		infoVarLabels.VarLabels = append(infoVarLabels.VarLabels, types.VarLabel{Key: d.Name, Value: d.Value})
+	}
+	infos = append(infos, infoVarLabels)
+
+	return infos, nil
+}
 
-	reader, err := c.readFromSquid("info")
+/*GetClientList fetches per client statistics from squid cache manager */
+func (c *CacheObjectClient) GetClientList() (types.ClientInfos, error) {
+	reader, err := c.readFromSquid("client_list")
 	if err != nil {
-		return nil, fmt.Errorf("error getting info: %v", err)
+		return nil, fmt.Errorf("error getting client list: %v", err)
 	}
+	defer reader.Close()
 
-	lines := make(chan string)
-	go readLines(reader, lines)
+	d := &clientListDecoder{}
+	if err := scanPage(reader, d); err != nil {
+		err = &squidmgr.ReadError{Page: "client_list", Err: err}
+		c.failures.record(err)
+		return nil, err
+	}
 
-	var infoVarLabels types.Counter
-	infoVarLabels.Key = "squid_info"
-	infoVarLabels.Value = 1
+	return d.finish(), nil
+}
 
-	for line := range lines {
-		dis, err := decodeInfoStrings(line)
-		if err != nil {
-			log.Println(err)
-		} else {
-			if len(dis.VarLabels) > 0 {
-				if dis.VarLabels[0].Key == "5min" {
-					var infoAvg5 types.Counter
-					var infoAvg60 types.Counter
-
-					infoAvg5.Key = dis.Key + "_" + dis.VarLabels[0].Key
-					infoAvg60.Key = dis.Key + "_" + dis.VarLabels[1].Key
-
-					if value, err := strconv.ParseFloat(dis.VarLabels[0].Value, 64); err == nil {
-						infoAvg5.Value = value
-						infos = append(infos, infoAvg5)
-					}
-					if value, err := strconv.ParseFloat(dis.VarLabels[1].Value, 64); err == nil {
-						infoAvg60.Value = value
-						infos = append(infos, infoAvg60)
-					}
-
-				} else {
-					infoVarLabels.VarLabels = append(infoVarLabels.VarLabels, dis.VarLabels[0])
-				}
-			} else if dis.Key != "" {
-				infos = append(infos, dis)
-			}
+/*GetDelayPools fetches delay pools state from squid cache manager */
+func (c *CacheObjectClient) GetDelayPools() (types.DelayPools, error) {
+	reader, err := c.readFromSquid("delay")
+	if err != nil {
+		return nil, fmt.Errorf("error getting delay pools: %v", err)
+	}
+	defer reader.Close()
+
+	d := &delayPoolsDecoder{}
+	if err := scanPage(reader, d); err != nil {
+		err = &squidmgr.ReadError{Page: "delay", Err: err}
+		c.failures.record(err)
+		return nil, err
+	}
+
+	return d.finish(), nil
+}
+
+/*GetEvents fetches the scheduled internal events from squid cache manager */
+func (c *CacheObjectClient) GetEvents() (types.EventQueue, error) {
+	reader, err := c.readFromSquid("events")
+	if err != nil {
+		return types.EventQueue{}, fmt.Errorf("error getting events: %v", err)
+	}
+	defer reader.Close()
+
+	d := &eventsDecoder{}
+	if err := scanPage(reader, d); err != nil {
+		err = &squidmgr.ReadError{Page: "events", Err: err}
+		c.failures.record(err)
+		return types.EventQueue{}, err
+	}
+
+	return d.finish(), nil
+}
+
+/*GetHelperStats fetches the statistics of the helper reported on page, e.g. sslcrtd_program */
+func (c *CacheObjectClient) GetHelperStats(page string) (types.HelperStats, error) {
+	reader, err := c.readFromSquid(page)
+	if err != nil {
+		return types.HelperStats{}, fmt.Errorf("error getting %s helper stats: %v", page, err)
+	}
+	defer reader.Close()
+
+	d := &helperStatsDecoder{flagsColumn: -1}
+	if err := scanPage(reader, d); err != nil {
+		err = &squidmgr.ReadError{Page: page, Err: err}
+		c.failures.record(err)
+		return types.HelperStats{}, err
+	}
+
+	return d.finish(), nil
+}
+
+/*GetAdaptationServices fetches the adaptation service state reported on page */
+func (c *CacheObjectClient) GetAdaptationServices(page string) (types.AdaptationServices, error) {
+	reader, err := c.readFromSquid(page)
+	if err != nil {
+		return nil, fmt.Errorf("error getting adaptation services: %v", err)
+	}
+	defer reader.Close()
+
+	d := &adaptationDecoder{}
+	if err := scanPage(reader, d); err != nil {
+		err = &squidmgr.ReadError{Page: page, Err: err}
+		c.failures.record(err)
+		return nil, err
+	}
+
+	return d.finish(), nil
+}
+
+// countersDecoder decodes a manager page that needs state across lines into counters
+type countersDecoder interface {
+	lineDecoder
+	finish() types.Counters
+}
+
+func (c *CacheObjectClient) getPageCounters(page string, d countersDecoder) (types.Counters, error) {
+	reader, err := c.readFromSquid(page)
+	if err != nil {
+		return nil, fmt.Errorf("error getting %s: %v", page, err)
+	}
+	defer reader.Close()
+
+	if err := scanPage(reader, d); err != nil {
+		err = &squidmgr.ReadError{Page: page, Err: err}
+		c.failures.record(err)
+		return nil, err
+	}
+
+	return d.finish(), nil
+}
+
+/*GetStoreIO fetches store I/O interface statistics from squid cache manager */
+func (c *CacheObjectClient) GetStoreIO() (types.Counters, error) {
+	return c.getPageCounters("store_io", &storeIODecoder{})
+}
+
+/*GetIO fetches the per protocol read statistics from squid cache manager */
+func (c *CacheObjectClient) GetIO() (types.Counters, error) {
+	return c.getPageCounters("io", &ioDecoder{})
+}
+
+/*GetDiskd fetches diskd statistics from squid cache manager */
+func (c *CacheObjectClient) GetDiskd() (types.Counters, error) {
+	return c.getPageCounters("diskd", &diskdDecoder{})
+}
+
+/*GetAIOCounts fetches async I/O counters from squid cache manager */
+func (c *CacheObjectClient) GetAIOCounts() (types.Counters, error) {
+	return c.getPageCounters("squidaio_counts", &aioCountsDecoder{})
+}
+
+/*GetStoreDigest fetches the local cache digest statistics from squid cache manager */
+func (c *CacheObjectClient) GetStoreDigest() (types.Counters, error) {
+	return c.getPageCounters("store_digest", &storeDigestDecoder{})
+}
+
+/*GetRefresh fetches refresh_pattern usage and freshness decisions from squid cache manager */
+func (c *CacheObjectClient) GetRefresh() (types.Counters, error) {
+	return c.getPageCounters("refresh", &refreshDecoder{})
+}
+
+/*GetForward fetches the reply status per number of forwarding attempts from squid cache manager */
+func (c *CacheObjectClient) GetForward() (types.Counters, error) {
+	return c.getPageCounters("forward", &forwardDecoder{})
+}
+
+/*GetHTTPHeaders fetches the header field usage of requests and replies from squid cache manager */
+func (c *CacheObjectClient) GetHTTPHeaders() (types.Counters, error) {
+	return c.getPageCounters("http_headers", &httpHeadersDecoder{})
+}
+
+/*GetHeaderValues fetches the header values counted on page, via_headers or forw_headers */
+func (c *CacheObjectClient) GetHeaderValues(page string) (types.Counters, error) {
+	return c.getPageCounters(page, &headerValuesDecoder{})
+}
+
+/*GetObjects streams the objects listed on page to fn, reading at most maxLines lines, and reports truncation */
+func (c *CacheObjectClient) GetObjects(page string, maxLines int, fn func(types.StoreObject)) (bool, error) {
+	reader, err := c.readFromSquid(page)
+	if err != nil {
+		return false, fmt.Errorf("error getting %s: %v", page, err)
+	}
+	defer reader.Close()
+
+	// The page is bounded by maxLines instead of its size, it lists every object in the cache.
+	scanner := squidmgr.NewPageScanner(reader, 0)
+	d := &objectsDecoder{fn: fn}
+	for n := 0; scanner.Scan(); n++ {
+		if maxLines > 0 && n >= maxLines {
+			// The last object is incomplete, so it is dropped.
+			return true, nil
+		}
+
+		if err := squidmgr.ParseLine(scanner.Text(), d.decode); err != nil {
+			err = &squidmgr.ReadError{Page: page, Err: err}
+			c.failures.record(err)
+			return false, err
 		}
 	}
-	infos = append(infos, infoVarLabels)
-	// log.Printf("hey: %s", infos)
-	return infos, err
+	if err := scanner.Err(); err != nil {
+		err = &squidmgr.ReadError{Page: page, Err: err}
+		c.failures.record(err)
+		return false, err
+	}
+
+	d.finish()
+	return false, nil
 }
 
 func (ch *connectionHandlerImpl) connect() (net.Conn, error) {
-	return net.Dial("tcp", fmt.Sprintf("%s:%d", ch.hostname, ch.port))
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ch.hostname, strconv.Itoa(ch.port)), timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ch.proxyHeader) > 0 {
+		if _, err := conn.Write(ch.proxyHeader); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
 }
 
-func get(conn net.Conn, path string, basicAuthString string, headers []string) (*http.Response, error) {
-	rBody := append(headers, []string{
-		fmt.Sprintf(requestProtocol, path),
+// buildRequest builds the cache manager request for path, keep-alive requests use HTTP/1.1
+func buildRequest(path string, basicAuthString string, headers []string, keepAlive bool) string {
+	protocol := requestProtocol
+	if keepAlive {
+		protocol = requestProtocolKeepAlive
+	}
+
+	rBody := append(append([]string{}, headers...), []string{
+		fmt.Sprintf(protocol, path),
 		"Host: localhost",
 		"User-Agent: squidclient/3.5.12",
 	}...)
@@ -342,248 +583,858 @@ func get(conn net.Conn, path string, basicAuthString string, headers []string) (
 		rBody = append(rBody, "Proxy-Authorization: Basic "+basicAuthString)
 		rBody = append(rBody, "Authorization: Basic "+basicAuthString)
 	}
+	if keepAlive {
+		rBody = append(rBody, "Connection: keep-alive")
+	}
 	rBody = append(rBody, "Accept: */*", "\r\n")
-	request := strings.Join(rBody, "\r\n")
 
-	fmt.Fprint(conn, request)
+	return strings.Join(rBody, "\r\n")
+}
 
-	return http.ReadResponse(bufio.NewReader(conn), nil)
+// clientListDecoder keeps track of the client and section being parsed, since
+// client_list entries span multiple lines.
+type clientListDecoder struct {
+	clients types.ClientInfos
+	current *types.ClientInfo
+	results map[string]float64
 }
 
-func decodeCounterStrings(line string) (types.Counter, error) {
-	if equal := strings.Index(line, "="); equal >= 0 {
-		if key := strings.TrimSpace(line[:equal]); len(key) > 0 {
-			value := ""
-			if len(line) > equal {
-				value = strings.TrimSpace(line[equal+1:])
-			}
+func (d *clientListDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case strings.HasPrefix(trimmed, "Address:"):
+		d.flush()
+		d.current = &types.ClientInfo{
+			Address:     strings.TrimSpace(strings.TrimPrefix(trimmed, "Address:")),
+			ICPResults:  map[string]float64{},
+			HTTPResults: map[string]float64{},
+		}
+		d.results = nil
+	case d.current == nil:
+		// Headers and the TOTALS section are not bound to a client.
+	case trimmed == "":
+		d.flush()
+	case strings.HasPrefix(trimmed, "Name:"):
+		d.current.Name = strings.TrimSpace(strings.TrimPrefix(trimmed, "Name:"))
+	case strings.HasPrefix(trimmed, "Currently established connections:"):
+		d.current.Connections = parseLastField(trimmed)
+	case strings.HasPrefix(trimmed, "ICP ") && strings.Contains(trimmed, "Requests"):
+		d.current.ICPRequests = parseLastField(trimmed)
+		d.results = d.current.ICPResults
+	case strings.HasPrefix(trimmed, "HTTP ") && strings.Contains(trimmed, "Requests"):
+		d.current.HTTPRequests = parseLastField(trimmed)
+		d.results = d.current.HTTPResults
+	default:
+		fields := strings.Fields(trimmed)
+		if d.results == nil || len(fields) < 2 {
+			log.Println("client list - could not parse line: " + line)
+			return
+		}
+		if value, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			d.results[fields[0]] = value
+		}
+	}
+}
+
+func (d *clientListDecoder) flush() {
+	if d.current != nil {
+		d.clients = append(d.clients, *d.current)
+		d.current = nil
+		d.results = nil
+	}
+}
+
+func (d *clientListDecoder) finish() types.ClientInfos {
+	d.flush()
+	return d.clients
+}
 
-			// Remove additional formating string from `sample_time`
-			if slices := strings.Split(value, " "); len(slices) > 0 {
-				value = slices[0]
+func parseLastField(line string) float64 {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return 0
+	}
+
+	value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+// delayPoolsDecoder keeps track of the pool and bucket type being parsed
+type delayPoolsDecoder struct {
+	pools   types.DelayPools
+	pool    string
+	class   string
+	current *types.DelayPoolBucket
+}
+
+func (d *delayPoolsDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case trimmed == "" || strings.HasPrefix(trimmed, "Delay pools configured:"):
+	case strings.HasPrefix(trimmed, "Pool:"):
+		d.flush()
+		d.pool = strings.TrimSpace(strings.TrimPrefix(trimmed, "Pool:"))
+		d.class = ""
+	case strings.HasPrefix(trimmed, "Class:"):
+		d.class = strings.TrimSpace(strings.TrimPrefix(trimmed, "Class:"))
+	case d.pool == "":
+		log.Println("delay pools - could not parse line: " + line)
+	case strings.HasSuffix(trimmed, ":") && !strings.Contains(trimmed, " "):
+		d.flush()
+		d.current = &types.DelayPoolBucket{
+			Pool:  d.pool,
+			Class: d.class,
+			Type:  strings.ToLower(strings.TrimSuffix(trimmed, ":")),
+		}
+	case d.current == nil:
+		log.Println("delay pools - could not parse line: " + line)
+	case trimmed == "Disabled.":
+		d.current.Disabled = true
+	case strings.HasPrefix(trimmed, "Max:"):
+		d.current.Max = parseLastField(trimmed)
+	case strings.HasPrefix(trimmed, "Restore:"):
+		d.current.Restore = parseLastField(trimmed)
+	case strings.HasPrefix(trimmed, "Current"):
+		d.decodeCurrent(trimmed)
+	default:
+		log.Println("delay pools - could not parse line: " + line)
+	}
+}
+
+// decodeCurrent parses bucket levels like "Current: 8000" for aggregates or
+// "Current [Network 1]: 2:4000 3:3500" for per network and per host buckets.
+func (d *delayPoolsDecoder) decodeCurrent(line string) {
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		return
+	}
+
+	prefix := ""
+	if start := strings.Index(line[:idx], "["); start >= 0 {
+		if end := strings.Index(line[start:idx], "]"); end >= 0 {
+			// "Network 1" becomes "1/", "All networks" is dropped
+			fields := strings.Fields(line[start+1 : start+end])
+			if len(fields) > 0 {
+				if _, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+					prefix = fields[len(fields)-1] + "/"
+				}
 			}
+		}
+	}
+
+	for _, field := range strings.Fields(line[idx+1:]) {
+		id, value := "", field
+		if sep := strings.Index(field, ":"); sep >= 0 {
+			id, value = prefix+field[:sep], field[sep+1:]
+		}
+
+		if level, err := strconv.ParseFloat(value, 64); err == nil {
+			d.current.Current = append(d.current.Current, types.DelayBucket{ID: id, Level: level})
+		}
+	}
+}
+
+func (d *delayPoolsDecoder) flush() {
+	if d.current != nil {
+		d.pools = append(d.pools, *d.current)
+		d.current = nil
+	}
+}
+
+func (d *delayPoolsDecoder) finish() types.DelayPools {
+	d.flush()
+	return d.pools
+}
+
+// helperStatsDecoder sums helper statistics, in SMP mode every kid reports
+// its own helpers on the same page.
+type helperStatsDecoder struct {
+	stats        types.HelperStats
+	serviceTimes int
+	flagsColumn  int
+}
+
+func (d *helperStatsDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
 
-			if i, err := strconv.ParseFloat(value, 64); err == nil {
-				return types.Counter{Key: key, Value: i}, nil
+	switch {
+	case strings.HasPrefix(trimmed, "program:"):
+		if d.stats.Program == "" {
+			d.stats.Program = strings.TrimSpace(strings.TrimPrefix(trimmed, "program:"))
+		}
+	case strings.HasPrefix(trimmed, "number active:"):
+		// number active: 5 of 10 (0 shutting down)
+		fields := strings.FieldsFunc(strings.TrimPrefix(trimmed, "number active:"), func(r rune) bool {
+			return unicode.IsSpace(r) || r == '(' || r == ')'
+		})
+		if len(fields) >= 4 {
+			d.stats.Active += parseFloat(fields[0])
+			d.stats.Max += parseFloat(fields[2])
+			d.stats.ShuttingDown += parseFloat(fields[3])
+		}
+	case strings.HasPrefix(trimmed, "requests sent:"):
+		d.stats.Requests += parseLastField(trimmed)
+	case strings.HasPrefix(trimmed, "replies received:"):
+		d.stats.Replies += parseLastField(trimmed)
+	case strings.HasPrefix(trimmed, "requests timedout:"):
+		d.stats.TimedOut += parseLastField(trimmed)
+	case strings.HasPrefix(trimmed, "queue length:"):
+		d.stats.QueueLength += parseLastField(trimmed)
+	case strings.HasPrefix(trimmed, "avg service time:"):
+		// avg service time: 12 msec
+		if fields := strings.Fields(trimmed); len(fields) >= 4 {
+			d.stats.AvgServiceTime += parseFloat(fields[3])
+			d.serviceTimes++
+		}
+	case strings.HasPrefix(trimmed, "ID #"):
+		d.flagsColumn = -1
+		for i, column := range strings.Split(trimmed, "\t") {
+			if strings.TrimSpace(column) == "Flags" {
+				d.flagsColumn = i
 			}
 		}
+	case d.flagsColumn >= 0 && len(trimmed) > 0 && unicode.IsDigit(rune(trimmed[0])):
+		columns := strings.Split(trimmed, "\t")
+		if d.flagsColumn < len(columns) && strings.Contains(columns[d.flagsColumn], "B") {
+			d.stats.Busy++
+		}
+	}
+}
+
+func (d *helperStatsDecoder) finish() types.HelperStats {
+	if d.serviceTimes > 0 {
+		d.stats.AvgServiceTime /= float64(d.serviceTimes)
 	}
 
-	return types.Counter{}, errors.New("counter - could not parse line: " + line)
+	return d.stats
 }
 
-func decodeMemStrings(line string) (types.Counter, error) {
-	// Skip non-metric lines (e.g., headers, summary text)
-	if strings.Contains(line, "Obj Size") {
-		kidId = kidId + 1
-		kidType = "kid" + strconv.Itoa(kidId)
+func parseFloat(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
 	}
 
-	if strings.HasSuffix(line, ":\n") || strings.HasPrefix(line, "by kid") || strings.HasPrefix(line, "Total Pools") || strings.HasPrefix(line, "Cumulative") {
-		return types.Counter{}, nil
+	return f
+}
+
+// adaptationDecoder parses service lines like
+// "reqmod icap://127.0.0.1:1344/reqmod [up,fetch,fail2]" followed by
+// optional "key: value" detail lines of that service.
+type adaptationDecoder struct {
+	services types.AdaptationServices
+	current  *types.AdaptationService
+}
+
+func (d *adaptationDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	if adaptationServiceLine(trimmed) {
+		d.flush()
+		d.current = decodeAdaptationService(trimmed)
+		return
 	}
 
-	// For table-style data rows
-	fields := strings.Fields(line)
-	if len(fields) >= 18 {
-		// The first field is typically the key
-		log.Printf("%d", len(fields))
-		j := 0
-		for i := 0; i < len(fields); i++ {
-			log.Printf(" %s", fields[i])
-			if j == 0 && len(fields[i]) > 0 && unicode.IsDigit(rune(fields[i][0])) {
-				j = i
-			}
+	if d.current == nil || trimmed == "" {
+		return
+	}
+
+	idx := strings.Index(trimmed, ":")
+	if idx < 0 {
+		return
+	}
+
+	key := strings.ToLower(strings.TrimSpace(trimmed[:idx]))
+	value := strings.TrimSpace(trimmed[idx+1:])
+
+	switch {
+	case strings.HasPrefix(value, "["):
+		applyAdaptationFlags(d.current, value)
+	case strings.Contains(key, "connections"):
+		if fields := strings.Fields(value); len(fields) > 0 {
+			d.current.Connections += parseFloat(fields[0])
+		}
+	}
+}
+
+// adaptationServiceLine tells service lines apart from detail lines, the URI
+// of a service line is not preceded by a "key:" like in "uri: icap://..."
+func adaptationServiceLine(line string) bool {
+	idx := strings.Index(line, ":")
+	return idx >= 0 && strings.HasPrefix(line[idx:], "://")
+}
+
+func decodeAdaptationService(line string) *types.AdaptationService {
+	s := &types.AdaptationService{OptionsValid: true}
+
+	if start := strings.Index(line, "["); start >= 0 {
+		applyAdaptationFlags(s, line[start:])
+		line = line[:start]
+	}
+
+	for _, field := range strings.Fields(line) {
+		switch {
+		case strings.Contains(field, "://"):
+			s.URI = field
+		case s.Name == "" && !strings.HasSuffix(field, ":"):
+			s.Name = field
 		}
-		log.Printf("%d", j)
+	}
 
-		var key string
-		if j == 1 {
-			key = fields[0]
-		} else if j == 2 {
-			key = fields[0] + "_" + fields[1]
-		} else {
-			key = fields[0] + "_" + fields[1]
+	if s.Name == "" {
+		s.Name = s.URI
+	}
+
+	return s
+}
+
+// applyAdaptationFlags decodes the service status squid prints as e.g. "[down,susp,!opt,fail5]"
+func applyAdaptationFlags(s *types.AdaptationService, status string) {
+	status = strings.Trim(strings.TrimSpace(status), "[]")
+
+	for _, flag := range strings.Split(status, ",") {
+		flag = strings.TrimSpace(flag)
+
+		switch {
+		case flag == "up":
+			s.Up = true
+		case flag == "down":
+			s.Up = false
+		case flag == "susp":
+			s.Suspended = true
+		case flag == "!opt" || flag == "!valid" || flag == "stale":
+			s.OptionsValid = false
+		case flag == "fetch":
+			s.Fetching = true
+		case strings.HasPrefix(flag, "fail"):
+			s.Failures = parseFloat(strings.TrimPrefix(flag, "fail"))
 		}
+	}
+}
+
+func (d *adaptationDecoder) flush() {
+	if d.current != nil {
+		d.services = append(d.services, *d.current)
+		d.current = nil
+	}
+}
+
+func (d *adaptationDecoder) finish() types.AdaptationServices {
+	d.flush()
+	return d.services
+}
+
+// storeIODecoder parses "create.calls 123" lines of the store_io page
+type storeIODecoder struct {
+	counters types.Counters
+}
+
+func (d *storeIODecoder) decode(line string) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return
+	}
+
+	if value, err := strconv.ParseFloat(fields[1], 64); err == nil {
+		d.counters = append(d.counters, types.Counter{Key: fields[0], Value: value})
+	}
+}
 
-		var memCounter types.Counter
-		var memVarLabel types.VarLabel
+func (d *storeIODecoder) finish() types.Counters {
+	return d.counters
+}
 
-		memVarLabel.Key = "obj_size_bytes"
-		memVarLabel.Value = fields[1+j-1]
-		memCounter.VarLabels = append(memCounter.VarLabels, memVarLabel)
+// ioDecoder parses the io page, which reports the number of reads and a read
+// size histogram for each protocol:
+//
+//	HTTP I/O
+//	number of reads: 1234
+//	Read Histogram:
+//	    1-    1:      0   0%
+type ioDecoder struct {
+	counters types.Counters
+	protocol string
+}
 
-		memVarLabel.Key = "chunks_kb_per_chunk"
-		memVarLabel.Value = fields[3+j-1]
-		memCounter.VarLabels = append(memCounter.VarLabels, memVarLabel)
+func (d *ioDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case strings.HasSuffix(trimmed, " I/O"):
+		d.protocol = strings.ToLower(strings.TrimSuffix(trimmed, " I/O"))
+	case d.protocol == "":
+	case strings.HasPrefix(trimmed, "number of reads:"):
+		d.counters = append(d.counters, types.Counter{
+			Key:       "reads",
+			Value:     parseLastField(trimmed),
+			VarLabels: []types.VarLabel{{Key: "protocol", Value: d.protocol}},
+		})
+	default:
+		// "    3-    4:      1   0%"
+		idx := strings.Index(trimmed, ":")
+		if idx < 0 || !strings.Contains(trimmed[:idx], "-") {
+			return
+		}
+		bounds := strings.Split(trimmed[:idx], "-")
+		fields := strings.Fields(trimmed[idx+1:])
+		if len(bounds) != 2 || len(fields) == 0 {
+			return
+		}
 
-		memVarLabel.Key = "objs_per_chunk"
-		memVarLabel.Value = fields[2+j-1]
-		memCounter.VarLabels = append(memCounter.VarLabels, memVarLabel)
+		if value, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			d.counters = append(d.counters, types.Counter{
+				Key:   "reads_by_size",
+				Value: value,
+				VarLabels: []types.VarLabel{
+					{Key: "protocol", Value: d.protocol},
+					{Key: "size", Value: strings.TrimSpace(bounds[0]) + "-" + strings.TrimSpace(bounds[1])},
+				},
+			})
+		}
+	}
+}
 
-		memVarLabel.Key = "alloc_bytes"
-		memVarLabel.Value = fields[3+j-1]
-		memCounter.VarLabels = append(memCounter.VarLabels, memVarLabel)
+func (d *ioDecoder) finish() types.Counters {
+	return d.counters
+}
 
-		memVarLabel.Key = "inuse_bytes"
-		memVarLabel.Value = fields[8+j-1]
-		memCounter.VarLabels = append(memCounter.VarLabels, memVarLabel)
+// diskdDecoder parses the "key: value" lines and the operations table of the diskd page
+type diskdDecoder struct {
+	counters types.Counters
+}
 
-		memVarLabel.Key = "idle_bytes"
-		memVarLabel.Value = fields[13+j-1]
-		memCounter.VarLabels = append(memCounter.VarLabels, memVarLabel)
+func (d *diskdDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
 
-		memVarLabel.Key = "fragmentation_pct"
-		memoryInUse, err := strconv.ParseFloat(fields[8+j-1], 64)
-		if err != nil {
-			memoryInUse = 0
+	if idx := strings.Index(trimmed, ":"); idx >= 0 {
+		if value, err := strconv.ParseFloat(strings.TrimSpace(trimmed[idx+1:]), 64); err == nil {
+			d.counters = append(d.counters, types.Counter{Key: strings.TrimSpace(trimmed[:idx]), Value: value})
 		}
-		memoryAllocated, err := strconv.ParseFloat(fields[3+j-1], 64)
-		if err != nil {
-			memoryAllocated = 1
+		return
+	}
+
+	// "   open      123       123       0" rows of the OPS SUCCESS FAIL table
+	fields := strings.Fields(trimmed)
+	if len(fields) != 4 || fields[0] == "OPS" {
+		return
+	}
+
+	operation := []types.VarLabel{{Key: "operation", Value: fields[0]}}
+	for i, key := range []string{"ops", "success", "fail"} {
+		if value, err := strconv.ParseFloat(fields[i+1], 64); err == nil {
+			d.counters = append(d.counters, types.Counter{Key: key, Value: value, VarLabels: operation})
+		}
+	}
+}
+
+func (d *diskdDecoder) finish() types.Counters {
+	return d.counters
+}
+
+// aioCountsDecoder parses the "operation\trequests\tserviced" rows of the squidaio_counts page
+type aioCountsDecoder struct {
+	counters types.Counters
+	done     bool
+}
+
+func (d *aioCountsDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	// The thread table following the counters is not exported.
+	if d.done || strings.HasPrefix(trimmed, "Thread Status") {
+		d.done = true
+		return
+	}
+
+	fields := strings.Split(trimmed, "\t")
+	if len(fields) != 3 {
+		return
+	}
+
+	requests, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil {
+		return
+	}
+
+	switch operation := strings.TrimSpace(fields[0]); operation {
+	case "queue", "check_callback":
+		d.counters = append(d.counters, types.Counter{Key: operation, Value: requests})
+	default:
+		labels := []types.VarLabel{{Key: "operation", Value: operation}}
+		d.counters = append(d.counters, types.Counter{Key: "requests", Value: requests, VarLabels: labels})
+
+		if serviced, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64); err == nil {
+			d.counters = append(d.counters, types.Counter{Key: "serviced", Value: serviced, VarLabels: labels})
 		}
-		fragmentationPercentage := (1 - (1.0 * memoryInUse / memoryAllocated)) * 100
-		strValue := fmt.Sprintf("%.1f", fragmentationPercentage)
-		memVarLabel.Value = strValue
-		memCounter.VarLabels = append(memCounter.VarLabels, memVarLabel)
+	}
+}
+
+func (d *aioCountsDecoder) finish() types.Counters {
+	return d.counters
+}
 
-		memVarLabel.Key = "allocation_rate_per_sec"
-		memVarLabel.Value = fields[18+j-1]
-		memCounter.VarLabels = append(memCounter.VarLabels, memVarLabel)
+// objectsDecoder parses the store entries of the objects and vm_objects pages:
+//
+//	KEY 6F2B3BD39B9D9D1D0B7C2A4A1D3C1F1E
+//		STORE_OK      IN_MEMORY     SWAPOUT_DONE PING_NONE
+//		LV:1700000000 LU:1700000100 LM:1699990000 EX:-1
+//		inmem_hi: 1234
+type objectsDecoder struct {
+	fn      func(types.StoreObject)
+	current *types.StoreObject
+}
 
-		// The last field or a specific column contains the value
-		value := fields[len(fields)-1]
-		if numericValue, err := strconv.ParseFloat(value, 64); err == nil {
-			return types.Counter{Key: key, Value: numericValue, VarLabels: memCounter.VarLabels}, nil
+func (d *objectsDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case strings.HasPrefix(trimmed, "KEY "):
+		d.finish()
+		d.current = &types.StoreObject{}
+	case d.current == nil:
+	case strings.HasPrefix(trimmed, "STORE_"):
+		fields := strings.Fields(trimmed)
+		if len(fields) >= 3 {
+			d.current.StoreStatus, d.current.MemStatus, d.current.SwapStatus = fields[0], fields[1], fields[2]
 		}
+	case strings.HasPrefix(trimmed, "LV:"):
+		fields := strings.Fields(trimmed)
+		d.current.Timestamp = parseFloat(strings.TrimPrefix(fields[0], "LV:"))
+	case strings.HasPrefix(trimmed, "inmem_hi:"):
+		d.current.Size = parseLastField(trimmed)
 	}
+}
 
-	// Return an error if parsing fails
-	return types.Counter{}, errors.New("decodeMemStrings - could not parse line: " + line)
+func (d *objectsDecoder) finish() {
+	if d.current != nil {
+		d.fn(*d.current)
+		d.current = nil
+	}
 }
 
-func decodeServiceTimeStrings(line string) (types.Counter, error) {
-	if strings.HasSuffix(line, ":\n") { // A header line isn't a metric
-		return types.Counter{}, nil
+// storeDigestDecoder parses the store_digest page:
+//
+//	store digest: size: 128 bytes
+//		 entries: count: 100 capacity: 204 util: 49%
+//		 deletion attempts: 3
+//		 bits: per entry: 5 on: 300 capacity: 1024 util: 29%
+//		 bit-seq: count: 250 avg.len: 4.10
+//		 added: 120 rejected: 10 ( 7.69 %) del-ed: 3
+type storeDigestDecoder struct {
+	counters types.Counters
+	seen     bool
+}
+
+func (d *storeDigestDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	var section string
+	switch {
+	case strings.HasPrefix(trimmed, "store digest: disabled"):
+		d.seen = true
+		d.counters = append(d.counters, types.Counter{Key: "enabled", Value: 0})
+		return
+	case strings.HasPrefix(trimmed, "store digest:"):
+		d.seen = true
+		d.counters = append(d.counters, types.Counter{Key: "enabled", Value: 1})
+		section, trimmed = "", strings.TrimPrefix(trimmed, "store digest:")
+	case !d.seen:
+		return
+	case strings.HasPrefix(trimmed, "entries:"), strings.HasPrefix(trimmed, "bits:"), strings.HasPrefix(trimmed, "bit-seq:"):
+		idx := strings.Index(trimmed, ":")
+		section, trimmed = trimmed[:idx]+"_", trimmed[idx+1:]
 	}
-	if equal := strings.Index(line, ":"); equal >= 0 {
-		if key := strings.TrimSpace(line[:equal]); len(key) > 0 {
-			value := ""
-			if len(line) > equal {
-				value = strings.TrimSpace(line[equal+1:])
-			}
-			key = strings.Replace(key, " ", "_", -1)
-			key = strings.Replace(key, "(", "", -1)
-			key = strings.Replace(key, ")", "", -1)
-
-			if equalTwo := strings.Index(value, "%"); equalTwo >= 0 {
-				if keyTwo := strings.TrimSpace(value[:equalTwo]); len(keyTwo) > 0 {
-					if len(value) > equalTwo {
-						value = strings.Split(strings.TrimSpace(value[equalTwo+1:]), " ")[0]
-					}
-					key = key + "_" + keyTwo
-				}
-			}
 
-			if value, err := strconv.ParseFloat(value, 64); err == nil {
-				return types.Counter{Key: key, Value: value}, nil
+	// The rest of the line is made of "name: value" pairs, names may span multiple words.
+	var name []string
+	fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ", "%", " ").Replace(trimmed))
+	for _, field := range fields {
+		if strings.HasSuffix(field, ":") {
+			name = append(name, strings.TrimSuffix(field, ":"))
+			continue
+		}
+
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			if len(name) == 0 || name[len(name)-1] != field {
+				name = append(name, field)
 			}
+			continue
 		}
+
+		if len(name) > 0 {
+			key := section + strings.Join(name, "_")
+			d.counters = append(d.counters, types.Counter{Key: key, Value: value})
+		}
+		name = nil
 	}
+}
 
-	return types.Counter{}, errors.New("service times - could not parse line: " + line)
+func (d *storeDigestDecoder) finish() types.Counters {
+	return d.counters
 }
 
-func decodeInfoStrings(line string) (types.Counter, error) {
-	if strings.HasSuffix(line, ":\n") { // A header line isn't a metric
-		return types.Counter{}, nil
+// refreshDecoder parses the refresh page:
+//
+//	Refresh Rules:
+//		^ftp:
+//			12 correct matches out of 40 checks
+//
+//	RefreshCheck calls per protocol
+//
+//	Protocol	#Calls	%Calls
+//	      HTTP	   100	 80.00
+//
+//	HTTP histogram:
+//	Count	%Total	Category
+//	    12	 12.00	Fresh: expires time not reached
+type refreshDecoder struct {
+	counters types.Counters
+	section  string
+	index    int
+	pattern  string
+	protocol string
+}
+
+func (d *refreshDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case trimmed == "":
+		return
+	case trimmed == "Refresh Rules:":
+		d.section = "rules"
+		return
+	case strings.HasPrefix(trimmed, "RefreshCheck calls per protocol"):
+		d.section = "calls"
+		return
+	case strings.HasPrefix(trimmed, "RefreshCheck histograms"):
+		d.section = ""
+		return
+	case strings.HasSuffix(trimmed, " histogram:"):
+		d.section = "histogram"
+		d.protocol = strings.ToLower(strings.TrimSuffix(trimmed, " histogram:"))
+		return
 	}
 
-	if idx := strings.Index(line, ":"); idx >= 0 { // detect if line contain metric format like "metricName: value"
-		if key := strings.TrimSpace(line[:idx]); len(key) > 0 {
-			value := ""
-			if len(line) > idx {
-				value = strings.TrimSpace(line[idx+1:])
+	switch d.section {
+	case "rules":
+		var matches, checks float64
+		if _, err := fmt.Sscanf(trimmed, "%g correct matches out of %g checks", &matches, &checks); err == nil {
+			if d.pattern == "" {
+				return
 			}
-			key = strings.Replace(key, " ", "_", -1)
-			key = strings.Replace(key, "(", "", -1)
-			key = strings.Replace(key, ")", "", -1)
-			key = strings.Replace(key, ",", "", -1)
-			key = strings.Replace(key, "/", "", -1)
-
-			// metrics with value as string need to save as label, format like "Squid Object Cache: Version 6.1" (the 3 first metrics)
-			if key == "Squid_Object_Cache" || key == "Build_Info" || key == "Service_Name" {
-				if key == "Squid_Object_Cache" { // To clarify that the value is the squid version.
-					key = key + "_Version"
-					if slices := strings.Split(value, " "); len(slices) > 0 {
-						value = slices[1]
-					}
-				}
-				var infoVarLabel types.VarLabel
-				infoVarLabel.Key = key
-				infoVarLabel.Value = value
-
-				var infoCounter types.Counter
-				infoCounter.Key = key
-				infoCounter.VarLabels = append(infoCounter.VarLabels, infoVarLabel)
-				return infoCounter, nil
-			} else if key == "Start_Time" || key == "Current_Time" { // discart this metrics
-				return types.Counter{}, nil
+			labels := []types.VarLabel{
+				{Key: "index", Value: strconv.Itoa(d.index)},
+				{Key: "pattern", Value: d.pattern},
 			}
+			d.counters = append(d.counters,
+				types.Counter{Key: "matches", Value: matches, VarLabels: labels},
+				types.Counter{Key: "checks", Value: checks, VarLabels: labels})
+			return
+		}
+
+		// Rules are listed in configuration order, the index tells duplicate patterns apart
+		d.index++
+		d.pattern = trimmed
+	case "calls":
+		fields := strings.Fields(trimmed)
+		if len(fields) != 3 {
+			return
+		}
+		if value, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			d.counters = append(d.counters, types.Counter{
+				Key:       "calls",
+				Value:     value,
+				VarLabels: []types.VarLabel{{Key: "protocol", Value: strings.ToLower(fields[0])}},
+			})
+		}
+	case "histogram":
+		fields := strings.SplitN(trimmed, "\t", 3)
+		if len(fields) != 3 {
+			return
+		}
+		// The TOTAL row has no category and is skipped
+		category := strings.SplitN(fields[2], ":", 2)
+		if len(category) != 2 {
+			return
+		}
+		if value, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64); err == nil {
+			d.counters = append(d.counters, types.Counter{
+				Key:   "decisions",
+				Value: value,
+				VarLabels: []types.VarLabel{
+					{Key: "protocol", Value: d.protocol},
+					{Key: "freshness", Value: strings.ToLower(strings.TrimSpace(category[0]))},
+					{Key: "reason", Value: strings.TrimSpace(category[1])},
+				},
+			})
+		}
+	}
+}
 
-			// Remove additional information in value metric
-			if slices := strings.Split(value, " "); len(slices) > 0 {
-				if slices[0] == "5min:" && slices[2] == "60min:" { // catch metrics with avg in 5min and 60min format like "Hits as % of bytes sent: 5min: -0.0%, 60min: -0.0%"
-					var infoAvg5mVarLabel types.VarLabel
-					infoAvg5mVarLabel.Key = slices[0]
-					infoAvg5mVarLabel.Value = slices[1]
+func (d *refreshDecoder) finish() types.Counters {
+	return d.counters
+}
 
-					infoAvg5mVarLabel.Key = strings.Replace(infoAvg5mVarLabel.Key, ":", "", -1)
-					infoAvg5mVarLabel.Value = strings.Replace(infoAvg5mVarLabel.Value, "%", "", -1)
-					infoAvg5mVarLabel.Value = strings.Replace(infoAvg5mVarLabel.Value, ",", "", -1)
+// eventsDecoder parses the events page:
+//
+//	Last event to run: storeDirClean
+//
+//	Operation                	Next Execution 	Weight	Callback Valid?
+//	MaintainSwapSpace        	0.693 sec	    1	 N/A
+type eventsDecoder struct {
+	queue  types.EventQueue
+	header bool
+}
 
-					var infoAvg60mVarLabel types.VarLabel
-					infoAvg60mVarLabel.Key = slices[2]
-					infoAvg60mVarLabel.Value = slices[3]
+func (d *eventsDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case strings.HasPrefix(trimmed, "Last event to run:"):
+		d.queue.LastRun = strings.TrimSpace(strings.TrimPrefix(trimmed, "Last event to run:"))
+	case strings.HasPrefix(trimmed, "Operation"):
+		d.header = true
+	case d.header && trimmed != "":
+		fields := strings.Split(trimmed, "\t")
+		if len(fields) < 3 {
+			return
+		}
 
-					infoAvg60mVarLabel.Key = strings.Replace(infoAvg60mVarLabel.Key, ":", "", -1)
-					infoAvg60mVarLabel.Value = strings.Replace(infoAvg60mVarLabel.Value, "%", "", -1)
-					infoAvg60mVarLabel.Value = strings.Replace(infoAvg60mVarLabel.Value, ",", "", -1)
+		next, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fields[1]), "sec")), 64)
+		if err != nil {
+			return
+		}
 
-					var infoAvgCounter types.Counter
-					infoAvgCounter.Key = key
-					infoAvgCounter.VarLabels = append(infoAvgCounter.VarLabels, infoAvg5mVarLabel, infoAvg60mVarLabel)
+		d.queue.Events = append(d.queue.Events, types.Event{
+			Name:          strings.TrimSpace(fields[0]),
+			NextExecution: next,
+			Weight:        parseFloat(strings.TrimSpace(fields[2])),
+		})
+	}
+}
 
-					return infoAvgCounter, nil
-				} else {
-					value = slices[0]
-				}
+func (d *eventsDecoder) finish() types.EventQueue {
+	return d.queue
+}
 
-			}
+// forwardDecoder parses the forward page. Squid prints one column per number of
+// attempts, starting at zero, while the header only names some of them:
+//
+//	Status	try#1	try#2
+//	200	0	1500	12	0
+type forwardDecoder struct {
+	counters types.Counters
+}
 
-			value = strings.Replace(value, "%", "", -1)
-			value = strings.Replace(value, ",", "", -1)
-			// log.Printf("my output: %s", value)
+func (d *forwardDecoder) decode(line string) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return
+	}
 
-			if i, err := strconv.ParseFloat(value, 64); err == nil {
-				return types.Counter{Key: key, Value: i}, nil
-			}
+	if _, err := strconv.Atoi(fields[0]); err != nil {
+		return
+	}
+
+	for tries, field := range fields[1:] {
+		if value, err := strconv.ParseFloat(field, 64); err == nil {
+			d.counters = append(d.counters, types.Counter{
+				Key:   "attempts",
+				Value: value,
+				VarLabels: []types.VarLabel{
+					{Key: "status", Value: fields[0]},
+					{Key: "tries", Value: strconv.Itoa(tries)},
+				},
+			})
 		}
-	} else {
-		// this catch the last 4 metrics format like "value metricName"
-		lineTrimed := strings.TrimSpace(line[:])
+	}
+}
 
-		if idx := strings.Index(lineTrimed, " "); idx >= 0 {
-			key := strings.TrimSpace(lineTrimed[idx+1:])
-			key = strings.Replace(key, " ", "_", -1)
-			key = strings.Replace(key, "-", "_", -1)
+func (d *forwardDecoder) finish() types.Counters {
+	return d.counters
+}
 
-			value := strings.TrimSpace(lineTrimed[:idx])
+// httpHeadersDecoder parses the field type distribution of each message kind on the http_headers page:
+//
+//	Header Stats: request
+//
+//	Field type distribution
+//	id	 name                	 count	#/header
+//	 0	 Accept              	  1200	  0.80
+type httpHeadersDecoder struct {
+	counters  types.Counters
+	direction string
+	fields    bool
+}
 
-			if i, err := strconv.ParseFloat(value, 64); err == nil {
-				return types.Counter{Key: key, Value: i}, nil
-			}
+func (d *httpHeadersDecoder) decode(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	switch {
+	case strings.HasPrefix(trimmed, "Header Stats:"):
+		d.direction = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(trimmed, "Header Stats:")))
+		d.fields = false
+	case trimmed == "Field type distribution":
+		d.fields = true
+	case trimmed == "":
+		// Sections are separated by empty lines, only the field type distribution is of interest
+		d.fields = false
+	case d.fields && d.direction != "":
+		fields := strings.Split(trimmed, "\t")
+		if len(fields) != 4 {
+			return
+		}
+		if _, err := strconv.Atoi(strings.TrimSpace(fields[0])); err != nil {
+			return
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err != nil {
+			return
 		}
+		d.counters = append(d.counters, types.Counter{
+			Key:   "count",
+			Value: value,
+			VarLabels: []types.VarLabel{
+				{Key: "direction", Value: d.direction},
+				{Key: "header", Value: strings.TrimSpace(fields[1])},
+			},
+		})
 	}
-	return types.Counter{}, errors.New("Info - could not parse line: " + line)
+}
+
+func (d *httpHeadersDecoder) finish() types.Counters {
+	return d.counters
+}
+
+// headerValuesDecoder parses the "<count> <value>" lines of the via_headers and forw_headers pages
+type headerValuesDecoder struct {
+	counters types.Counters
+}
+
+func (d *headerValuesDecoder) decode(line string) {
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if len(fields) != 2 {
+		return
+	}
+
+	if value, err := strconv.ParseFloat(fields[0], 64); err == nil {
+		d.counters = append(d.counters, types.Counter{
+			Key:       "value",
+			Value:     value,
+			VarLabels: []types.VarLabel{{Key: "value", Value: strings.TrimSpace(fields[1])}},
+		})
+	}
+}
+
+func (d *headerValuesDecoder) finish() types.Counters {
+	return d.counters
 }
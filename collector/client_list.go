@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*ClientListConfig configures the client_list collector */
+type ClientListConfig struct {
+	Subnets []string
+	Labels  config.Labels
+}
+
+type clientSubnet struct {
+	name string
+	net  *net.IPNet
+}
+
+/*ClientListCollector exports aggregated client statistics from the client_list page */
+type ClientListCollector struct {
+	*pageStatus
+
+	client  ClientListClient
+	subnets []clientSubnet
+	labels  config.Labels
+
+	clients     *prometheus.Desc
+	connections *prometheus.Desc
+	requests    *prometheus.Desc
+	results     *prometheus.Desc
+}
+
+type clientListTotals struct {
+	clients     float64
+	connections float64
+	requests    map[string]float64
+	results     map[[2]string]float64
+}
+
+/*NewClientListCollector creates a client_list collector, clients are broken down by subnet if any are given */
+func NewClientListCollector(c *ClientListConfig, client ClientListClient) (*ClientListCollector, error) {
+	collector := &ClientListCollector{
+		pageStatus: newPageStatus(c.Labels, "client_list"),
+
+		client: client,
+		labels: c.Labels,
+	}
+
+	for _, s := range c.Subnets {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client list subnet %q: %v", s, err)
+		}
+		collector.subnets = append(collector.subnets, clientSubnet{n.String(), n})
+	}
+
+	var labels []string
+	if len(collector.subnets) > 0 {
+		labels = append(labels, "subnet")
+	}
+	labels = append(labels, c.Labels.Keys...)
+
+	collector.clients = prometheus.NewDesc(prometheus.BuildFQName(namespace, "client_list", "clients"),
+		"Number of distinct clients known to squid", labels, nil)
+	collector.connections = prometheus.NewDesc(prometheus.BuildFQName(namespace, "client_list", "established_connections"),
+		"Number of connections currently established by clients", labels, nil)
+	collector.requests = prometheus.NewDesc(prometheus.BuildFQName(namespace, "client_list", "requests_total"),
+		"Requests made by the clients known to squid", append([]string{"protocol"}, labels...), nil)
+	collector.results = prometheus.NewDesc(prometheus.BuildFQName(namespace, "client_list", "results_total"),
+		"Requests made by the clients known to squid by result code", append([]string{"protocol", "code"}, labels...), nil)
+
+	return collector, nil
+}
+
+// subnetOf returns the first configured subnet containing the client address
+func (c *ClientListCollector) subnetOf(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return otherLabel
+	}
+
+	for _, s := range c.subnets {
+		if s.net.Contains(ip) {
+			return s.name
+		}
+	}
+
+	return otherLabel
+}
+
+func (c *ClientListCollector) aggregate(clients types.ClientInfos) map[string]*clientListTotals {
+	totals := map[string]*clientListTotals{}
+
+	for _, client := range clients {
+		key := ""
+		if len(c.subnets) > 0 {
+			key = c.subnetOf(client.Address)
+		}
+
+		t, ok := totals[key]
+		if !ok {
+			t = &clientListTotals{
+				requests: map[string]float64{},
+				results:  map[[2]string]float64{},
+			}
+			totals[key] = t
+		}
+
+		t.clients++
+		t.connections += client.Connections
+		t.requests["http"] += client.HTTPRequests
+		t.requests["icp"] += client.ICPRequests
+
+		for code, v := range client.HTTPResults {
+			t.results[[2]string{"http", code}] += v
+		}
+		for code, v := range client.ICPResults {
+			t.results[[2]string{"icp", code}] += v
+		}
+	}
+
+	return totals
+}
+
+/*Describe implements prometheus.Collector */
+func (c *ClientListCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.clients
+	ch <- c.connections
+	ch <- c.requests
+	ch <- c.results
+	c.describeStatus(ch)
+}
+
+/*Collect implements prometheus.Collector */
+func (c *ClientListCollector) Collect(ch chan<- prometheus.Metric) {
+	clients, err := c.client.GetClientList()
+	c.collect(ch, "client_list", err)
+	if err != nil {
+		log.Println("Could not fetch client list from squid instance: ", err)
+		return
+	}
+
+	totals := c.aggregate(clients)
+
+	subnets := make([]string, 0, len(totals))
+	for k := range totals {
+		subnets = append(subnets, k)
+	}
+	sort.Strings(subnets)
+
+	for _, subnet := range subnets {
+		t := totals[subnet]
+
+		var labels []string
+		if len(c.subnets) > 0 {
+			labels = append(labels, subnet)
+		}
+		labels = append(labels, c.labels.Values...)
+
+		ch <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, t.clients, labels...)
+		ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, t.connections, labels...)
+
+		for protocol, v := range t.requests {
+			ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, v, append([]string{protocol}, labels...)...)
+		}
+		for k, v := range t.results {
+			ch <- prometheus.MustNewConstMetric(c.results, prometheus.CounterValue, v, append([]string{k[0], k[1]}, labels...)...)
+		}
+	}
+}
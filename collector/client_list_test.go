@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var testClientInfos = types.ClientInfos{
+	{Address: "10.0.0.1", Connections: 2, HTTPRequests: 10, HTTPResults: map[string]float64{"TCP_MISS": 8, "TCP_HIT": 2}},
+	{Address: "10.0.0.2", HTTPRequests: 5, HTTPResults: map[string]float64{"TCP_MISS": 5}},
+	{Address: "192.168.1.5", ICPRequests: 3, ICPResults: map[string]float64{"UDP_HIT": 3}},
+}
+
+func TestClientListCollect(t *testing.T) {
+	c, err := NewClientListCollector(&ClientListConfig{}, &mockClientListClient{clients: testClientInfos})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP squid_client_list_clients Number of distinct clients known to squid
+# TYPE squid_client_list_clients gauge
+squid_client_list_clients 3
+# HELP squid_client_list_results_total Requests made by the clients known to squid by result code
+# TYPE squid_client_list_results_total counter
+squid_client_list_results_total{code="TCP_HIT",protocol="http"} 2
+squid_client_list_results_total{code="TCP_MISS",protocol="http"} 13
+squid_client_list_results_total{code="UDP_HIT",protocol="icp"} 3
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "squid_client_list_clients", "squid_client_list_results_total"))
+}
+
+func TestClientListCollectSubnets(t *testing.T) {
+	c, err := NewClientListCollector(&ClientListConfig{Subnets: []string{"10.0.0.0/24"}}, &mockClientListClient{clients: testClientInfos})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP squid_client_list_requests_total Requests made by the clients known to squid
+# TYPE squid_client_list_requests_total counter
+squid_client_list_requests_total{protocol="http",subnet="10.0.0.0/24"} 15
+squid_client_list_requests_total{protocol="http",subnet="other"} 0
+squid_client_list_requests_total{protocol="icp",subnet="10.0.0.0/24"} 0
+squid_client_list_requests_total{protocol="icp",subnet="other"} 3
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "squid_client_list_requests_total"))
+}
+
+func TestClientListInvalidSubnet(t *testing.T) {
+	_, err := NewClientListCollector(&ClientListConfig{Subnets: []string{"10.0.0.0"}}, nil)
+
+	assert.EqualError(t, err, `invalid client list subnet "10.0.0.0": invalid CIDR address: 10.0.0.0`)
+}
@@ -1,7 +1,9 @@
 package collector
 
 import (
+	"io"
 	"net"
+	"strings"
 	"testing"
 
 	"github.com/boynux/squid-exporter/types"
@@ -44,9 +46,8 @@ func TestReadFromSquid(t *testing.T) {
 	}()
 
 	coc := &CacheObjectClient{
-		ch,
-		"",
-		[]string{},
+		ch:      ch,
+		headers: []string{},
 	}
 	expected := "GET cache_object://localhost/test HTTP/1.0\r\nHost: localhost\r\nUser-Agent: squidclient/3.5.12\r\nAccept: */*\r\n\r\n"
 	coc.readFromSquid("test")
@@ -54,28 +55,111 @@ func TestReadFromSquid(t *testing.T) {
 	assert.Equal(t, expected, string(ch.buffer))
 }
 
-func TestDecodeMetricStrings(t *testing.T) {
-	tests := []struct {
-		s string
-		c types.Counter
-		e string
-		d func(string) (types.Counter, error)
-	}{
-		{"swap.files_cleaned=1", types.Counter{Key: "swap.files_cleaned", Value: 1}, "", decodeCounterStrings},
-		{"client.http_requests=1", types.Counter{Key: "client.http_requests", Value: 1}, "", decodeCounterStrings},
-		{"# test for invalid metric line", types.Counter{}, "counter - could not parse line: # test for invalid metric line", decodeCounterStrings},
-
-		{"	HTTP Requests (All):  70%   10.00000  9.50000\n", types.Counter{Key: "HTTP_Requests_All_70", Value: 10}, "", decodeServiceTimeStrings},
-		{"	Not-Modified Replies:  5%   12.00000  10.00000\n", types.Counter{Key: "Not-Modified_Replies_5", Value: 12}, "", decodeServiceTimeStrings},
-		{"	ICP Queries:          85%   900.00000  1200.00000\n", types.Counter{Key: "ICP_Queries_85", Value: 900}, "", decodeServiceTimeStrings},
+func TestDecodeClientList(t *testing.T) {
+	page := `Cache Clients:
+Address: 192.168.0.10
+Name:    192.168.0.10
+Currently established connections: 2
+    ICP  Requests 0
+    HTTP Requests 12
+        TCP_MISS                   10  83%
+        TCP_HIT                     2  17%
+
+Address: 192.168.0.11
+Name:    host11.example.com
+Currently established connections: 0
+    ICP  Requests 3
+        UDP_HIT                     3 100%
+    HTTP Requests 0
+
+TOTALS
+ICP : 3 Queries, 3 Hits (100%)
+HTTP: 12 Requests, 2 Hits ( 17%)
+`
+	d := &clientListDecoder{}
+	for _, line := range strings.SplitAfter(page, "\n") {
+		d.decode(line)
 	}
 
-	for _, tc := range tests {
-		c, err := tc.d(tc.s)
+	assert.Equal(t, types.ClientInfos{
+		{
+			Address:      "192.168.0.10",
+			Name:         "192.168.0.10",
+			Connections:  2,
+			HTTPRequests: 12,
+			ICPResults:   map[string]float64{},
+			HTTPResults:  map[string]float64{"TCP_MISS": 10, "TCP_HIT": 2},
+		},
+		{
+			Address:     "192.168.0.11",
+			Name:        "host11.example.com",
+			ICPRequests: 3,
+			ICPResults:  map[string]float64{"UDP_HIT": 3},
+			HTTPResults: map[string]float64{},
+		},
+	}, d.finish())
+}
 
-		if tc.e != "" {
-			assert.EqualError(t, err, tc.e)
-		}
-		assert.Equal(t, tc.c, c)
+func TestDecodeHelperStats(t *testing.T) {
+	page := "program: /usr/lib/squid/security_file_certgen\n" +
+		"number active: 5 of 10 (1 shutting down)\n" +
+		"requests sent: 1234\n" +
+		"replies received: 1230\n" +
+		"requests timedout: 4\n" +
+		"queue length: 2\n" +
+		"avg service time: 12 msec\n" +
+		"\n" +
+		"   ID #\t     FD\t    PID\t # Requests\t  # Replies\t# Timed-out\t Flags\t   Time\t Offset\tRequest\n" +
+		"      1\t     15\t  12345\t        600\t        600\t          0\tB     \t  0.004\t      0\t(none)\n" +
+		"      2\t     17\t  12346\t        634\t        630\t          4\t      \t  0.000\t      0\t(none)\n" +
+		"\n" +
+		"Flags key:\n" +
+		"   B\t= BUSY\n"
+
+	d := &helperStatsDecoder{flagsColumn: -1}
+	for _, line := range strings.SplitAfter(page, "\n") {
+		d.decode(line)
 	}
+
+	assert.Equal(t, types.HelperStats{
+		Program:        "/usr/lib/squid/security_file_certgen",
+		Active:         5,
+		Max:            10,
+		ShuttingDown:   1,
+		Requests:       1234,
+		Replies:        1230,
+		TimedOut:       4,
+		QueueLength:    2,
+		AvgServiceTime: 12,
+		Busy:           1,
+	}, d.finish())
+}
+
+func TestConnectWritesProxyHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	header := []byte("PROXY TCP4 192.0.2.1 127.0.0.1 9301 3128\r\n")
+	received := make(chan []byte)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, len(header))
+		_, _ = io.ReadFull(conn, buf)
+		received <- buf
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	ch := &connectionHandlerImpl{hostname: addr.IP.String(), port: addr.Port, proxyHeader: header}
+	conn, err := ch.connect()
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, header, <-received)
 }
@@ -45,6 +45,12 @@ var squidCounters = []squidCounter{
 	{"swap", "ins", "total", "The number of objects read from disk"},
 	{"swap", "outs", "total", "The number of objects saved to disk"},
 	{"swap", "files_cleaned", "total", "The number of orphaned cache files removed by the periodic cleanup procedure"},
+
+	{"cd", "times_used", "total", "The number of times a peer cache digest was used to select a peer"},
+	{"cd", "msgs_sent", "total", "The number of cache digest messages sent to peers"},
+	{"cd", "msgs_recv", "total", "The number of cache digest messages received from peers"},
+	{"cd", "kbytes_sent", "total", "The number of cache digest kbytes sent to peers"},
+	{"cd", "kbytes_recv", "total", "The number of cache digest kbytes received from peers"},
 }
 
 func generateSquidCounters(labels []string) descMap {
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"log"
+	"sort"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*DelayPoolsConfig configures the delay pools collector */
+type DelayPoolsConfig struct {
+	// MaxBuckets caps the number of individual buckets exported per pool and bucket type, 0 disables them
+	MaxBuckets int
+	Labels     config.Labels
+}
+
+/*DelayPoolsCollector exports delay pool bucket levels from the delay page */
+type DelayPoolsCollector struct {
+	*pageStatus
+
+	client     DelayPoolsClient
+	maxBuckets int
+	labels     config.Labels
+
+	max          *prometheus.Desc
+	restore      *prometheus.Desc
+	current      *prometheus.Desc
+	buckets      *prometheus.Desc
+	emptyBuckets *prometheus.Desc
+	bucket       *prometheus.Desc
+}
+
+/*NewDelayPoolsCollector creates a delay pools collector */
+func NewDelayPoolsCollector(c *DelayPoolsConfig, client DelayPoolsClient) *DelayPoolsCollector {
+	labels := append([]string{"pool", "class", "bucket"}, c.Labels.Keys...)
+
+	return &DelayPoolsCollector{
+		pageStatus: newPageStatus(c.Labels, "delay"),
+
+		client:     client,
+		maxBuckets: c.MaxBuckets,
+		labels:     c.Labels,
+
+		max: prometheus.NewDesc(prometheus.BuildFQName(namespace, "delay_pool", "max_bytes"),
+			"Maximum level of the delay pool buckets in bytes", labels, nil),
+		restore: prometheus.NewDesc(prometheus.BuildFQName(namespace, "delay_pool", "restore_bytes_per_second"),
+			"Rate the delay pool buckets are refilled at in bytes per second", labels, nil),
+		current: prometheus.NewDesc(prometheus.BuildFQName(namespace, "delay_pool", "current_bytes"),
+			"Current level of the delay pool buckets in bytes, summed over all buckets of the type", labels, nil),
+		buckets: prometheus.NewDesc(prometheus.BuildFQName(namespace, "delay_pool", "buckets"),
+			"Number of buckets in use", labels, nil),
+		emptyBuckets: prometheus.NewDesc(prometheus.BuildFQName(namespace, "delay_pool", "empty_buckets"),
+			"Number of buckets that are empty, i.e. saturated", labels, nil),
+		bucket: prometheus.NewDesc(prometheus.BuildFQName(namespace, "delay_pool", "bucket_current_bytes"),
+			"Current level of individual delay pool buckets in bytes, lowest levels first",
+			append([]string{"pool", "class", "bucket", "id"}, c.Labels.Keys...), nil),
+	}
+}
+
+/*Describe implements prometheus.Collector */
+func (c *DelayPoolsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.max
+	ch <- c.restore
+	ch <- c.current
+	ch <- c.buckets
+	ch <- c.emptyBuckets
+	ch <- c.bucket
+	c.describeStatus(ch)
+}
+
+/*Collect implements prometheus.Collector */
+func (c *DelayPoolsCollector) Collect(ch chan<- prometheus.Metric) {
+	pools, err := c.client.GetDelayPools()
+	c.collect(ch, "delay", err)
+	if err != nil {
+		log.Println("Could not fetch delay pools from squid instance: ", err)
+		return
+	}
+
+	for _, p := range pools {
+		if p.Disabled {
+			continue
+		}
+
+		labels := append([]string{p.Pool, p.Class, p.Type}, c.labels.Values...)
+
+		var current, empty float64
+		for _, b := range p.Current {
+			current += b.Level
+			if b.Level <= 0 {
+				empty++
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, p.Max, labels...)
+		ch <- prometheus.MustNewConstMetric(c.restore, prometheus.GaugeValue, p.Restore, labels...)
+		ch <- prometheus.MustNewConstMetric(c.current, prometheus.GaugeValue, current, labels...)
+		ch <- prometheus.MustNewConstMetric(c.buckets, prometheus.GaugeValue, float64(len(p.Current)), labels...)
+		ch <- prometheus.MustNewConstMetric(c.emptyBuckets, prometheus.GaugeValue, empty, labels...)
+
+		if c.maxBuckets <= 0 {
+			continue
+		}
+
+		// Sort a copy, the pools belong to the client
+		buckets := append([]types.DelayBucket{}, p.Current...)
+		sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].Level < buckets[j].Level })
+		if len(buckets) > c.maxBuckets {
+			buckets = buckets[:c.maxBuckets]
+		}
+
+		for _, b := range buckets {
+			if b.ID == "" {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(c.bucket, prometheus.GaugeValue, b.Level,
+				append([]string{p.Pool, p.Class, p.Type, b.ID}, c.labels.Values...)...)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDelayPage = `Delay pools configured: 2
+
+Pool: 1
+	Class: 2
+
+	Aggregate:
+		Max: 8000
+		Restore: 1000
+		Current: 7000
+
+	Individual:
+		Max: 4000
+		Restore: 500
+		Current: 2:4000 3:0
+
+Pool: 2
+	Class: 3
+
+	Aggregate:
+		Disabled.
+
+	Network:
+		Max: 16000
+		Restore: 2000
+		Current: 1:16000
+
+	Individual:
+		Max: 4000
+		Restore: 500
+		Current [Network 1]: 7:1000 9:3000
+`
+
+type mockDelayPoolsClient struct {
+	pools types.DelayPools
+	err   error
+}
+
+func (m *mockDelayPoolsClient) GetDelayPools() (types.DelayPools, error) {
+	return m.pools, m.err
+}
+
+func decodeTestDelayPage() types.DelayPools {
+	d := &delayPoolsDecoder{}
+	for _, line := range strings.SplitAfter(testDelayPage, "\n") {
+		d.decode(line)
+	}
+
+	return d.finish()
+}
+
+func TestDecodeDelayPools(t *testing.T) {
+	assert.Equal(t, types.DelayPools{
+		{Pool: "1", Class: "2", Type: "aggregate", Max: 8000, Restore: 1000, Current: []types.DelayBucket{{ID: "", Level: 7000}}},
+		{Pool: "1", Class: "2", Type: "individual", Max: 4000, Restore: 500, Current: []types.DelayBucket{{ID: "2", Level: 4000}, {ID: "3", Level: 0}}},
+		{Pool: "2", Class: "3", Type: "aggregate", Disabled: true},
+		{Pool: "2", Class: "3", Type: "network", Max: 16000, Restore: 2000, Current: []types.DelayBucket{{ID: "1", Level: 16000}}},
+		{Pool: "2", Class: "3", Type: "individual", Max: 4000, Restore: 500, Current: []types.DelayBucket{{ID: "1/7", Level: 1000}, {ID: "1/9", Level: 3000}}},
+	}, decodeTestDelayPage())
+}
+
+func TestDelayPoolsCollect(t *testing.T) {
+	c := NewDelayPoolsCollector(&DelayPoolsConfig{MaxBuckets: 1}, &mockDelayPoolsClient{pools: decodeTestDelayPage()})
+
+	expected := `
+# HELP squid_delay_pool_empty_buckets Number of buckets that are empty, i.e. saturated
+# TYPE squid_delay_pool_empty_buckets gauge
+squid_delay_pool_empty_buckets{bucket="aggregate",class="2",pool="1"} 0
+squid_delay_pool_empty_buckets{bucket="individual",class="2",pool="1"} 1
+squid_delay_pool_empty_buckets{bucket="individual",class="3",pool="2"} 0
+squid_delay_pool_empty_buckets{bucket="network",class="3",pool="2"} 0
+# HELP squid_delay_pool_bucket_current_bytes Current level of individual delay pool buckets in bytes, lowest levels first
+# TYPE squid_delay_pool_bucket_current_bytes gauge
+squid_delay_pool_bucket_current_bytes{bucket="individual",class="2",id="3",pool="1"} 0
+squid_delay_pool_bucket_current_bytes{bucket="individual",class="3",id="1/7",pool="2"} 1000
+squid_delay_pool_bucket_current_bytes{bucket="network",class="3",id="1",pool="2"} 16000
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_delay_pool_empty_buckets", "squid_delay_pool_bucket_current_bytes"))
+}
+
+func TestDelayPoolsCollectKeepsPools(t *testing.T) {
+	pools := decodeTestDelayPage()
+	c := NewDelayPoolsCollector(&DelayPoolsConfig{MaxBuckets: 1}, &mockDelayPoolsClient{pools: pools})
+	testutil.CollectAndCount(c)
+
+	assert.Equal(t, decodeTestDelayPage(), pools)
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	StoreDigestSection = "store_digest"
+	RefreshSection     = "refresh"
+)
+
+var squidDigests = []squidSectionMetric{
+	{StoreDigestSection, "enabled", "store_digest_enabled", nil, prometheus.GaugeValue, "Whether squid builds a cache digest of its local store"},
+	{StoreDigestSection, "size", "store_digest_size_bytes", nil, prometheus.GaugeValue, "Size of the local cache digest in bytes"},
+	{StoreDigestSection, "entries_count", "store_digest_entries", nil, prometheus.GaugeValue, "Entries in the local cache digest"},
+	{StoreDigestSection, "entries_capacity", "store_digest_capacity_entries", nil, prometheus.GaugeValue, "Number of entries the local cache digest was sized for"},
+	{StoreDigestSection, "entries_util", "store_digest_entries_utilization_percent", nil, prometheus.GaugeValue, "Percentage of the local cache digest capacity in use"},
+	{StoreDigestSection, "bits_on", "store_digest_bits_on", nil, prometheus.GaugeValue, "Bits set in the local cache digest"},
+	{StoreDigestSection, "bits_util", "store_digest_bits_utilization_percent", nil, prometheus.GaugeValue, "Percentage of the local cache digest bits set"},
+	{StoreDigestSection, "deletion_attempts", "store_digest_deletion_attempts", nil, prometheus.GaugeValue, "Deletions attempted on the local cache digest since the last rebuild"},
+	{StoreDigestSection, "added", "store_digest_added_entries", nil, prometheus.GaugeValue, "Entries added to the local cache digest during the last rebuild"},
+	{StoreDigestSection, "rejected", "store_digest_rejected_entries", nil, prometheus.GaugeValue, "Entries rejected from the local cache digest during the last rebuild"},
+	{StoreDigestSection, "del-ed", "store_digest_deleted_entries", nil, prometheus.GaugeValue, "Entries deleted from the local cache digest since the last rebuild"},
+
+	{RefreshSection, "checks", "refresh_pattern_checks_total", []string{"index", "pattern"}, prometheus.CounterValue, "Times a refresh_pattern rule was tested against a request"},
+	{RefreshSection, "matches", "refresh_pattern_matches_total", []string{"index", "pattern"}, prometheus.CounterValue, "Times a refresh_pattern rule matched a request"},
+	{RefreshSection, "calls", "refresh_checks_total", []string{"protocol"}, prometheus.CounterValue, "Freshness checks by protocol"},
+	{RefreshSection, "decisions", "refresh_decisions_total", []string{"protocol", "freshness", "reason"}, prometheus.CounterValue, "Freshness decisions by protocol, outcome and reason"},
+}
+
+/*DigestCollector exports cache digest and refresh_pattern effectiveness statistics */
+type DigestCollector struct {
+	*sectionCollector
+}
+
+/*NewDigestCollector creates a cache digest and refresh pattern collector for the given manager pages */
+func NewDigestCollector(sections []string, labels config.Labels, client DigestClient) (*DigestCollector, error) {
+	c, err := newSectionCollector("digest", sections, squidDigests, map[string]func() (types.Counters, error){
+		StoreDigestSection: client.GetStoreDigest,
+		RefreshSection:     client.GetRefresh,
+	}, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DigestCollector{c}, nil
+}
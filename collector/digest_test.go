@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDigestClient struct {
+	mockStoreIOClient
+}
+
+func (m *mockDigestClient) GetStoreDigest() (types.Counters, error) {
+	return m.decode(StoreDigestSection, &storeDigestDecoder{})
+}
+
+func (m *mockDigestClient) GetRefresh() (types.Counters, error) {
+	return m.decode(RefreshSection, &refreshDecoder{})
+}
+
+var testDigestPages = map[string]string{
+	StoreDigestSection: "store digest: size: 4096 bytes\n" +
+		"\t entries: count: 1200 capacity: 6500 util: 18%\n" +
+		"\t deletion attempts: 7\n" +
+		"\t bits: per entry: 5 on: 5100 capacity: 32768 util: 16%\n" +
+		"\t bit-seq: count: 4200 avg.len: 6.80\n" +
+		"\t added: 1250 rejected: 50 ( 3.85 %) del-ed: 7\n" +
+		"\t collisions: on add: 0.12 % on rej: 0.40 %\n",
+	RefreshSection: "\nRefresh Rules:\n" +
+		"\t^ftp:\n" +
+		"\t\t0 correct matches out of 40 checks\n" +
+		"\t.\n" +
+		"\t\t40 correct matches out of 40 checks\n" +
+		"\nRefreshCheck calls per protocol\n\n" +
+		"Protocol\t#Calls\t%Calls\n" +
+		"      HTTP\t    40\t100.00\n" +
+		"       FTP\t     0\t  0.00\n" +
+		"\n\nRefreshCheck histograms for various protocols\n" +
+		"\n\nHTTP histogram:\n" +
+		"Count\t%Total\tCategory\n" +
+		"    30\t 75.00\tFresh: refresh_pattern min value\n" +
+		"    10\t 25.00\tStale: expires time reached\n" +
+		"    40\t100.00\tTOTAL\n",
+}
+
+func TestDigestCollect(t *testing.T) {
+	c, err := NewDigestCollector([]string{StoreDigestSection, RefreshSection}, config.Labels{},
+		&mockDigestClient{mockStoreIOClient{pages: testDigestPages}})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP squid_store_digest_enabled Whether squid builds a cache digest of its local store
+# TYPE squid_store_digest_enabled gauge
+squid_store_digest_enabled 1
+# HELP squid_store_digest_size_bytes Size of the local cache digest in bytes
+# TYPE squid_store_digest_size_bytes gauge
+squid_store_digest_size_bytes 4096
+# HELP squid_store_digest_entries Entries in the local cache digest
+# TYPE squid_store_digest_entries gauge
+squid_store_digest_entries 1200
+# HELP squid_store_digest_bits_utilization_percent Percentage of the local cache digest bits set
+# TYPE squid_store_digest_bits_utilization_percent gauge
+squid_store_digest_bits_utilization_percent 16
+# HELP squid_store_digest_rejected_entries Entries rejected from the local cache digest during the last rebuild
+# TYPE squid_store_digest_rejected_entries gauge
+squid_store_digest_rejected_entries 50
+# HELP squid_store_digest_deleted_entries Entries deleted from the local cache digest since the last rebuild
+# TYPE squid_store_digest_deleted_entries gauge
+squid_store_digest_deleted_entries 7
+# HELP squid_refresh_pattern_matches_total Times a refresh_pattern rule matched a request
+# TYPE squid_refresh_pattern_matches_total counter
+squid_refresh_pattern_matches_total{index="1",pattern="^ftp:"} 0
+squid_refresh_pattern_matches_total{index="2",pattern="."} 40
+# HELP squid_refresh_checks_total Freshness checks by protocol
+# TYPE squid_refresh_checks_total counter
+squid_refresh_checks_total{protocol="ftp"} 0
+squid_refresh_checks_total{protocol="http"} 40
+# HELP squid_refresh_decisions_total Freshness decisions by protocol, outcome and reason
+# TYPE squid_refresh_decisions_total counter
+squid_refresh_decisions_total{freshness="fresh",protocol="http",reason="refresh_pattern min value"} 30
+squid_refresh_decisions_total{freshness="stale",protocol="http",reason="expires time reached"} 10
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_store_digest_enabled", "squid_store_digest_size_bytes", "squid_store_digest_entries",
+		"squid_store_digest_bits_utilization_percent", "squid_store_digest_rejected_entries", "squid_store_digest_deleted_entries",
+		"squid_refresh_pattern_matches_total", "squid_refresh_checks_total", "squid_refresh_decisions_total"))
+}
+
+func TestStoreDigestDisabled(t *testing.T) {
+	d := &storeDigestDecoder{}
+	d.decode("store digest: disabled.\n")
+
+	assert.Equal(t, types.Counters{{Key: "enabled", Value: 0}}, d.finish())
+}
@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/squidtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the end-to-end tests")
+
+// newE2EServer starts a fake squid with the fixtures of version
+func newE2EServer(t *testing.T, version string) *squidtest.Server {
+	s, err := squidtest.NewFixtureServer(version)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// newE2EExporter builds the exporter with service times and mem pools, as main does with the flags set
+func newE2EExporter(t *testing.T, c *CollectorConfig) *Exporter {
+	serviceTimesBefore, memPoolsBefore := ExtractServiceTimes, ExtractMemPools
+	t.Cleanup(func() {
+		ExtractServiceTimes, ExtractMemPools = serviceTimesBefore, memPoolsBefore
+	})
+	ExtractServiceTimes, ExtractMemPools = true, true
+
+	return New(c)
+}
+
+// newRegistry registers c like main does, the pedantic registry of testutil
+// rejects squid_info_service whose labels follow the info page
+func newRegistry(c prometheus.Collector) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	return registry
+}
+
+// gather renders the exposition of c like the /metrics endpoint
+func gather(t *testing.T, c prometheus.Collector) []byte {
+	families, err := newRegistry(c).Gather()
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	for _, mf := range families {
+		_, err := expfmt.MetricFamilyToText(&buf, mf)
+		assert.NoError(t, err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestEndToEnd(t *testing.T) {
+	for _, version := range squidtest.Versions() {
+		t.Run(version, func(t *testing.T) {
+			s := newE2EServer(t, version)
+			e := newE2EExporter(t, &CollectorConfig{Hostname: s.Hostname(), Port: s.Port(), Labels: config.Labels{}})
+
+			golden := filepath.Join("testdata", "e2e", version+".prom")
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, gather(t, e), 0o644))
+			}
+
+			expected, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.NoError(t, testutil.GatherAndCompare(newRegistry(e), bytes.NewReader(expected)))
+		})
+	}
+}
+
+func TestEndToEndAuth(t *testing.T) {
+	s := newE2EServer(t, "6.10")
+	s.SetAuth("manager", "secret")
+
+	e := newE2EExporter(t, &CollectorConfig{Hostname: s.Hostname(), Port: s.Port(), Labels: config.Labels{}})
+	assert.NoError(t, testutil.GatherAndCompare(newRegistry(e), strings.NewReader(`
+# HELP squid_up Was the last query of squid successful?
+# TYPE squid_up gauge
+squid_up{host="127.0.0.1"} 0
+`), "squid_up"))
+
+	e = newE2EExporter(t, &CollectorConfig{Hostname: s.Hostname(), Port: s.Port(), Login: "manager", Password: "secret", Labels: config.Labels{}})
+	assert.NoError(t, testutil.GatherAndCompare(newRegistry(e), strings.NewReader(`
+# HELP squid_up Was the last query of squid successful?
+# TYPE squid_up gauge
+squid_up{host="127.0.0.1"} 1
+`), "squid_up"))
+}
+
+func TestEndToEndFailures(t *testing.T) {
+	s := newE2EServer(t, "4.17")
+	s.SetPage("counters", squidtest.Page{Reset: true})
+	s.SetPage("service_times", squidtest.Page{Status: 500})
+	s.SetPage("info", squidtest.Page{Delay: 50 * time.Millisecond, Body: "Squid Object Cache: Version 4.17\nConnection information for squid:\n\tNumber of clients accessing cache:\t7\n"})
+
+	e := newE2EExporter(t, &CollectorConfig{Hostname: s.Hostname(), Port: s.Port(), Labels: config.Labels{}})
+
+	// The failed pages are missing, the slow one is still exported
+	assert.NoError(t, testutil.GatherAndCompare(newRegistry(e), strings.NewReader(`
+# HELP squid_info_Number_of_clients_accessing_cache Number of clients accessing cache in number
+# TYPE squid_info_Number_of_clients_accessing_cache gauge
+squid_info_Number_of_clients_accessing_cache 7
+# HELP squid_up Was the last query of squid successful?
+# TYPE squid_up gauge
+squid_up{host="127.0.0.1"} 0
+`), "squid_up", "squid_info_Number_of_clients_accessing_cache", "squid_client_http_requests_total", "squid_HTTP_Requests_All_50"))
+}
+
+func TestEndToEndKeepAlive(t *testing.T) {
+	s := newE2EServer(t, "6.10")
+
+	e := newE2EExporter(t, &CollectorConfig{
+		Hostname: s.Hostname(),
+		Port:     s.Port(),
+		Labels:   config.Labels{},
+		Pool:     NewConnPool(&ConnPoolConfig{MaxIdle: 1, IdleTimeout: time.Minute, Labels: config.Labels{}}),
+	})
+	gather(t, e)
+
+	requests := s.Requests()
+	if assert.NotEmpty(t, requests) {
+		for _, r := range requests {
+			assert.True(t, r.KeepAlive, r.Page)
+			assert.Equal(t, "cache_object", r.Form)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"log"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*EventsCollector exports a summary of the squid internal event queue */
+type EventsCollector struct {
+	*pageStatus
+
+	client EventsClient
+	labels config.Labels
+
+	queueLength   *prometheus.Desc
+	scheduled     *prometheus.Desc
+	nextExecution *prometheus.Desc
+	overdue       *prometheus.Desc
+	mostDelayed   *prometheus.Desc
+	lastRun       *prometheus.Desc
+}
+
+/*NewEventsCollector creates an event queue collector */
+func NewEventsCollector(labels config.Labels, client EventsClient) *EventsCollector {
+	nameLabels := append([]string{"name"}, labels.Keys...)
+
+	return &EventsCollector{
+		pageStatus: newPageStatus(labels, "events"),
+
+		client: client,
+		labels: labels,
+
+		queueLength: prometheus.NewDesc(prometheus.BuildFQName(namespace, "events", "queue_length"),
+			"Number of internal events waiting in the scheduler queue", labels.Keys, nil),
+		scheduled: prometheus.NewDesc(prometheus.BuildFQName(namespace, "events", "scheduled"),
+			"Number of queued internal events by event name", nameLabels, nil),
+		nextExecution: prometheus.NewDesc(prometheus.BuildFQName(namespace, "events", "next_execution_seconds"),
+			"Seconds until the earliest queued event of the name runs, negative when it is overdue", nameLabels, nil),
+		overdue: prometheus.NewDesc(prometheus.BuildFQName(namespace, "events", "overdue"),
+			"Number of queued internal events past their execution time", labels.Keys, nil),
+		mostDelayed: prometheus.NewDesc(prometheus.BuildFQName(namespace, "events", "most_delayed_seconds"),
+			"Seconds the most overdue queued event is late, labeled by its name", nameLabels, nil),
+		lastRun: prometheus.NewDesc(prometheus.BuildFQName(namespace, "events", "last_run_info"),
+			"The last internal event squid ran", nameLabels, nil),
+	}
+}
+
+/*Describe implements prometheus.Collector */
+func (c *EventsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queueLength
+	ch <- c.scheduled
+	ch <- c.nextExecution
+	ch <- c.overdue
+	ch <- c.mostDelayed
+	ch <- c.lastRun
+	c.describeStatus(ch)
+}
+
+/*Collect implements prometheus.Collector */
+func (c *EventsCollector) Collect(ch chan<- prometheus.Metric) {
+	queue, err := c.client.GetEvents()
+	c.collect(ch, "events", err)
+	if err != nil {
+		log.Println("Could not fetch events from squid instance: ", err)
+		return
+	}
+
+	counts := map[string]float64{}
+	next := map[string]float64{}
+	var overdue float64
+	var mostDelayed string
+	for _, e := range queue.Events {
+		counts[e.Name]++
+		if n, ok := next[e.Name]; !ok || e.NextExecution < n {
+			next[e.Name] = e.NextExecution
+		}
+
+		if e.NextExecution < 0 {
+			overdue++
+			if mostDelayed == "" || e.NextExecution < next[mostDelayed] {
+				mostDelayed = e.Name
+			}
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.queueLength, prometheus.GaugeValue, float64(len(queue.Events)), c.labels.Values...)
+	ch <- prometheus.MustNewConstMetric(c.overdue, prometheus.GaugeValue, overdue, c.labels.Values...)
+
+	for name, count := range counts {
+		labels := append([]string{name}, c.labels.Values...)
+		ch <- prometheus.MustNewConstMetric(c.scheduled, prometheus.GaugeValue, count, labels...)
+		ch <- prometheus.MustNewConstMetric(c.nextExecution, prometheus.GaugeValue, next[name], labels...)
+	}
+
+	if mostDelayed != "" {
+		ch <- prometheus.MustNewConstMetric(c.mostDelayed, prometheus.GaugeValue, -next[mostDelayed],
+			append([]string{mostDelayed}, c.labels.Values...)...)
+	}
+
+	if queue.LastRun != "" {
+		ch <- prometheus.MustNewConstMetric(c.lastRun, prometheus.GaugeValue, 1,
+			append([]string{queue.LastRun}, c.labels.Values...)...)
+	}
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEventsPage = "Last event to run: storeDirClean\n" +
+	"\n" +
+	"Operation                \tNext Execution \tWeight\tCallback Valid?\n" +
+	"storeDigestRebuildStart  \t-12.500 sec\t    1\t N/A\n" +
+	"MaintainSwapSpace        \t-0.250 sec\t    1\t N/A\n" +
+	"idnsCheckQueue           \t1.000 sec\t    1\t N/A\n" +
+	"idnsCheckQueue           \t3.000 sec\t    1\t N/A\n"
+
+type mockEventsClient struct {
+	queue types.EventQueue
+}
+
+func (m *mockEventsClient) GetEvents() (types.EventQueue, error) {
+	return m.queue, nil
+}
+
+func decodeTestEventsPage() types.EventQueue {
+	d := &eventsDecoder{}
+	for _, line := range strings.SplitAfter(testEventsPage, "\n") {
+		d.decode(line)
+	}
+
+	return d.finish()
+}
+
+func TestDecodeEvents(t *testing.T) {
+	assert.Equal(t, types.EventQueue{
+		LastRun: "storeDirClean",
+		Events: []types.Event{
+			{Name: "storeDigestRebuildStart", NextExecution: -12.5, Weight: 1},
+			{Name: "MaintainSwapSpace", NextExecution: -0.25, Weight: 1},
+			{Name: "idnsCheckQueue", NextExecution: 1, Weight: 1},
+			{Name: "idnsCheckQueue", NextExecution: 3, Weight: 1},
+		},
+	}, decodeTestEventsPage())
+}
+
+func TestEventsCollect(t *testing.T) {
+	c := NewEventsCollector(config.Labels{}, &mockEventsClient{queue: decodeTestEventsPage()})
+
+	expected := `
+# HELP squid_events_queue_length Number of internal events waiting in the scheduler queue
+# TYPE squid_events_queue_length gauge
+squid_events_queue_length 4
+# HELP squid_events_overdue Number of queued internal events past their execution time
+# TYPE squid_events_overdue gauge
+squid_events_overdue 2
+# HELP squid_events_scheduled Number of queued internal events by event name
+# TYPE squid_events_scheduled gauge
+squid_events_scheduled{name="MaintainSwapSpace"} 1
+squid_events_scheduled{name="idnsCheckQueue"} 2
+squid_events_scheduled{name="storeDigestRebuildStart"} 1
+# HELP squid_events_next_execution_seconds Seconds until the earliest queued event of the name runs, negative when it is overdue
+# TYPE squid_events_next_execution_seconds gauge
+squid_events_next_execution_seconds{name="MaintainSwapSpace"} -0.25
+squid_events_next_execution_seconds{name="idnsCheckQueue"} 1
+squid_events_next_execution_seconds{name="storeDigestRebuildStart"} -12.5
+# HELP squid_events_most_delayed_seconds Seconds the most overdue queued event is late, labeled by its name
+# TYPE squid_events_most_delayed_seconds gauge
+squid_events_most_delayed_seconds{name="storeDigestRebuildStart"} 12.5
+# HELP squid_events_last_run_info The last internal event squid ran
+# TYPE squid_events_last_run_info gauge
+squid_events_last_run_info{name="storeDirClean"} 1
+# HELP squid_exporter_page_up Was the last fetch of the manager page successful?
+# TYPE squid_exporter_page_up gauge
+squid_exporter_page_up{page="events"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	ForwardSection     = "forward"
+	HTTPHeadersSection = "http_headers"
+	ViaHeadersSection  = "via_headers"
+	ForwHeadersSection = "forw_headers"
+)
+
+/*DefaultHTTPHeaders are the header fields exported when no allow list is configured */
+var DefaultHTTPHeaders = []string{
+	"Accept", "Accept-Encoding", "Age", "Authorization", "Cache-Control", "Connection", "Content-Length",
+	"Content-Type", "Cookie", "ETag", "Expires", "Host", "If-Modified-Since", "If-None-Match", "Last-Modified",
+	"Pragma", "Proxy-Authorization", "Range", "Set-Cookie", "User-Agent", "Vary", "Via", "X-Forwarded-For",
+}
+
+// headerValuePages maps the pages counting header values to the header they count
+var headerValuePages = map[string]string{
+	ViaHeadersSection:  "via",
+	ForwHeadersSection: "x-forwarded-for",
+}
+
+/*ForwardConfig configures the forwarding and header statistics collector */
+type ForwardConfig struct {
+	Sections []string
+	// Headers is the allow list of header fields, others are reported as "other"
+	Headers []string
+	// MaxHeaderValues caps the number of Via and X-Forwarded-For values exported per header, the others are summed as "other"
+	MaxHeaderValues int
+	Labels          config.Labels
+}
+
+/*ForwardCollector exports forwarding attempts and header field usage */
+type ForwardCollector struct {
+	*pageStatus
+
+	cfg     ForwardConfig
+	client  ForwardClient
+	headers map[string]bool
+
+	attempts     *prometheus.Desc
+	headerCount  *prometheus.Desc
+	headerValues *prometheus.Desc
+}
+
+/*NewForwardCollector creates a forwarding and header statistics collector */
+func NewForwardCollector(c *ForwardConfig, client ForwardClient) (*ForwardCollector, error) {
+	for _, s := range c.Sections {
+		if _, ok := headerValuePages[s]; !ok && s != ForwardSection && s != HTTPHeadersSection {
+			return nil, fmt.Errorf("unknown section %q", s)
+		}
+	}
+
+	cfg := *c
+	if len(cfg.Headers) == 0 {
+		cfg.Headers = DefaultHTTPHeaders
+	}
+
+	headers := map[string]bool{}
+	for _, h := range cfg.Headers {
+		headers[strings.ToLower(h)] = true
+	}
+
+	return &ForwardCollector{
+		pageStatus: newPageStatus(c.Labels, c.Sections...),
+
+		cfg:     cfg,
+		client:  client,
+		headers: headers,
+
+		attempts: prometheus.NewDesc(prometheus.BuildFQName(namespace, "forward", "attempts_total"),
+			"Replies by status code and number of attempts needed to forward the request",
+			append([]string{"status", "tries"}, c.Labels.Keys...), nil),
+		headerCount: prometheus.NewDesc(prometheus.BuildFQName(namespace, "http_header", "count_total"),
+			"Header fields seen in parsed messages by message kind",
+			append([]string{"direction", "header"}, c.Labels.Keys...), nil),
+		headerValues: prometheus.NewDesc(prometheus.BuildFQName(namespace, "http_header", "values_total"),
+			"Requests by Via and X-Forwarded-For header value, most frequent values only",
+			append([]string{"header", "value"}, c.Labels.Keys...), nil),
+	}, nil
+}
+
+/*Describe implements prometheus.Collector */
+func (f *ForwardCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.attempts
+	ch <- f.headerCount
+	ch <- f.headerValues
+	f.describeStatus(ch)
+}
+
+/*Collect implements prometheus.Collector */
+func (f *ForwardCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, section := range f.cfg.Sections {
+		var err error
+		switch section {
+		case ForwardSection:
+			err = f.collectForward(ch)
+		case HTTPHeadersSection:
+			err = f.collectHeaders(ch)
+		default:
+			err = f.collectHeaderValues(ch, section)
+		}
+		f.collect(ch, section, err)
+
+		if err != nil {
+			log.Printf("Could not fetch %s metrics from squid instance: %v", section, err)
+		}
+	}
+}
+
+func (f *ForwardCollector) collectForward(ch chan<- prometheus.Metric) error {
+	counters, err := f.client.GetForward()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range counters {
+		labels := append([]string{c.VarLabels[0].Value, c.VarLabels[1].Value}, f.cfg.Labels.Values...)
+		ch <- prometheus.MustNewConstMetric(f.attempts, prometheus.CounterValue, c.Value, labels...)
+	}
+
+	return nil
+}
+
+func (f *ForwardCollector) collectHeaders(ch chan<- prometheus.Metric) error {
+	counters, err := f.client.GetHTTPHeaders()
+	if err != nil {
+		return err
+	}
+
+	// Headers outside the allow list are summed up, so series have to be aggregated first
+	type key struct{ direction, header string }
+	sums := map[key]float64{}
+	var keys []key
+	for _, c := range counters {
+		header := strings.ToLower(c.VarLabels[1].Value)
+		if !f.headers[header] {
+			header = otherLabel
+		}
+
+		k := key{c.VarLabels[0].Value, header}
+		if _, ok := sums[k]; !ok {
+			keys = append(keys, k)
+		}
+		sums[k] += c.Value
+	}
+
+	for _, k := range keys {
+		labels := append([]string{k.direction, k.header}, f.cfg.Labels.Values...)
+		ch <- prometheus.MustNewConstMetric(f.headerCount, prometheus.CounterValue, sums[k], labels...)
+	}
+
+	return nil
+}
+
+func (f *ForwardCollector) collectHeaderValues(ch chan<- prometheus.Metric, page string) error {
+	counters, err := f.client.GetHeaderValues(page)
+	if err != nil {
+		return err
+	}
+
+	// A value spelled like the rollup is merged into it, it would collide with its series
+	var other float64
+	var rollup bool
+	ranked := make(types.Counters, 0, len(counters))
+	for _, c := range counters {
+		if c.VarLabels[0].Value == otherLabel {
+			other += c.Value
+			rollup = true
+			continue
+		}
+		ranked = append(ranked, c)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Value > ranked[j].Value })
+
+	for i, c := range ranked {
+		if i >= f.cfg.MaxHeaderValues {
+			other += c.Value
+			rollup = true
+			continue
+		}
+
+		labels := append([]string{headerValuePages[page], c.VarLabels[0].Value}, f.cfg.Labels.Values...)
+		ch <- prometheus.MustNewConstMetric(f.headerValues, prometheus.CounterValue, c.Value, labels...)
+	}
+
+	if rollup {
+		labels := append([]string{headerValuePages[page], otherLabel}, f.cfg.Labels.Values...)
+		ch <- prometheus.MustNewConstMetric(f.headerValues, prometheus.CounterValue, other, labels...)
+	}
+
+	return nil
+}
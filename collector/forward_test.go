@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockForwardClient struct {
+	mockStoreIOClient
+}
+
+func (m *mockForwardClient) GetForward() (types.Counters, error) {
+	return m.decode(ForwardSection, &forwardDecoder{})
+}
+
+func (m *mockForwardClient) GetHTTPHeaders() (types.Counters, error) {
+	return m.decode(HTTPHeadersSection, &httpHeadersDecoder{})
+}
+
+func (m *mockForwardClient) GetHeaderValues(page string) (types.Counters, error) {
+	return m.decode(page, &headerValuesDecoder{})
+}
+
+var testForwardPages = map[string]string{
+	ForwardSection: "Status\ttry#1\n" +
+		"200\t0\t1500\t12\n" +
+		"503\t0\t3\t40\n",
+	HTTPHeadersSection: "\nHeader Stats: request\n" +
+		"\nField type distribution\n" +
+		"id\t name                \t count\t#/header\n" +
+		" 0\t Accept              \t  1200\t  0.80\n" +
+		" 1\t X-Custom            \t    20\t  0.01\n" +
+		" 2\t X-Other             \t     5\t  0.00\n" +
+		"\nCache-control directives distribution\n" +
+		"id\t name                \t count\t#/cc_field\n" +
+		" 0\t public              \t    10\t  0.10\n" +
+		"\nHeader Stats: reply\n" +
+		"\nField type distribution\n" +
+		"id\t name                \t count\t#/header\n" +
+		" 0\t Accept              \t     0\t  0.00\n" +
+		"\nHttp Fields Stats (replies and requests)\n",
+	ViaHeadersSection: "      120 1.1 proxy-a (squid/5.7)\n" +
+		"       30 1.1 proxy-b (squid/5.7)\n" +
+		"        2 1.0 legacy\n",
+}
+
+func TestForwardCollect(t *testing.T) {
+	c, err := NewForwardCollector(&ForwardConfig{
+		Sections:        []string{ForwardSection, HTTPHeadersSection, ViaHeadersSection},
+		MaxHeaderValues: 1,
+	}, &mockForwardClient{mockStoreIOClient{pages: testForwardPages}})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP squid_forward_attempts_total Replies by status code and number of attempts needed to forward the request
+# TYPE squid_forward_attempts_total counter
+squid_forward_attempts_total{status="200",tries="0"} 0
+squid_forward_attempts_total{status="200",tries="1"} 1500
+squid_forward_attempts_total{status="200",tries="2"} 12
+squid_forward_attempts_total{status="503",tries="0"} 0
+squid_forward_attempts_total{status="503",tries="1"} 3
+squid_forward_attempts_total{status="503",tries="2"} 40
+# HELP squid_http_header_count_total Header fields seen in parsed messages by message kind
+# TYPE squid_http_header_count_total counter
+squid_http_header_count_total{direction="reply",header="accept"} 0
+squid_http_header_count_total{direction="request",header="accept"} 1200
+squid_http_header_count_total{direction="request",header="other"} 25
+# HELP squid_http_header_values_total Requests by Via and X-Forwarded-For header value, most frequent values only
+# TYPE squid_http_header_values_total counter
+squid_http_header_values_total{header="via",value="1.1 proxy-a (squid/5.7)"} 120
+squid_http_header_values_total{header="via",value="other"} 32
+# HELP squid_exporter_page_up Was the last fetch of the manager page successful?
+# TYPE squid_exporter_page_up gauge
+squid_exporter_page_up{page="forward"} 1
+squid_exporter_page_up{page="http_headers"} 1
+squid_exporter_page_up{page="via_headers"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+}
+
+func TestForwardHeaderValueOther(t *testing.T) {
+	c, err := NewForwardCollector(&ForwardConfig{
+		Sections:        []string{ForwHeadersSection},
+		MaxHeaderValues: 20,
+	}, &mockForwardClient{mockStoreIOClient{pages: map[string]string{
+		ForwHeadersSection: "       12 10.0.0.1\n" +
+			"        3 other\n",
+	}}})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP squid_http_header_values_total Requests by Via and X-Forwarded-For header value, most frequent values only
+# TYPE squid_http_header_values_total counter
+squid_http_header_values_total{header="x-forwarded-for",value="10.0.0.1"} 12
+squid_http_header_values_total{header="x-forwarded-for",value="other"} 3
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "squid_http_header_values_total"))
+}
+
+func TestForwardUnknownSection(t *testing.T) {
+	_, err := NewForwardCollector(&ForwardConfig{Sections: []string{"fqdncache"}, Labels: config.Labels{}}, &mockForwardClient{})
+
+	assert.EqualError(t, err, `unknown section "fqdncache"`)
+}
@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/squidmgr"
+	"github.com/boynux/squid-exporter/squidtest"
+	"github.com/boynux/squid-exporter/types"
+)
+
+// fuzzDecoder fuzzes the decoder of page, seeded with the page of every squid
+// version with fixtures. The lines are decoded directly, so a panic fails the
+// test instead of becoming a parse failure.
+func fuzzDecoder(f *testing.F, page string, newDecoder func() (lineDecoder, func())) {
+	for _, version := range squidtest.Versions() {
+		pages, err := squidtest.Fixture(version)
+		if err != nil {
+			f.Fatal(err)
+		}
+		if p, ok := pages[page]; ok {
+			f.Add(p.Body)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, page string) {
+		d, finish := newDecoder()
+
+		scanner := squidmgr.NewPageScanner(strings.NewReader(page), 0)
+		for scanner.Scan() {
+			d.decode(scanner.Text())
+		}
+		finish()
+	})
+}
+
+func FuzzClientListDecoder(f *testing.F) {
+	fuzzDecoder(f, "client_list", func() (lineDecoder, func()) {
+		d := &clientListDecoder{}
+		return d, func() { d.finish() }
+	})
+}
+
+func FuzzDelayPoolsDecoder(f *testing.F) {
+	fuzzDecoder(f, "delay", func() (lineDecoder, func()) {
+		d := &delayPoolsDecoder{}
+		return d, func() { d.finish() }
+	})
+}
+
+func FuzzHelperStatsDecoder(f *testing.F) {
+	fuzzDecoder(f, "sslcrtd_program", func() (lineDecoder, func()) {
+		d := &helperStatsDecoder{flagsColumn: -1}
+		return d, func() { d.finish() }
+	})
+}
+
+func FuzzAdaptationDecoder(f *testing.F) {
+	fuzzDecoder(f, "adaptation", func() (lineDecoder, func()) {
+		d := &adaptationDecoder{}
+		return d, func() { d.finish() }
+	})
+}
+
+func FuzzEventsDecoder(f *testing.F) {
+	fuzzDecoder(f, "events", func() (lineDecoder, func()) {
+		d := &eventsDecoder{}
+		return d, func() { d.finish() }
+	})
+}
+
+func FuzzObjectsDecoder(f *testing.F) {
+	fuzzDecoder(f, "objects", func() (lineDecoder, func()) {
+		d := &objectsDecoder{fn: func(types.StoreObject) {}}
+		return d, d.finish
+	})
+}
+
+// fuzzCountersDecoder fuzzes a decoder of getPageCounters
+func fuzzCountersDecoder(f *testing.F, page string, newDecoder func() countersDecoder) {
+	fuzzDecoder(f, page, func() (lineDecoder, func()) {
+		d := newDecoder()
+		return d, func() { d.finish() }
+	})
+}
+
+func FuzzStoreIODecoder(f *testing.F) {
+	fuzzCountersDecoder(f, StoreIOSection, func() countersDecoder { return &storeIODecoder{} })
+}
+
+func FuzzIODecoder(f *testing.F) {
+	fuzzCountersDecoder(f, IOSection, func() countersDecoder { return &ioDecoder{} })
+}
+
+func FuzzDiskdDecoder(f *testing.F) {
+	fuzzCountersDecoder(f, DiskdSection, func() countersDecoder { return &diskdDecoder{} })
+}
+
+func FuzzAIOCountsDecoder(f *testing.F) {
+	fuzzCountersDecoder(f, AIOCountsSection, func() countersDecoder { return &aioCountsDecoder{} })
+}
+
+func FuzzStoreDigestDecoder(f *testing.F) {
+	fuzzCountersDecoder(f, StoreDigestSection, func() countersDecoder { return &storeDigestDecoder{} })
+}
+
+func FuzzRefreshDecoder(f *testing.F) {
+	fuzzCountersDecoder(f, RefreshSection, func() countersDecoder { return &refreshDecoder{} })
+}
+
+func FuzzForwardDecoder(f *testing.F) {
+	fuzzCountersDecoder(f, ForwardSection, func() countersDecoder { return &forwardDecoder{} })
+}
+
+func FuzzHTTPHeadersDecoder(f *testing.F) {
+	fuzzCountersDecoder(f, HTTPHeadersSection, func() countersDecoder { return &httpHeadersDecoder{} })
+}
+
+func FuzzHeaderValuesDecoder(f *testing.F) {
+	fuzzCountersDecoder(f, ViaHeadersSection, func() countersDecoder { return &headerValuesDecoder{} })
+}
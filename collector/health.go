@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*HealthConfig configures the background check of the squid cache manager */
+type HealthConfig struct {
+	// Target names the checked squid instance in the detail output, e.g. host:port
+	Target string
+	// Interval is the time between two background checks, 0 disables them and
+	// the status only comes from the scrapes of the exporter
+	Interval time.Duration
+	// ReadyWindow is how long ago the last successful check may be for the exporter to be ready
+	ReadyWindow time.Duration
+}
+
+/*SectionStatus is the result of the last checks of a cache manager section */
+type SectionStatus struct {
+	Healthy     bool       `json:"healthy"`
+	LastCheck   time.Time  `json:"last_check"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+/*TargetStatus is the status of every section checked on a squid instance */
+type TargetStatus struct {
+	Target   string                    `json:"target"`
+	Ready    bool                      `json:"ready"`
+	Sections map[string]*SectionStatus `json:"sections"`
+}
+
+type healthResponse struct {
+	Status  string         `json:"status"`
+	Targets []TargetStatus `json:"targets,omitempty"`
+}
+
+/*HealthChecker tracks the outcome of fetching the cache manager sections and serves the health and readiness endpoints */
+type HealthChecker struct {
+	cfg    HealthConfig
+	client SquidClient
+	now    func() time.Time
+
+	mu       sync.Mutex
+	sections map[string]*SectionStatus
+}
+
+/*NewHealthChecker creates a health checker, client is only used by the optional background checks */
+func NewHealthChecker(c *HealthConfig, client SquidClient) *HealthChecker {
+	return &HealthChecker{
+		cfg:      *c,
+		client:   client,
+		now:      time.Now,
+		sections: map[string]*SectionStatus{},
+	}
+}
+
+/*Run checks squid every interval until stop is closed, it returns at once without an interval */
+func (h *HealthChecker) Run(stop <-chan struct{}) {
+	if h.cfg.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(h.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*Check fetches the sections the exporter scrapes once and records the outcome */
+func (h *HealthChecker) Check() {
+	checks := map[string]func() error{
+		"counters": func() error { _, err := h.client.GetCounters(); return err },
+		"info":     func() error { _, err := h.client.GetInfos(); return err },
+	}
+	if ExtractServiceTimes {
+		checks["service_times"] = func() error { _, err := h.client.GetServiceTimes(); return err }
+	}
+
+	for section, check := range checks {
+		err := check()
+		if err != nil {
+			log.Printf("Health check of section %s failed: %v", section, err)
+		}
+		h.record(section, err)
+	}
+}
+
+// record stores the outcome of fetching section, the exporter records every
+// scrape so readiness does not need checks of its own. A nil HealthChecker
+// ignores it.
+func (h *HealthChecker) record(section string, err error) {
+	if h == nil {
+		return
+	}
+	now := h.now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.sections[section]
+	if !ok {
+		s = &SectionStatus{}
+		h.sections[section] = s
+	}
+	s.LastCheck = now
+	s.Healthy = err == nil
+	s.Error = ""
+	if err != nil {
+		s.Error = err.Error()
+	} else {
+		s.LastSuccess = &now
+	}
+}
+
+/*Status returns the status of the checked squid instance */
+func (h *HealthChecker) Status() TargetStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := TargetStatus{
+		Target:   h.cfg.Target,
+		Ready:    len(h.sections) > 0,
+		Sections: make(map[string]*SectionStatus, len(h.sections)),
+	}
+	for name, s := range h.sections {
+		copied := *s
+		status.Sections[name] = &copied
+
+		if s.LastSuccess == nil || h.now().Sub(*s.LastSuccess) > h.cfg.ReadyWindow {
+			status.Ready = false
+		}
+	}
+
+	return status
+}
+
+/*HealthyHandler reports that the exporter process is up */
+func (h *HealthChecker) HealthyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthResponse(w, http.StatusOK, healthResponse{Status: "healthy"})
+	})
+}
+
+/*ReadyHandler reports whether squid was reachable within the ready window, with the status of every section */
+func (h *HealthChecker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := h.Status()
+
+		resp := healthResponse{Status: "ready", Targets: []TargetStatus{status}}
+		code := http.StatusOK
+		if !status.Ready {
+			resp.Status = "not ready"
+			code = http.StatusServiceUnavailable
+		}
+
+		writeHealthResponse(w, code, resp)
+	})
+}
+
+func writeHealthResponse(w http.ResponseWriter, code int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println("Could not write health response: ", err)
+	}
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSquidClient struct {
+	err error
+}
+
+func (m *mockSquidClient) GetCounters() (types.Counters, error) {
+	return types.Counters{{Key: "client_http.requests", Value: 1}}, m.err
+}
+
+func (m *mockSquidClient) GetServiceTimes() (types.Counters, error) {
+	return nil, m.err
+}
+
+func (m *mockSquidClient) GetInfos() (types.Counters, error) {
+	return nil, m.err
+}
+
+func TestHealthChecker(t *testing.T) {
+	client := &mockSquidClient{}
+	h := NewHealthChecker(&HealthConfig{Target: "127.0.0.1:3128", ReadyWindow: time.Minute}, client)
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	h.now = func() time.Time { return now }
+
+	ready := func() (int, healthResponse) {
+		rec := httptest.NewRecorder()
+		h.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/ready", nil))
+
+		var resp healthResponse
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+		return rec.Code, resp
+	}
+
+	// Not ready before the first check
+	code, resp := ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", resp.Status)
+
+	h.Check()
+	code, resp = ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", resp.Status)
+	assert.Equal(t, "127.0.0.1:3128", resp.Targets[0].Target)
+	assert.True(t, resp.Targets[0].Sections["counters"].Healthy)
+	assert.True(t, resp.Targets[0].Sections["info"].Healthy)
+
+	// A failed check keeps the exporter ready within the window
+	client.err = errors.New("connection refused")
+	now = now.Add(30 * time.Second)
+	h.Check()
+	code, resp = ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, resp.Targets[0].Sections["counters"].Healthy)
+	assert.Equal(t, "connection refused", resp.Targets[0].Sections["counters"].Error)
+
+	now = now.Add(time.Minute)
+	code, resp = ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, resp.Targets[0].Ready)
+}
+
+func TestHealthyHandler(t *testing.T) {
+	h := NewHealthChecker(&HealthConfig{}, &mockSquidClient{err: errors.New("down")})
+
+	rec := httptest.NewRecorder()
+	h.HealthyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/-/healthy", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"status":"healthy"}`, rec.Body.String())
+}
+
+func TestHealthCheckerFromScrapes(t *testing.T) {
+	client := &mockSquidClient{err: errors.New("connection refused")}
+	h := NewHealthChecker(&HealthConfig{ReadyWindow: time.Minute}, nil)
+
+	// Without an interval there are no background checks
+	h.Run(make(chan struct{}))
+	assert.False(t, h.Status().Ready)
+
+	e := New(&CollectorConfig{Health: h})
+	e.client = client
+	testutil.CollectAndCount(e)
+	assert.False(t, h.Status().Ready)
+	assert.Equal(t, "connection refused", h.Status().Sections["counters"].Error)
+
+	client.err = nil
+	testutil.CollectAndCount(e)
+	assert.True(t, h.Status().Ready)
+}
@@ -2,9 +2,12 @@ package collector
 
 import (
 	"log"
+	"sync"
 	"time"
 
 	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/squidmgr"
+	"github.com/boynux/squid-exporter/types"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -28,12 +31,26 @@ var (
 type Exporter struct {
 	client    SquidClient
 	memClient MemClient
+	retry     *Retrier
+	health    *HealthChecker
 
 	hostname string
 	port     int
 
 	labels config.Labels
 	up     *prometheus.GaugeVec
+
+	mu      sync.Mutex
+	lastErr error
+
+	// The version is read on every scrape reaching squid, rawVersion is the
+	// text it was parsed from
+	versionDetected  bool
+	rawVersion       string
+	version          string
+	supported        bool
+	versionInfo      *prometheus.Desc
+	versionSupported *prometheus.Desc
 }
 
 type CollectorConfig struct {
@@ -43,6 +60,16 @@ type CollectorConfig struct {
 	Password string
 	Labels   config.Labels
 	Headers  []string
+	// ProxyHeader is a PROXY protocol header written first on every connection, optional
+	ProxyHeader []byte
+	// Pool keeps connections open between requests, optional
+	Pool *ConnPool
+	// Retry retries failed connections and guards squid with a circuit breaker, optional
+	Retry *Retrier
+	// ParseFailures counts the pages a parser panicked on, optional
+	ParseFailures *ParseFailures
+	// Health is told the outcome of every scrape, optional
+	Health *HealthChecker
 }
 
 /*New initializes a new exporter */
@@ -60,20 +87,30 @@ func New(c *CollectorConfig) *Exporter {
 
 	return &Exporter{
 		client: NewCacheObjectClient(&CacheObjectRequest{
-			c.Hostname,
-			c.Port,
-			c.Login,
-			c.Password,
-			c.Headers,
+			Hostname:      c.Hostname,
+			Port:          c.Port,
+			Login:         c.Login,
+			Password:      c.Password,
+			Headers:       c.Headers,
+			ProxyHeader:   c.ProxyHeader,
+			Pool:          c.Pool,
+			Retry:         c.Retry,
+			ParseFailures: c.ParseFailures,
 		}),
 		memClient: NewCacheMemoryClient(&CacheObjectRequest{
-			Hostname: c.Hostname,
-			Port:     c.Port,
-			Login:    c.Login,
-			Password: c.Password,
-			Headers:  c.Headers,
+			Hostname:      c.Hostname,
+			Port:          c.Port,
+			Login:         c.Login,
+			Password:      c.Password,
+			Headers:       c.Headers,
+			ProxyHeader:   c.ProxyHeader,
+			Pool:          c.Pool,
+			Retry:         c.Retry,
+			ParseFailures: c.ParseFailures,
 		}),
 
+		retry:    c.Retry,
+		health:   c.Health,
 		hostname: c.Hostname,
 		port:     c.Port,
 		labels:   c.Labels,
@@ -82,6 +119,11 @@ func New(c *CollectorConfig) *Exporter {
 			Name:      "up",
 			Help:      "Was the last query of squid successful?",
 		}, []string{"host"}),
+
+		versionInfo: prometheus.NewDesc(prometheus.BuildFQName(namespace, "version", "info"),
+			"Squid version read from the info page or the Server header", append([]string{"version"}, c.Labels.Keys...), nil),
+		versionSupported: prometheus.NewDesc(prometheus.BuildFQName(namespace, "version", "supported"),
+			"Is the squid version supported by the exporter? Metrics of unsupported versions may be missing", c.Labels.Keys, nil),
 	}
 }
 
@@ -89,6 +131,8 @@ func New(c *CollectorConfig) *Exporter {
 // implements prometheus.Collector.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	e.up.Describe(ch)
+	ch <- e.versionInfo
+	ch <- e.versionSupported
 
 	for _, v := range counters {
 		ch <- v
@@ -114,7 +158,13 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 
 /*Collect fetches metrics from squid manager and pushes them to promethus */
 func (e *Exporter) Collect(c chan<- prometheus.Metric) {
+	e.retry.beginScrape()
+
 	insts, err := e.client.GetCounters()
+	e.health.record("counters", err)
+	e.mu.Lock()
+	e.lastErr = err
+	e.mu.Unlock()
 
 	if err == nil {
 		e.up.With(prometheus.Labels{"host": e.hostname}).Set(1)
@@ -130,19 +180,20 @@ func (e *Exporter) Collect(c chan<- prometheus.Metric) {
 
 	if ExtractMemPools {
 		memInsts, err := e.memClient.GetMems()
-		log.Printf("insts: %v", memInsts)
-
 		if err == nil {
 			for i := range memInsts {
 				if d, ok := mems[memInsts[i].Key]; ok {
 					c <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, memInsts[i].Value, memInsts[i].KID, memInsts[i].Pool)
 				}
 			}
+		} else {
+			log.Println("Could not fetch memory pool metrics from squid instance: ", err)
 		}
 	}
 
 	if ExtractServiceTimes {
 		insts, err = e.client.GetServiceTimes()
+		e.health.record("service_times", err)
 
 		if err == nil {
 			for i := range insts {
@@ -156,6 +207,7 @@ func (e *Exporter) Collect(c chan<- prometheus.Metric) {
 	}
 
 	insts, err = e.client.GetInfos()
+	e.health.record("info", err)
 	if err == nil {
 		for i := range insts {
 			if d, ok := infos[insts[i].Key]; ok {
@@ -179,9 +231,77 @@ func (e *Exporter) Collect(c chan<- prometheus.Metric) {
 				c <- prometheus.MustNewConstMetric(infoDesc, prometheus.GaugeValue, insts[i].Value, labelsValues...)
 			}
 		}
+
+		e.detectVersion(insts)
 	} else {
 		log.Println("Could not fetch info metrics from squid instance: ", err)
 	}
 
+	e.mu.Lock()
+	if e.versionDetected {
+		c <- prometheus.MustNewConstMetric(e.versionInfo, prometheus.GaugeValue, 1, append([]string{e.version}, e.labels.Values...)...)
+		c <- prometheus.MustNewConstMetric(e.versionSupported, prometheus.GaugeValue, boolToFloat(e.supported), e.labels.Values...)
+	}
+	e.mu.Unlock()
+
 	e.up.Collect(c)
 }
+
+// detectVersion reads the squid version from the fetched info page, or from
+// the Server header when the page has none, so an upgraded squid is noticed on
+// the next scrape. A version that can not be parsed is treated as unsupported.
+func (e *Exporter) detectVersion(infos types.Counters) {
+	var raw string
+	for _, inst := range infos {
+		if inst.Key != "squid_info" {
+			continue
+		}
+		for _, l := range inst.VarLabels {
+			if l.Key == "Squid_Object_Cache_Version" {
+				raw = l.Value
+			}
+		}
+	}
+	if vc, ok := e.client.(VersionClient); ok && raw == "" {
+		raw = vc.ServerVersion()
+	}
+	if raw == "" {
+		return
+	}
+
+	e.mu.Lock()
+	unchanged := e.versionDetected && e.rawVersion == raw
+	e.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	version, supported := "unknown", false
+	if v, err := squidmgr.ParseVersion(raw); err == nil {
+		version, supported = v.Raw, squidmgr.Supported(v)
+	}
+	if !supported {
+		log.Printf("Squid version %q is not supported, some metrics may be missing", raw)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.versionDetected = true
+	e.rawVersion = raw
+	e.version = version
+	e.supported = supported
+}
+
+// describeStatus sends the desc of squid_up, it implements statusDescriber
+func (e *Exporter) describeStatus(ch chan<- *prometheus.Desc) {
+	e.up.Describe(ch)
+}
+
+// lastScrapeError returns the error of the last counters fetch, which decides squid_up
+func (e *Exporter) lastScrapeError() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.lastErr
+}
@@ -0,0 +1,156 @@
+package collector
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	objectSizeBuckets = prometheus.ExponentialBuckets(1024, 4, 10)
+	objectAgeBuckets  = []float64{60, 300, 900, 3600, 6 * 3600, 24 * 3600, 7 * 24 * 3600, 30 * 24 * 3600}
+)
+
+/*ObjectsConfig configures the cache content collector */
+type ObjectsConfig struct {
+	// Pages to read, vm_objects and/or objects
+	Pages []string
+	// MaxLines caps the number of lines read per page and scrape
+	MaxLines int
+	Labels   config.Labels
+}
+
+/*ObjectsCollector aggregates the objects held in the cache into histograms and counts */
+type ObjectsCollector struct {
+	*pageStatus
+
+	cfg    ObjectsConfig
+	client ObjectsClient
+	now    func() time.Time
+
+	objects   *prometheus.Desc
+	sizes     *prometheus.Desc
+	ages      *prometheus.Desc
+	truncated *prometheus.Desc
+}
+
+type objectsAggregate struct {
+	statuses map[[3]string]float64
+	sizes    *constHistogram
+	ages     *constHistogram
+}
+
+// constHistogram accumulates observations for prometheus.MustNewConstHistogram
+type constHistogram struct {
+	bounds  []float64
+	buckets map[float64]uint64
+	count   uint64
+	sum     float64
+}
+
+func newConstHistogram(bounds []float64) *constHistogram {
+	h := &constHistogram{bounds: bounds, buckets: map[float64]uint64{}}
+	for _, b := range bounds {
+		h.buckets[b] = 0
+	}
+
+	return h
+}
+
+func (h *constHistogram) observe(v float64) {
+	h.count++
+	h.sum += v
+
+	// Buckets of const histograms are cumulative.
+	for _, b := range h.bounds {
+		if v <= b {
+			h.buckets[b]++
+		}
+	}
+}
+
+func (h *constHistogram) metric(desc *prometheus.Desc, labels ...string) prometheus.Metric {
+	return prometheus.MustNewConstHistogram(desc, h.count, h.sum, h.buckets, labels...)
+}
+
+/*NewObjectsCollector creates a cache content collector */
+func NewObjectsCollector(c *ObjectsConfig, client ObjectsClient) *ObjectsCollector {
+	labels := append([]string{"page"}, c.Labels.Keys...)
+
+	return &ObjectsCollector{
+		pageStatus: newPageStatus(c.Labels, c.Pages...),
+
+		cfg:    *c,
+		client: client,
+		now:    time.Now,
+
+		objects: prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache_objects", "count"),
+			"Number of cached objects by store, memory and swap status",
+			append([]string{"page", "store_status", "mem_status", "swap_status"}, c.Labels.Keys...), nil),
+		sizes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache_objects", "size_bytes"),
+			"In memory size of cached objects in bytes", labels, nil),
+		ages: prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache_objects", "age_seconds"),
+			"Age of cached objects in seconds", labels, nil),
+		truncated: prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache_objects", "truncated"),
+			"Whether the page was cut off at the configured maximum number of lines", labels, nil),
+	}
+}
+
+/*Describe implements prometheus.Collector */
+func (c *ObjectsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.objects
+	ch <- c.sizes
+	ch <- c.ages
+	ch <- c.truncated
+	c.describeStatus(ch)
+}
+
+/*Collect implements prometheus.Collector */
+func (c *ObjectsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, page := range c.cfg.Pages {
+		now := float64(c.now().Unix())
+		agg := &objectsAggregate{
+			statuses: map[[3]string]float64{},
+			sizes:    newConstHistogram(objectSizeBuckets),
+			ages:     newConstHistogram(objectAgeBuckets),
+		}
+
+		truncated, err := c.client.GetObjects(page, c.cfg.MaxLines, func(o types.StoreObject) {
+			agg.statuses[[3]string{o.StoreStatus, o.MemStatus, o.SwapStatus}]++
+			agg.sizes.observe(o.Size)
+			if o.Timestamp > 0 && o.Timestamp <= now {
+				agg.ages.observe(now - o.Timestamp)
+			}
+		})
+		c.collect(ch, page, err)
+		if err != nil {
+			log.Printf("Could not fetch %s from squid instance: %v", page, err)
+			continue
+		}
+		if truncated {
+			log.Printf("Stopped reading %s after %d lines", page, c.cfg.MaxLines)
+		}
+
+		labels := append([]string{page}, c.cfg.Labels.Values...)
+
+		statuses := make([][3]string, 0, len(agg.statuses))
+		for k := range agg.statuses {
+			statuses = append(statuses, k)
+		}
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i][0]+statuses[i][1]+statuses[i][2] < statuses[j][0]+statuses[j][1]+statuses[j][2]
+		})
+		for _, k := range statuses {
+			ch <- prometheus.MustNewConstMetric(c.objects, prometheus.GaugeValue, agg.statuses[k],
+				append([]string{page, k[0], k[1], k[2]}, c.cfg.Labels.Values...)...)
+		}
+
+		ch <- agg.sizes.metric(c.sizes, labels...)
+		ch <- agg.ages.metric(c.ages, labels...)
+		ch <- prometheus.MustNewConstMetric(c.truncated, prometheus.GaugeValue, boolToFloat(truncated), labels...)
+	}
+}
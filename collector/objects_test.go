@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const testObjectsPage = `KEY 6F2B3BD39B9D9D1D0B7C2A4A1D3C1F1E
+	STORE_OK      IN_MEMORY     SWAPOUT_DONE PING_NONE
+	CACHABLE,VALIDATED
+	LV:1700000000 LU:1700000100 LM:1699990000 EX:-1
+	0 locks, 0 clients, 1 refs
+	Swap Dir 0, File 0X000001
+	GET http://example.com/
+	inmem_lo: 0
+	inmem_hi: 2000
+	swapout: 2000 bytes queued
+
+KEY 7A2B3BD39B9D9D1D0B7C2A4A1D3C1F1F
+	STORE_PENDING NOT_IN_MEMORY SWAPOUT_NONE PING_DONE
+	LV:1700003000 LU:1700003500 LM:-1        EX:-1
+	inmem_hi: 50000
+`
+
+// pageConnectionHandler serves a fixed page for every request
+type pageConnectionHandler struct {
+	page string
+}
+
+func (p *pageConnectionHandler) connect() (net.Conn, error) {
+	server, client := net.Pipe()
+
+	go func() {
+		defer server.Close()
+		bufio.NewReader(server).ReadString('\n')
+		server.Write([]byte("HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\n" + p.page))
+	}()
+
+	return client, nil
+}
+
+func TestObjectsCollect(t *testing.T) {
+	client := &CacheObjectClient{ch: &pageConnectionHandler{testObjectsPage}}
+	c := NewObjectsCollector(&ObjectsConfig{Pages: []string{"vm_objects"}}, client)
+	c.now = func() time.Time { return time.Unix(1700003600, 0) }
+
+	expected := `
+# HELP squid_cache_objects_count Number of cached objects by store, memory and swap status
+# TYPE squid_cache_objects_count gauge
+squid_cache_objects_count{mem_status="IN_MEMORY",page="vm_objects",store_status="STORE_OK",swap_status="SWAPOUT_DONE"} 1
+squid_cache_objects_count{mem_status="NOT_IN_MEMORY",page="vm_objects",store_status="STORE_PENDING",swap_status="SWAPOUT_NONE"} 1
+# HELP squid_cache_objects_age_seconds Age of cached objects in seconds
+# TYPE squid_cache_objects_age_seconds histogram
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="60"} 0
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="300"} 0
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="900"} 1
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="3600"} 2
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="21600"} 2
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="86400"} 2
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="604800"} 2
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="2.592e+06"} 2
+squid_cache_objects_age_seconds_bucket{page="vm_objects",le="+Inf"} 2
+squid_cache_objects_age_seconds_sum{page="vm_objects"} 4200
+squid_cache_objects_age_seconds_count{page="vm_objects"} 2
+# HELP squid_cache_objects_truncated Whether the page was cut off at the configured maximum number of lines
+# TYPE squid_cache_objects_truncated gauge
+squid_cache_objects_truncated{page="vm_objects"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_cache_objects_count", "squid_cache_objects_age_seconds", "squid_cache_objects_truncated"))
+}
+
+func TestObjectsMaxLines(t *testing.T) {
+	client := &CacheObjectClient{ch: &pageConnectionHandler{testObjectsPage}}
+
+	var sizes []float64
+	truncated, err := client.GetObjects("objects", 14, func(o types.StoreObject) {
+		sizes = append(sizes, o.Size)
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, truncated)
+	assert.Equal(t, []float64{2000}, sizes)
+}
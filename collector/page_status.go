@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// pageStatus exports whether the last fetch of every manager page a collector
+// reads succeeded, so a failing page can be told apart from an empty one. The
+// page is a constant label, collectors of different pages share the metric.
+type pageStatus struct {
+	labels config.Labels
+	descs  map[string]*prometheus.Desc
+
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+func newPageStatus(labels config.Labels, pages ...string) *pageStatus {
+	s := &pageStatus{
+		labels: labels,
+		descs:  map[string]*prometheus.Desc{},
+		errs:   map[string]error{},
+	}
+
+	for _, page := range pages {
+		s.descs[page] = prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "page_up"),
+			"Was the last fetch of the manager page successful?", labels.Keys, prometheus.Labels{"page": page})
+	}
+
+	return s
+}
+
+// describeStatus implements statusDescriber
+func (s *pageStatus) describeStatus(ch chan<- *prometheus.Desc) {
+	for _, d := range s.descs {
+		ch <- d
+	}
+}
+
+// collect remembers the result of fetching page and exports it
+func (s *pageStatus) collect(ch chan<- prometheus.Metric, page string, err error) {
+	s.mu.Lock()
+	if err != nil {
+		s.errs[page] = err
+	} else {
+		delete(s.errs, page)
+	}
+	s.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(s.descs[page], prometheus.GaugeValue, boolToFloat(err == nil), s.labels.Values...)
+}
+
+// lastScrapeError returns the errors of the pages that failed on the last
+// collect, it implements scrapeReporter
+func (s *pageStatus) lastScrapeError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pages := make([]string, 0, len(s.errs))
+	for page := range s.errs {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+
+	errs := make([]error, 0, len(pages))
+	for _, page := range pages {
+		errs = append(errs, s.errs[page])
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/squidmgr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*ParseFailures counts the manager pages that were served but could not be read, the rest of the scrape goes on without them */
+type ParseFailures struct {
+	labels config.Labels
+
+	mu       sync.Mutex
+	failures map[parseFailure]float64
+
+	desc *prometheus.Desc
+}
+
+// parseFailure is a page and the reason it could not be read
+type parseFailure struct {
+	page   string
+	reason string
+}
+
+// Reasons a served page could not be read
+const (
+	// reasonPanic is a parser panic on a line of the page
+	reasonPanic = "panic"
+	// reasonTooLarge is a page or a line over the size limits of the scanner
+	reasonTooLarge = "too_large"
+	// reasonRead is any other error while reading the page, e.g. a timeout
+	reasonRead = "read"
+)
+
+// failureReason tells why a page could not be read
+func failureReason(err error) string {
+	var parseErr *squidmgr.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		return reasonPanic
+	case errors.Is(err, squidmgr.ErrPageTooLarge), errors.Is(err, bufio.ErrTooLong):
+		return reasonTooLarge
+	}
+
+	return reasonRead
+}
+
+/*NewParseFailures creates the parse failure counter shared by all clients of a squid instance */
+func NewParseFailures(labels config.Labels) *ParseFailures {
+	return &ParseFailures{
+		labels:   labels,
+		failures: map[parseFailure]float64{},
+
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "parse_failures_total"),
+			"Manager pages the exporter failed to parse by reason: panic, too_large or read. The metrics of the page are missing from the scrape",
+			append([]string{"page", "reason"}, labels.Keys...), nil),
+	}
+}
+
+// record counts err when it is a *squidmgr.ReadError, errors fetching a page
+// are not parse failures. A nil ParseFailures only logs.
+func (p *ParseFailures) record(err error) {
+	var readErr *squidmgr.ReadError
+	if !errors.As(err, &readErr) {
+		return
+	}
+	reason := failureReason(readErr.Err)
+	log.Printf("Failed to parse the %s page (%s): %v", readErr.Page, reason, readErr.Err)
+
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures[parseFailure{page: readErr.Page, reason: reason}]++
+}
+
+/*Describe implements prometheus.Collector */
+func (p *ParseFailures) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.desc
+}
+
+/*Collect implements prometheus.Collector */
+func (p *ParseFailures) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for f, n := range p.failures {
+		ch <- prometheus.MustNewConstMetric(p.desc, prometheus.CounterValue, n, append([]string{f.page, f.reason}, p.labels.Values...)...)
+	}
+}
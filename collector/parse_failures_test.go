@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/squidmgr"
+	"github.com/boynux/squid-exporter/squidtest"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFailures(t *testing.T) {
+	p := NewParseFailures(config.Labels{Keys: []string{"instance"}, Values: []string{"squid1"}})
+
+	panicked := &squidmgr.ReadError{Page: "counters", Err: &squidmgr.ParseError{Line: "x\n", Panic: "index out of range"}}
+	p.record(panicked)
+	p.record(fmt.Errorf("scrape: %w", panicked))
+	p.record(&squidmgr.ReadError{Page: "info", Err: squidmgr.ErrPageTooLarge})
+	p.record(&squidmgr.ReadError{Page: "info", Err: bufio.ErrTooLong})
+	p.record(&squidmgr.ReadError{Page: "mem", Err: io.ErrUnexpectedEOF})
+	// Errors fetching a page are no parse failures
+	p.record(errors.New("error getting info: connection refused"))
+
+	var disabled *ParseFailures
+	assert.NotPanics(t, func() { disabled.record(panicked) })
+
+	expected := `
+# HELP squid_exporter_parse_failures_total Manager pages the exporter failed to parse by reason: panic, too_large or read. The metrics of the page are missing from the scrape
+# TYPE squid_exporter_parse_failures_total counter
+squid_exporter_parse_failures_total{instance="squid1",page="counters",reason="panic"} 2
+squid_exporter_parse_failures_total{instance="squid1",page="info",reason="too_large"} 2
+squid_exporter_parse_failures_total{instance="squid1",page="mem",reason="read"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(p, strings.NewReader(expected)))
+}
+
+func TestParseFailuresOfClient(t *testing.T) {
+	s := newE2EServer(t, "6.10")
+	failures := NewParseFailures(config.Labels{})
+	c := NewCacheObjectClient(&CacheObjectRequest{Hostname: s.Hostname(), Port: s.Port(), ParseFailures: failures})
+
+	_, err := c.GetObjects("objects", 0, func(types.StoreObject) { panic("broken object") })
+	assert.EqualError(t, err, `error reading objects: parser failed on line "KEY 7A2B3BD39B9D9D1D0B7C2A4A1D3C1F1F": broken object`)
+
+	// The client keeps working after a panic
+	_, err = c.GetCounters()
+	assert.NoError(t, err)
+
+	expected := `
+# HELP squid_exporter_parse_failures_total Manager pages the exporter failed to parse by reason: panic, too_large or read. The metrics of the page are missing from the scrape
+# TYPE squid_exporter_parse_failures_total counter
+squid_exporter_parse_failures_total{page="objects",reason="panic"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(failures, strings.NewReader(expected)))
+}
+
+func TestParseFailuresReason(t *testing.T) {
+	s := newE2EServer(t, "6.10")
+	s.SetPage("client_list", squidtest.Page{Body: "Address: " + strings.Repeat("1", squidmgr.MaxLineLength) + "\n"})
+	failures := NewParseFailures(config.Labels{})
+	c := NewCacheObjectClient(&CacheObjectRequest{Hostname: s.Hostname(), Port: s.Port(), ParseFailures: failures})
+
+	_, err := c.GetClientList()
+	assert.EqualError(t, err, "error reading client_list: bufio.Scanner: token too long")
+
+	// A page that can not be fetched is no parse failure
+	_, err = c.GetEvents()
+	assert.NoError(t, err)
+	s.Close()
+	_, err = c.GetEvents()
+	assert.Error(t, err)
+
+	expected := `
+# HELP squid_exporter_parse_failures_total Manager pages the exporter failed to parse by reason: panic, too_large or read. The metrics of the page are missing from the scrape
+# TYPE squid_exporter_parse_failures_total counter
+squid_exporter_parse_failures_total{page="client_list",reason="too_large"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(failures, strings.NewReader(expected)))
+}
@@ -0,0 +1,307 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*ConnPoolConfig configures the persistent connections to a squid instance */
+type ConnPoolConfig struct {
+	// MaxIdle is the number of idle connections kept open, 0 disables keep-alive
+	MaxIdle int
+	// IdleTimeout is how long an idle connection is kept before it is closed, 0 disables keep-alive
+	IdleTimeout time.Duration
+	// MaxOpen caps the connections open at once, idle ones included. Requests
+	// wait for a free connection when it is reached, 0 does not cap them.
+	MaxOpen int
+	Labels  config.Labels
+}
+
+// errTooManyConnections is returned when no connection became free in time
+var errTooManyConnections = errors.New("no free connection to squid, all connections are in use")
+
+/*ConnPool keeps connections to a squid instance open between the pages of a scrape */
+type ConnPool struct {
+	cfg     ConnPoolConfig
+	now     func() time.Time
+	timeout time.Duration
+
+	mu     sync.Mutex
+	freed  *sync.Cond
+	idle   []*pooledConn
+	open   int
+	opened float64
+	reused float64
+
+	openedDesc *prometheus.Desc
+	reusedDesc *prometheus.Desc
+	idleDesc   *prometheus.Desc
+	openDesc   *prometheus.Desc
+}
+
+// pooledConn keeps the reader of a connection, it may hold data of the next response
+type pooledConn struct {
+	net.Conn
+	reader    *bufio.Reader
+	pool      *ConnPool
+	idleSince time.Time
+	closed    bool
+}
+
+// pooledBody gives the connection back to the pool once the body was read to
+// the end, a body closed before that closes the connection.
+type pooledBody struct {
+	body  io.ReadCloser
+	conn  *pooledConn
+	pool  *ConnPool
+	reuse bool
+	done  bool
+}
+
+/*NewConnPool creates the connection pool shared by all clients of a squid instance */
+func NewConnPool(c *ConnPoolConfig) *ConnPool {
+	p := &ConnPool{
+		cfg:     *c,
+		now:     time.Now,
+		timeout: timeout,
+
+		openedDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "connections_opened_total"),
+			"Connections opened to the squid cache manager", c.Labels.Keys, nil),
+		reusedDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "connections_reused_total"),
+			"Cache manager requests sent on a kept alive connection", c.Labels.Keys, nil),
+		idleDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "connections_idle"),
+			"Idle connections to the squid cache manager kept for reuse", c.Labels.Keys, nil),
+		openDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "connections_open"),
+			"Connections to the squid cache manager open at the moment, idle ones included", c.Labels.Keys, nil),
+	}
+	p.freed = sync.NewCond(&p.mu)
+
+	return p
+}
+
+// fetch sends the request for endpoint, on an idle connection if there is one.
+// Without a pool every request opens a new connection and uses HTTP/1.0.
+func (p *ConnPool) fetch(ch connectionHandler, endpoint string, basicAuthString string, headers []string) (*http.Response, error) {
+	keepAlive := p.keepAlive()
+
+	for {
+		conn, err := p.acquire()
+		if err != nil {
+			return nil, err
+		}
+		if conn == nil {
+			break
+		}
+
+		resp, err := conn.roundTrip(endpoint, basicAuthString, headers, keepAlive)
+		if err == nil {
+			p.mu.Lock()
+			p.reused++
+			p.mu.Unlock()
+
+			return p.wrap(resp, conn, keepAlive), nil
+		}
+		// Squid closed the idle connection in the meantime.
+		conn.Close()
+	}
+
+	c, err := ch.connect()
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	if p != nil {
+		p.mu.Lock()
+		p.opened++
+		p.mu.Unlock()
+	}
+
+	conn := &pooledConn{Conn: c, reader: bufio.NewReader(c), pool: p}
+	resp, err := conn.roundTrip(endpoint, basicAuthString, headers, keepAlive)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return p.wrap(resp, conn, keepAlive), nil
+}
+
+func (p *ConnPool) keepAlive() bool {
+	return p != nil && p.cfg.MaxIdle > 0 && p.cfg.IdleTimeout > 0
+}
+
+// wrap replaces the response body so the connection is released after reading it.
+// Squid answering without a length or with Connection: close ends the connection.
+func (p *ConnPool) wrap(resp *http.Response, conn *pooledConn, keepAlive bool) *http.Response {
+	resp.Body = &pooledBody{body: resp.Body, conn: conn, pool: p, reuse: keepAlive && !resp.Close}
+	return resp
+}
+
+// acquire returns the most recently used idle connection, or nil when a new
+// one may be opened. With MaxOpen connections open it waits until one is
+// released, for at most the request timeout.
+func (p *ConnPool) acquire() (*pooledConn, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deadline := time.Now().Add(p.timeout)
+	for {
+		if conn := p.popIdle(); conn != nil {
+			return conn, nil
+		}
+		if p.cfg.MaxOpen <= 0 || p.open < p.cfg.MaxOpen {
+			p.open++
+			return nil, nil
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, errTooManyConnections
+		}
+		timer := time.AfterFunc(wait, p.freed.Broadcast)
+		p.freed.Wait()
+		timer.Stop()
+	}
+}
+
+// popIdle returns the most recently used idle connection, closing expired
+// ones. p.mu must be held.
+func (p *ConnPool) popIdle() *pooledConn {
+	for len(p.idle) > 0 {
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if p.now().Sub(conn.idleSince) < p.cfg.IdleTimeout {
+			return conn
+		}
+		conn.closed = true
+		conn.Conn.Close()
+		p.open--
+	}
+
+	return nil
+}
+
+// requestTimeout bounds a request from sending it to reading the last byte of the body
+func (p *ConnPool) requestTimeout() time.Duration {
+	if p == nil {
+		return timeout
+	}
+
+	return p.timeout
+}
+
+// release gives back the slot of a connection that was closed or never opened
+func (p *ConnPool) release() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.open--
+	p.freed.Broadcast()
+}
+
+func (p *ConnPool) put(conn *pooledConn) {
+	p.mu.Lock()
+	if len(p.idle) >= p.cfg.MaxIdle {
+		p.mu.Unlock()
+		conn.Close()
+		return
+	}
+
+	// An idle connection must not time out, the next request sets a new deadline
+	conn.SetDeadline(time.Time{})
+	conn.idleSince = p.now()
+	p.idle = append(p.idle, conn)
+	p.freed.Broadcast()
+	p.mu.Unlock()
+}
+
+// roundTrip writes the request for path and reads the response header. The
+// deadline also bounds reading the body, a connection squid stopped answering
+// on fails the request instead of blocking the scrape.
+func (c *pooledConn) roundTrip(path string, basicAuthString string, headers []string, keepAlive bool) (*http.Response, error) {
+	if err := c.SetDeadline(time.Now().Add(c.pool.requestTimeout())); err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprint(c, buildRequest(path, basicAuthString, headers, keepAlive)); err != nil {
+		return nil, err
+	}
+
+	return http.ReadResponse(c.reader, nil)
+}
+
+// Close closes the connection and gives its slot back to the pool
+func (c *pooledConn) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	err := c.Conn.Close()
+	c.pool.release()
+
+	return err
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if err == io.EOF {
+		b.release(b.reuse)
+	}
+
+	return n, err
+}
+
+func (b *pooledBody) Close() error {
+	b.release(false)
+	return nil
+}
+
+func (b *pooledBody) release(reuse bool) {
+	if b.done {
+		return
+	}
+	b.done = true
+
+	if reuse {
+		b.pool.put(b.conn)
+		return
+	}
+	b.conn.Close()
+}
+
+/*Describe implements prometheus.Collector */
+func (p *ConnPool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.openedDesc
+	ch <- p.reusedDesc
+	ch <- p.idleDesc
+	ch <- p.openDesc
+}
+
+/*Collect implements prometheus.Collector */
+func (p *ConnPool) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(p.openedDesc, prometheus.CounterValue, p.opened, p.cfg.Labels.Values...)
+	ch <- prometheus.MustNewConstMetric(p.reusedDesc, prometheus.CounterValue, p.reused, p.cfg.Labels.Values...)
+	ch <- prometheus.MustNewConstMetric(p.idleDesc, prometheus.GaugeValue, float64(len(p.idle)), p.cfg.Labels.Values...)
+	ch <- prometheus.MustNewConstMetric(p.openDesc, prometheus.GaugeValue, float64(p.open), p.cfg.Labels.Values...)
+}
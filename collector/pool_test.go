@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// newKeepAliveSquid serves every cache manager page as "page: <name>", with a
+// content length when keepAlive is set and until the connection closes otherwise
+func newKeepAliveSquid(t *testing.T, keepAlive bool) (*connectionHandlerImpl, *int32) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	var accepted int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+
+			go func() {
+				defer conn.Close()
+
+				// Go does not parse cache_object URIs, so only the request line is read
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					for header := ""; header != "\r\n"; {
+						if header, err = r.ReadString('\n'); err != nil {
+							return
+						}
+					}
+
+					page := strings.TrimPrefix(strings.Fields(line)[1], "cache_object://localhost/")
+					body := "page: " + page + "\n"
+					if !keepAlive {
+						fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\n\r\n%s", body)
+						return
+					}
+					fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+				}
+			}()
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return &connectionHandlerImpl{hostname: addr.IP.String(), port: addr.Port}, &accepted
+}
+
+func readPage(t *testing.T, c *CacheObjectClient, page string) {
+	reader, err := c.readFromSquid(page)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	body, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "page: "+page+"\n", string(body))
+}
+
+func TestConnPoolReusesConnections(t *testing.T) {
+	ch, accepted := newKeepAliveSquid(t, true)
+	pool := NewConnPool(&ConnPoolConfig{MaxIdle: 2, IdleTimeout: time.Minute, Labels: config.Labels{}})
+	client := &CacheObjectClient{ch: ch, pool: pool}
+
+	for _, page := range []string{"counters", "info", "service_times"} {
+		readPage(t, client, page)
+	}
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(accepted))
+	assert.NoError(t, testutil.CollectAndCompare(pool, strings.NewReader(`
+# HELP squid_exporter_connections_idle Idle connections to the squid cache manager kept for reuse
+# TYPE squid_exporter_connections_idle gauge
+squid_exporter_connections_idle 1
+# HELP squid_exporter_connections_open Connections to the squid cache manager open at the moment, idle ones included
+# TYPE squid_exporter_connections_open gauge
+squid_exporter_connections_open 1
+# HELP squid_exporter_connections_opened_total Connections opened to the squid cache manager
+# TYPE squid_exporter_connections_opened_total counter
+squid_exporter_connections_opened_total 1
+# HELP squid_exporter_connections_reused_total Cache manager requests sent on a kept alive connection
+# TYPE squid_exporter_connections_reused_total counter
+squid_exporter_connections_reused_total 2
+`)))
+}
+
+func TestConnPoolFallsBackWithoutKeepAlive(t *testing.T) {
+	ch, accepted := newKeepAliveSquid(t, false)
+	pool := NewConnPool(&ConnPoolConfig{MaxIdle: 2, IdleTimeout: time.Minute, Labels: config.Labels{}})
+	client := &CacheObjectClient{ch: ch, pool: pool}
+
+	readPage(t, client, "counters")
+	readPage(t, client, "info")
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(accepted))
+	assert.Equal(t, 0, len(pool.idle))
+}
+
+func TestConnPoolMaxOpen(t *testing.T) {
+	ch, accepted := newKeepAliveSquid(t, true)
+	pool := NewConnPool(&ConnPoolConfig{MaxIdle: 2, IdleTimeout: time.Minute, MaxOpen: 1, Labels: config.Labels{}})
+	pool.timeout = 100 * time.Millisecond
+	client := &CacheObjectClient{ch: ch, pool: pool}
+
+	// The only connection is in use until the body is read
+	held, err := client.readFromSquid("counters")
+	assert.NoError(t, err)
+	_, err = client.readFromSquid("info")
+	assert.Equal(t, errTooManyConnections, err)
+
+	// Reading the body to the end hands the connection to the waiting request
+	pool.timeout = time.Second
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readPage(t, client, "info")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_, err = io.ReadAll(held)
+	assert.NoError(t, err)
+	<-done
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(accepted))
+	assert.Equal(t, 1, pool.open)
+}
+
+func TestConnPoolDeadline(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	// Squid accepts the connection but never answers
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	pool := NewConnPool(&ConnPoolConfig{MaxIdle: 2, IdleTimeout: time.Minute, MaxOpen: 1, Labels: config.Labels{}})
+	pool.timeout = 100 * time.Millisecond
+	client := &CacheObjectClient{ch: &connectionHandlerImpl{hostname: addr.IP.String(), port: addr.Port}, pool: pool}
+
+	start := time.Now()
+	_, err = client.readFromSquid("counters")
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.Equal(t, 0, pool.open)
+}
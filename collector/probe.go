@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*ProbeConfig configures the blackbox proxy probe */
+type ProbeConfig struct {
+	// Proxy is the squid proxy port to probe through, in host:port format
+	Proxy string
+	// Targets are fetched through the proxy, https URLs are tunneled with CONNECT
+	Targets []string
+	Timeout time.Duration
+	// Login and Password authenticate to the proxy with the Basic scheme, optional
+	Login              string
+	Password           string
+	InsecureSkipVerify bool
+	Labels             config.Labels
+}
+
+/*ProbeCollector fetches the configured targets through squid on every scrape */
+type ProbeCollector struct {
+	cfg ProbeConfig
+
+	success    *prometheus.Desc
+	statusCode *prometheus.Desc
+	duration   *prometheus.Desc
+	cacheHit   *prometheus.Desc
+}
+
+// probeResult holds the outcome of a single probe, phases are filled in by the
+// trace hooks which may run on transport goroutines.
+type probeResult struct {
+	mu         sync.Mutex
+	success    bool
+	statusCode int
+	phases     map[string]float64
+	xCache     string
+}
+
+func (r *probeResult) setPhase(phase string, start time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.phases[phase] = time.Since(start).Seconds()
+}
+
+/*NewProbeCollector creates a blackbox proxy probe collector, the timeout is required */
+func NewProbeCollector(c *ProbeConfig) (*ProbeCollector, error) {
+	if c.Timeout <= 0 {
+		return nil, errors.New("the probe needs a timeout greater than 0")
+	}
+
+	newDesc := func(name, help string, extra ...string) *prometheus.Desc {
+		labels := append(append([]string{"target", "method"}, extra...), c.Labels.Keys...)
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "probe", name), help, labels, nil)
+	}
+
+	return &ProbeCollector{
+		cfg: *c,
+
+		success:    newDesc("success", "Whether the target was fetched through the proxy successfully"),
+		statusCode: newDesc("http_status_code", "HTTP status code of the probe response, 0 when none was received"),
+		duration: newDesc("duration_seconds", "Duration of the probe phases: proxy_dns and connect to the proxy, tls, ttfb and total. "+
+			"The target is resolved by squid, its lookup is part of ttfb", "phase"),
+		cacheHit: newDesc("cache_hit", "Whether the X-Cache header of the response reports a cache hit"),
+	}, nil
+}
+
+/*Describe implements prometheus.Collector */
+func (p *ProbeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.success
+	ch <- p.statusCode
+	ch <- p.duration
+	ch <- p.cacheHit
+}
+
+/*Collect implements prometheus.Collector */
+func (p *ProbeCollector) Collect(ch chan<- prometheus.Metric) {
+	var wg sync.WaitGroup
+	for _, target := range p.cfg.Targets {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			p.collectTarget(ch, target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func (p *ProbeCollector) collectTarget(ch chan<- prometheus.Metric, target string) {
+	method := http.MethodGet
+	if strings.HasPrefix(target, "https://") {
+		method = http.MethodConnect
+	}
+
+	r := p.probe(target)
+	labels := append([]string{target, method}, p.cfg.Labels.Values...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(p.success, prometheus.GaugeValue, boolToFloat(r.success), labels...)
+	ch <- prometheus.MustNewConstMetric(p.statusCode, prometheus.GaugeValue, float64(r.statusCode), labels...)
+	for phase, seconds := range r.phases {
+		ch <- prometheus.MustNewConstMetric(p.duration, prometheus.GaugeValue, seconds,
+			append([]string{target, method, phase}, p.cfg.Labels.Values...)...)
+	}
+
+	// Squid reports "HIT from <host>" or "MISS from <host>", tunneled requests carry no X-Cache header
+	if r.xCache != "" {
+		hit := strings.HasPrefix(strings.ToUpper(r.xCache), "HIT")
+		ch <- prometheus.MustNewConstMetric(p.cacheHit, prometheus.GaugeValue, boolToFloat(hit), labels...)
+	}
+}
+
+// newProxyTransport creates a transport sending all requests through the squid proxy port
+func newProxyTransport(proxy string, insecureSkipVerify bool) *http.Transport {
+	return &http.Transport{
+		Proxy:             http.ProxyURL(&url.URL{Scheme: "http", Host: proxy}),
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: insecureSkipVerify},
+	}
+}
+
+func (p *ProbeCollector) probe(target string) *probeResult {
+	r := &probeResult{phases: map[string]float64{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+
+	transport := newProxyTransport(p.cfg.Proxy, p.cfg.InsecureSkipVerify)
+	defer transport.CloseIdleConnections()
+
+	start := time.Now()
+	var dnsStart, connectStart, tlsStart time.Time
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { r.setPhase("proxy_dns", dnsStart) },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { r.setPhase("connect", connectStart) },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { r.setPhase("tls", tlsStart) },
+		GotFirstResponseByte: func() { r.setPhase("ttfb", start) },
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		log.Printf("Invalid probe target %q: %v", target, err)
+		return r
+	}
+
+	if auth := buildBasicAuthString(p.cfg.Login, p.cfg.Password); auth != "" {
+		// Plain requests carry the credentials themselves, tunnels send them with CONNECT
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+		transport.ProxyConnectHeader = http.Header{"Proxy-Authorization": {"Basic " + auth}}
+	}
+
+	// A rejected CONNECT fails the round trip, keep its status code
+	transport.OnProxyConnectResponse = func(_ context.Context, _ *url.URL, _ *http.Request, resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			r.mu.Lock()
+			r.statusCode = resp.StatusCode
+			r.mu.Unlock()
+		}
+		return nil
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		log.Printf("Probe of %q through %s failed: %v", target, p.cfg.Proxy, err)
+		r.setPhase("total", start)
+		return r
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(io.Discard, resp.Body)
+	r.setPhase("total", start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.statusCode = resp.StatusCode
+	r.xCache = resp.Header.Get("X-Cache")
+	r.success = err == nil && resp.StatusCode >= 200 && resp.StatusCode < 400
+
+	return r
+}
@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// testProxy is a minimal forward proxy standing in for squid. It requires
+// Basic credentials when auth is set and marks forwarded replies with X-Cache.
+type testProxy struct {
+	auth   string
+	xCache string
+}
+
+func (p *testProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.auth != "" && r.Header.Get("Proxy-Authorization") != "Basic "+p.auth {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="test"`)
+		w.WriteHeader(http.StatusProxyAuthRequired)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Authorization")
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("X-Cache", p.xCache+" from testproxy")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func (p *testProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	dst, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer dst.Close()
+
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	go io.Copy(dst, conn)
+	io.Copy(conn, dst)
+}
+
+func newTestOrigin(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("hello"))
+	}
+}
+
+func TestProbeCollect(t *testing.T) {
+	origin := httptest.NewServer(newTestOrigin(http.StatusOK))
+	defer origin.Close()
+	missing := httptest.NewServer(newTestOrigin(http.StatusNotFound))
+	defer missing.Close()
+	secure := httptest.NewTLSServer(newTestOrigin(http.StatusOK))
+	defer secure.Close()
+
+	auth := buildBasicAuthString("probe", "secret")
+	proxy := httptest.NewServer(&testProxy{auth: auth, xCache: "HIT"})
+	defer proxy.Close()
+
+	c, err := NewProbeCollector(&ProbeConfig{
+		Proxy:              strings.TrimPrefix(proxy.URL, "http://"),
+		Targets:            []string{origin.URL, missing.URL, secure.URL},
+		Timeout:            time.Second,
+		Login:              "probe",
+		Password:           "secret",
+		InsecureSkipVerify: true,
+		Labels:             config.Labels{},
+	})
+	assert.NoError(t, err)
+
+	expected := fmt.Sprintf(`
+# HELP squid_probe_success Whether the target was fetched through the proxy successfully
+# TYPE squid_probe_success gauge
+squid_probe_success{method="GET",target="%[1]s"} 1
+squid_probe_success{method="GET",target="%[2]s"} 0
+squid_probe_success{method="CONNECT",target="%[3]s"} 1
+# HELP squid_probe_http_status_code HTTP status code of the probe response, 0 when none was received
+# TYPE squid_probe_http_status_code gauge
+squid_probe_http_status_code{method="GET",target="%[1]s"} 200
+squid_probe_http_status_code{method="GET",target="%[2]s"} 404
+squid_probe_http_status_code{method="CONNECT",target="%[3]s"} 200
+# HELP squid_probe_cache_hit Whether the X-Cache header of the response reports a cache hit
+# TYPE squid_probe_cache_hit gauge
+squid_probe_cache_hit{method="GET",target="%[1]s"} 1
+squid_probe_cache_hit{method="GET",target="%[2]s"} 1
+`, origin.URL, missing.URL, secure.URL)
+
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_probe_success", "squid_probe_http_status_code", "squid_probe_cache_hit"))
+}
+
+func TestProbeProxyAuthRequired(t *testing.T) {
+	origin := httptest.NewServer(newTestOrigin(http.StatusOK))
+	defer origin.Close()
+	proxy := httptest.NewServer(&testProxy{auth: buildBasicAuthString("probe", "secret"), xCache: "MISS"})
+	defer proxy.Close()
+
+	c, err := NewProbeCollector(&ProbeConfig{
+		Proxy:   strings.TrimPrefix(proxy.URL, "http://"),
+		Targets: []string{origin.URL},
+		Timeout: time.Second,
+		Labels:  config.Labels{},
+	})
+	assert.NoError(t, err)
+
+	expected := fmt.Sprintf(`
+# HELP squid_probe_success Whether the target was fetched through the proxy successfully
+# TYPE squid_probe_success gauge
+squid_probe_success{method="GET",target="%[1]s"} 0
+# HELP squid_probe_http_status_code HTTP status code of the probe response, 0 when none was received
+# TYPE squid_probe_http_status_code gauge
+squid_probe_http_status_code{method="GET",target="%[1]s"} 407
+`, origin.URL)
+
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_probe_success", "squid_probe_http_status_code"))
+}
+
+func TestProbeConnectAuthRequired(t *testing.T) {
+	secure := httptest.NewTLSServer(newTestOrigin(http.StatusOK))
+	defer secure.Close()
+	proxy := httptest.NewServer(&testProxy{auth: buildBasicAuthString("probe", "secret")})
+	defer proxy.Close()
+
+	c, err := NewProbeCollector(&ProbeConfig{
+		Proxy:              strings.TrimPrefix(proxy.URL, "http://"),
+		Targets:            []string{secure.URL},
+		Timeout:            time.Second,
+		Login:              "probe",
+		Password:           "wrong",
+		InsecureSkipVerify: true,
+		Labels:             config.Labels{},
+	})
+	assert.NoError(t, err)
+
+	expected := fmt.Sprintf(`
+# HELP squid_probe_success Whether the target was fetched through the proxy successfully
+# TYPE squid_probe_success gauge
+squid_probe_success{method="CONNECT",target="%[1]s"} 0
+# HELP squid_probe_http_status_code HTTP status code of the probe response, 0 when none was received
+# TYPE squid_probe_http_status_code gauge
+squid_probe_http_status_code{method="CONNECT",target="%[1]s"} 407
+`, secure.URL)
+
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_probe_success", "squid_probe_http_status_code"))
+}
+
+func TestProbeRequiresTimeout(t *testing.T) {
+	_, err := NewProbeCollector(&ProbeConfig{Proxy: "localhost:3128", Labels: config.Labels{}})
+
+	assert.EqualError(t, err, "the probe needs a timeout greater than 0")
+}
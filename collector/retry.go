@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultRetryMaxBackoff = 2 * time.Second
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var breakerStates = map[breakerState]string{
+	breakerClosed:   "closed",
+	breakerOpen:     "open",
+	breakerHalfOpen: "half_open",
+}
+
+var errCircuitOpen = errors.New("circuit breaker open, not connecting to squid")
+
+/*RetryConfig configures retries and the circuit breaker of cache manager requests */
+type RetryConfig struct {
+	// Retries is how often a failed connection is retried, 0 disables retries
+	Retries int
+	// Backoff is the base delay before the first retry, doubled for each further retry and jittered
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Budget bounds the time all requests of a scrape spend retrying, so the scrape stays within its timeout
+	Budget time.Duration
+	// FailureThreshold is the number of consecutive failed requests opening the breaker, 0 disables the breaker
+	FailureThreshold int
+	// Cooldown is how long an open breaker rejects requests before a trial request is let through
+	Cooldown time.Duration
+	Labels   config.Labels
+}
+
+/*Retrier retries failed connections to squid and stops connecting while squid is unreachable */
+type Retrier struct {
+	cfg   RetryConfig
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+	retries  float64
+	deadline time.Time // end of the retry budget of the current scrape
+
+	stateDesc   *prometheus.Desc
+	retriesDesc *prometheus.Desc
+}
+
+/*NewRetrier creates a retrier shared by all clients of a squid instance */
+func NewRetrier(c *RetryConfig) *Retrier {
+	cfg := *c
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if cfg.Budget <= 0 {
+		cfg.Budget = timeout
+	}
+
+	return &Retrier{
+		cfg:   cfg,
+		now:   time.Now,
+		sleep: time.Sleep,
+
+		stateDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "circuit_breaker_state"),
+			"State of the circuit breaker in front of the squid cache manager, 1 for the current state",
+			append([]string{"state"}, c.Labels.Keys...), nil),
+		retriesDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "exporter", "request_retries_total"),
+			"Cache manager requests retried after a connection failure", c.Labels.Keys, nil),
+	}
+}
+
+// beginScrape starts the retry budget shared by the requests of a scrape. A
+// nil retrier does nothing.
+func (r *Retrier) beginScrape() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deadline = r.now().Add(r.cfg.Budget)
+}
+
+// scrapeDeadline returns the end of the retry budget for a request. Requests
+// long after the last scrape, e.g. health checks, start a budget of their own,
+// late requests of a scrape that used up its budget are not retried.
+func (r *Retrier) scrapeDeadline() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if now.Sub(r.deadline) > r.cfg.Budget {
+		r.deadline = now.Add(r.cfg.Budget)
+	}
+
+	return r.deadline
+}
+
+// do runs fn, retrying it with a jittered exponential backoff while it fails
+// and the budget of the scrape allows. The time the attempts take counts
+// against the budget. A nil retrier runs fn exactly once.
+func (r *Retrier) do(fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+
+	if err := r.allow(); err != nil {
+		return err
+	}
+
+	deadline := r.scrapeDeadline()
+	backoff := r.cfg.Backoff
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = fn(); err == nil || attempt >= r.cfg.Retries {
+			break
+		}
+
+		// Half of the delay is random, so scrapes failing together do not retry together.
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if r.now().Add(wait).After(deadline) {
+			break
+		}
+
+		r.mu.Lock()
+		r.retries++
+		r.mu.Unlock()
+
+		r.sleep(wait)
+
+		backoff *= 2
+		if backoff > r.cfg.MaxBackoff {
+			backoff = r.cfg.MaxBackoff
+		}
+	}
+
+	r.record(err)
+	return err
+}
+
+// allow rejects requests while the breaker is open and lets a single trial
+// request through once the cooldown has passed.
+func (r *Retrier) allow() error {
+	if r.cfg.FailureThreshold <= 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch r.state {
+	case breakerOpen:
+		if r.now().Sub(r.openedAt) < r.cfg.Cooldown {
+			return errCircuitOpen
+		}
+		r.state = breakerHalfOpen
+		r.trial = true
+	case breakerHalfOpen:
+		if r.trial {
+			return errCircuitOpen
+		}
+		r.trial = true
+	}
+
+	return nil
+}
+
+// record updates the breaker with the outcome of a request
+func (r *Retrier) record(err error) {
+	if r.cfg.FailureThreshold <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.trial = false
+	if err == nil {
+		r.state = breakerClosed
+		r.failures = 0
+		return
+	}
+
+	r.failures++
+	if r.state == breakerHalfOpen || r.failures >= r.cfg.FailureThreshold {
+		r.state = breakerOpen
+		r.openedAt = r.now()
+	}
+}
+
+/*Describe implements prometheus.Collector */
+func (r *Retrier) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.stateDesc
+	ch <- r.retriesDesc
+}
+
+/*Collect implements prometheus.Collector */
+func (r *Retrier) Collect(ch chan<- prometheus.Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for state, name := range breakerStates {
+		ch <- prometheus.MustNewConstMetric(r.stateDesc, prometheus.GaugeValue,
+			boolToFloat(state == r.state), append([]string{name}, r.cfg.Labels.Values...)...)
+	}
+	ch <- prometheus.MustNewConstMetric(r.retriesDesc, prometheus.CounterValue, r.retries, r.cfg.Labels.Values...)
+}
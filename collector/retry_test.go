@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyConnectionHandler fails the first failures connects, then serves an empty page.
+// Every connect runs wait first, e.g. to let time pass.
+type flakyConnectionHandler struct {
+	failures int
+	connects int
+	wait     func()
+}
+
+func (c *flakyConnectionHandler) connect() (net.Conn, error) {
+	c.connects++
+	if c.wait != nil {
+		c.wait()
+	}
+	if c.connects <= c.failures {
+		return nil, errors.New("connection reset by peer")
+	}
+
+	server, client := net.Pipe()
+	go func() {
+		b := make([]byte, 1024)
+		server.Read(b)
+		server.Write([]byte("HTTP/1.0 200 OK\r\n\r\n"))
+		server.Close()
+	}()
+
+	return client, nil
+}
+
+func newTestRetrier(c *RetryConfig) (*Retrier, *time.Time) {
+	r := NewRetrier(c)
+
+	now := time.Unix(1700000000, 0)
+	r.now = func() time.Time { return now }
+	r.sleep = func(d time.Duration) { now = now.Add(d) }
+
+	return r, &now
+}
+
+func TestRetrierRetriesConnectionFailures(t *testing.T) {
+	r, _ := newTestRetrier(&RetryConfig{Retries: 2, Labels: config.Labels{}})
+	ch := &flakyConnectionHandler{failures: 2}
+	client := &CacheObjectClient{ch: ch, retry: r}
+
+	_, err := client.readFromSquid("counters")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, ch.connects)
+
+	// Retries are exhausted
+	ch.connects, ch.failures = 0, 5
+	_, err = client.readFromSquid("counters")
+	assert.EqualError(t, err, "connection reset by peer")
+	assert.Equal(t, 3, ch.connects)
+
+	// The budget stops retrying before the scrape times out
+	r, _ = newTestRetrier(&RetryConfig{Retries: 10, Backoff: time.Second, Budget: 4 * time.Second, Labels: config.Labels{}})
+	ch.connects = 0
+	client.retry = r
+	_, err = client.readFromSquid("counters")
+	assert.Error(t, err)
+	assert.Less(t, ch.connects, 5)
+}
+
+func TestRetrierScrapeBudget(t *testing.T) {
+	r, now := newTestRetrier(&RetryConfig{Retries: 10, Budget: 4 * time.Second, Labels: config.Labels{}})
+	ch := &flakyConnectionHandler{failures: 100, wait: func() { *now = now.Add(time.Second) }}
+	client := &CacheObjectClient{ch: ch, retry: r}
+
+	// Slow attempts use up the budget of the scrape
+	r.beginScrape()
+	client.readFromSquid("counters")
+	assert.Equal(t, 5, ch.connects)
+
+	// The next section of the same scrape is not retried
+	ch.connects = 0
+	client.readFromSquid("info")
+	assert.Equal(t, 1, ch.connects)
+
+	// The next scrape has a budget of its own
+	*now = now.Add(10 * time.Second)
+	r.beginScrape()
+	ch.connects = 0
+	client.readFromSquid("counters")
+	assert.Equal(t, 5, ch.connects)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	r, now := newTestRetrier(&RetryConfig{FailureThreshold: 2, Cooldown: time.Minute, Labels: config.Labels{}})
+	ch := &flakyConnectionHandler{failures: 3}
+	client := &CacheObjectClient{ch: ch, retry: r}
+
+	state := func(s string) string {
+		states := map[string]int{}
+		states[s] = 1
+		return fmt.Sprintf(`
+# HELP squid_exporter_circuit_breaker_state State of the circuit breaker in front of the squid cache manager, 1 for the current state
+# TYPE squid_exporter_circuit_breaker_state gauge
+squid_exporter_circuit_breaker_state{state="closed"} %d
+squid_exporter_circuit_breaker_state{state="half_open"} %d
+squid_exporter_circuit_breaker_state{state="open"} %d
+`, states["closed"], states["half_open"], states["open"])
+	}
+
+	client.readFromSquid("counters")
+	client.readFromSquid("counters")
+	assert.NoError(t, testutil.CollectAndCompare(r, strings.NewReader(state("open")), "squid_exporter_circuit_breaker_state"))
+
+	// Squid is not contacted while the breaker is open
+	_, err := client.readFromSquid("counters")
+	assert.Equal(t, errCircuitOpen, err)
+	assert.Equal(t, 2, ch.connects)
+
+	// A failed trial request opens it again
+	*now = now.Add(time.Minute)
+	client.readFromSquid("counters")
+	assert.Equal(t, 3, ch.connects)
+	assert.NoError(t, testutil.CollectAndCompare(r, strings.NewReader(state("open")), "squid_exporter_circuit_breaker_state"))
+
+	*now = now.Add(time.Minute)
+	_, err = client.readFromSquid("counters")
+	assert.NoError(t, err)
+	assert.NoError(t, testutil.CollectAndCompare(r, strings.NewReader(state("closed")), "squid_exporter_circuit_breaker_state"))
+}
@@ -0,0 +1,24 @@
+package collector
+
+import (
+	"io"
+
+	"github.com/boynux/squid-exporter/squidmgr"
+)
+
+// lineDecoder decodes a manager page line by line, lines keep their newline
+type lineDecoder interface {
+	decode(line string)
+}
+
+// decodeFunc adapts a function to a lineDecoder
+type decodeFunc func(line string)
+
+func (f decodeFunc) decode(line string) {
+	f(line)
+}
+
+// scanPage passes every line of r to d, in the calling goroutine
+func scanPage(r io.Reader, d lineDecoder) error {
+	return squidmgr.ScanPage(r, d.decode)
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/squidmgr"
+	"github.com/boynux/squid-exporter/types"
+)
+
+// largeCountersPage is a counters page with n lines, larger than any real one
+func largeCountersPage(n int) string {
+	var b strings.Builder
+	b.WriteString("sample_time = 1700000000.000000 (Tue, 14 Nov 2023 22:13:20 GMT)\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "client_http.requests_%d = %d\n", i, i*7)
+	}
+
+	return b.String()
+}
+
+// readLinesChan is the goroutine and channel pipeline the pages were parsed with before scanPage
+func readLinesChan(reader *bufio.Reader, lines chan<- string) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		lines <- line
+	}
+	close(lines)
+}
+
+func BenchmarkParseCountersChannel(b *testing.B) {
+	page := largeCountersPage(100000)
+	b.SetBytes(int64(len(page)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		lines := make(chan string)
+		go readLinesChan(bufio.NewReader(strings.NewReader(page)), lines)
+
+		var counters int
+		for line := range lines {
+			if _, err := squidmgr.ParseCounterLine(line); err == nil {
+				counters++
+			}
+		}
+	}
+}
+
+func BenchmarkParseCountersScanner(b *testing.B) {
+	page := largeCountersPage(100000)
+	b.SetBytes(int64(len(page)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var counters int
+		err := scanPage(strings.NewReader(page), decodeFunc(func(line string) {
+			if _, err := squidmgr.ParseCounterLine(line); err == nil {
+				counters++
+			}
+		}))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// largeObjectsPage is an objects page listing n store entries
+func largeObjectsPage(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "KEY %032X\n", i)
+		b.WriteString("\tSTORE_OK      IN_MEMORY     SWAPOUT_DONE PING_NONE\n")
+		fmt.Fprintf(&b, "\tLV:%d LU:%d LM:1699990000 EX:-1\n", 1700000000+i, 1700000100+i)
+		fmt.Fprintf(&b, "\tinmem_hi: %d\n", 512+i%65536)
+	}
+
+	return b.String()
+}
+
+func BenchmarkParseObjectsChannel(b *testing.B) {
+	page := largeObjectsPage(100000)
+	b.SetBytes(int64(len(page)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		lines := make(chan string)
+		go readLinesChan(bufio.NewReader(strings.NewReader(page)), lines)
+
+		var objects int
+		d := &objectsDecoder{fn: func(types.StoreObject) { objects++ }}
+		for line := range lines {
+			d.decode(line)
+		}
+		d.finish()
+	}
+}
+
+func BenchmarkParseObjectsScanner(b *testing.B) {
+	page := largeObjectsPage(100000)
+	b.SetBytes(int64(len(page)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var objects int
+		d := &objectsDecoder{fn: func(types.StoreObject) { objects++ }}
+		if err := scanPage(strings.NewReader(page), d); err != nil {
+			b.Fatal(err)
+		}
+		d.finish()
+	}
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// squidSectionMetric maps a counter decoded from a manager page to a metric,
+// the counter VarLabels are exported in the order of Labels.
+type squidSectionMetric struct {
+	Section     string
+	Key         string
+	Name        string
+	Labels      []string
+	Type        prometheus.ValueType
+	Description string
+}
+
+type sectionDesc struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+// sectionCollector exports the counters of the enabled manager pages according to a metric table
+type sectionCollector struct {
+	*pageStatus
+
+	sections []string
+	fetch    map[string]func() (types.Counters, error)
+	labels   config.Labels
+	descs    map[string]map[string]sectionDesc
+}
+
+// newSectionCollector fails on sections missing from fetch, kind names the
+// collector in the error, e.g. "store I/O"
+func newSectionCollector(kind string, sections []string, metrics []squidSectionMetric, fetch map[string]func() (types.Counters, error), labels config.Labels) (*sectionCollector, error) {
+	c := &sectionCollector{
+		fetch:  fetch,
+		labels: labels,
+		descs:  map[string]map[string]sectionDesc{},
+	}
+
+	for _, s := range sections {
+		if _, ok := fetch[s]; !ok {
+			return nil, fmt.Errorf("unknown %s section %q", kind, s)
+		}
+		// A section listed twice would export every metric twice
+		if _, ok := c.descs[s]; ok {
+			continue
+		}
+		c.sections = append(c.sections, s)
+		c.descs[s] = map[string]sectionDesc{}
+	}
+	c.pageStatus = newPageStatus(labels, c.sections...)
+
+	for _, m := range metrics {
+		if descs, ok := c.descs[m.Section]; ok {
+			descs[m.Key] = sectionDesc{
+				desc:      prometheus.NewDesc(prometheus.BuildFQName(namespace, "", m.Name), m.Description, append(append([]string{}, m.Labels...), labels.Keys...), nil),
+				valueType: m.Type,
+			}
+		}
+	}
+
+	return c, nil
+}
+
+/*Describe implements prometheus.Collector */
+func (c *sectionCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, descs := range c.descs {
+		for _, d := range descs {
+			ch <- d.desc
+		}
+	}
+	c.describeStatus(ch)
+}
+
+/*Collect implements prometheus.Collector */
+func (c *sectionCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, section := range c.sections {
+		insts, err := c.fetch[section]()
+		c.collect(ch, section, err)
+		if err != nil {
+			log.Printf("Could not fetch %s metrics from squid instance: %v", section, err)
+			continue
+		}
+
+		for _, inst := range insts {
+			d, ok := c.descs[section][inst.Key]
+			if !ok {
+				continue
+			}
+
+			var labels []string
+			for _, l := range inst.VarLabels {
+				labels = append(labels, l.Value)
+			}
+			labels = append(labels, c.labels.Values...)
+
+			ch <- prometheus.MustNewConstMetric(d.desc, d.valueType, inst.Value, labels...)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	StoreIOSection   = "store_io"
+	IOSection        = "io"
+	DiskdSection     = "diskd"
+	AIOCountsSection = "squidaio_counts"
+)
+
+var squidStoreIOs = []squidSectionMetric{
+	{StoreIOSection, "create.calls", "store_io_create_calls_total", nil, prometheus.CounterValue, "Store object create calls"},
+	{StoreIOSection, "create.select_fail", "store_io_create_select_fail_total", nil, prometheus.CounterValue, "Store object creates that failed to select a cache_dir"},
+	{StoreIOSection, "create.create_fail", "store_io_create_create_fail_total", nil, prometheus.CounterValue, "Store object creates that failed in the cache_dir"},
+	{StoreIOSection, "create.success", "store_io_create_success_total", nil, prometheus.CounterValue, "Store object creates that succeeded"},
+
+	{IOSection, "reads", "io_reads_total", []string{"protocol"}, prometheus.CounterValue, "Server side reads by protocol"},
+	{IOSection, "reads_by_size", "io_reads_by_size_total", []string{"protocol", "size"}, prometheus.CounterValue, "Server side reads by protocol and read size range in bytes"},
+
+	{DiskdSection, "sent_count", "diskd_sent_total", nil, prometheus.CounterValue, "Messages sent to diskd processes"},
+	{DiskdSection, "recv_count", "diskd_received_total", nil, prometheus.CounterValue, "Messages received from diskd processes"},
+	{DiskdSection, "max_away", "diskd_max_away", nil, prometheus.GaugeValue, "Maximum number of messages awaiting a reply since the previous read of the page"},
+	{DiskdSection, "max_shmuse", "diskd_max_shmuse", nil, prometheus.GaugeValue, "Maximum number of shared memory blocks in use since the previous read of the page"},
+	{DiskdSection, "open_fail_queue_len", "diskd_open_queue_full_failures_total", nil, prometheus.CounterValue, "Opens that failed because the diskd queue was full"},
+	{DiskdSection, "block_queue_len", "diskd_queue_full_blocks_total", nil, prometheus.CounterValue, "Times squid blocked because the diskd queue was full"},
+	{DiskdSection, "ops", "diskd_operations_total", []string{"operation"}, prometheus.CounterValue, "Operations sent to diskd processes"},
+	{DiskdSection, "success", "diskd_operation_successes_total", []string{"operation"}, prometheus.CounterValue, "Operations diskd processes completed successfully"},
+	{DiskdSection, "fail", "diskd_operation_failures_total", []string{"operation"}, prometheus.CounterValue, "Operations diskd processes failed"},
+
+	{AIOCountsSection, "requests", "aio_requests_total", []string{"operation"}, prometheus.CounterValue, "Async I/O operations requested"},
+	{AIOCountsSection, "serviced", "aio_serviced_total", []string{"operation"}, prometheus.CounterValue, "Async I/O operations serviced"},
+	{AIOCountsSection, "check_callback", "aio_check_callbacks_total", nil, prometheus.CounterValue, "Async I/O callback checks"},
+	{AIOCountsSection, "queue", "aio_queue_length", nil, prometheus.GaugeValue, "Async I/O requests waiting in the queue"},
+}
+
+/*StoreIOCollector exports store and disk I/O statistics for the enabled sections */
+type StoreIOCollector struct {
+	*sectionCollector
+}
+
+/*NewStoreIOCollector creates a store I/O collector for the given manager pages */
+func NewStoreIOCollector(sections []string, labels config.Labels, client StoreIOClient) (*StoreIOCollector, error) {
+	c, err := newSectionCollector("store I/O", sections, squidStoreIOs, map[string]func() (types.Counters, error){
+		StoreIOSection:   client.GetStoreIO,
+		IOSection:        client.GetIO,
+		DiskdSection:     client.GetDiskd,
+		AIOCountsSection: client.GetAIOCounts,
+	}, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StoreIOCollector{c}, nil
+}
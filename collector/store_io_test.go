@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockStoreIOClient struct {
+	pages map[string]string
+}
+
+func (m *mockStoreIOClient) decode(page string, d countersDecoder) (types.Counters, error) {
+	for _, line := range strings.SplitAfter(m.pages[page], "\n") {
+		d.decode(line)
+	}
+
+	return d.finish(), nil
+}
+
+func (m *mockStoreIOClient) GetStoreIO() (types.Counters, error) {
+	return m.decode(StoreIOSection, &storeIODecoder{})
+}
+
+func (m *mockStoreIOClient) GetIO() (types.Counters, error) {
+	return m.decode(IOSection, &ioDecoder{})
+}
+
+func (m *mockStoreIOClient) GetDiskd() (types.Counters, error) {
+	return m.decode(DiskdSection, &diskdDecoder{})
+}
+
+func (m *mockStoreIOClient) GetAIOCounts() (types.Counters, error) {
+	return m.decode(AIOCountsSection, &aioCountsDecoder{})
+}
+
+var testStoreIOPages = map[string]string{
+	StoreIOSection: `Store IO Interface Stats
+create.calls 120
+create.select_fail 1
+create.create_fail 2
+create.success 117
+`,
+	IOSection: `HTTP I/O
+number of reads: 40
+Read Histogram:
+    1-    1:      0   0%
+    2-    2:      0   0%
+    3-    4:     10  25%
+    5-    8:     30  75%
+
+FTP I/O
+number of reads: 0
+Read Histogram:
+    1-    1:      0   0%
+`,
+	DiskdSection: `sent_count: 100
+recv_count: 98
+max_away: 4
+max_shmuse: 3
+open_fail_queue_len: 0
+block_queue_len: 1
+
+             OPS   SUCCESS    FAIL
+   open       10        10       0
+   read       50        49       1
+`,
+	AIOCountsSection: "ASYNC IO Counters:\n" +
+		"Operation\t# Requests\tNumber serviced\n" +
+		"open\t10\t10\n" +
+		"read\t50\t48\n" +
+		"check_callback\t700\t-\n" +
+		"queue\t2\t-\n" +
+		"\n" +
+		"Thread Status:\n" +
+		"#\tID\t# Requests\n" +
+		"1\t139\t12\n",
+}
+
+func TestStoreIOCollect(t *testing.T) {
+	c, err := NewStoreIOCollector([]string{StoreIOSection, IOSection, DiskdSection, AIOCountsSection}, config.Labels{},
+		&mockStoreIOClient{pages: testStoreIOPages})
+	assert.NoError(t, err)
+
+	expected := `
+# HELP squid_store_io_create_select_fail_total Store object creates that failed to select a cache_dir
+# TYPE squid_store_io_create_select_fail_total counter
+squid_store_io_create_select_fail_total 1
+# HELP squid_io_reads_by_size_total Server side reads by protocol and read size range in bytes
+# TYPE squid_io_reads_by_size_total counter
+squid_io_reads_by_size_total{protocol="ftp",size="1-1"} 0
+squid_io_reads_by_size_total{protocol="http",size="1-1"} 0
+squid_io_reads_by_size_total{protocol="http",size="2-2"} 0
+squid_io_reads_by_size_total{protocol="http",size="3-4"} 10
+squid_io_reads_by_size_total{protocol="http",size="5-8"} 30
+# HELP squid_diskd_operation_failures_total Operations diskd processes failed
+# TYPE squid_diskd_operation_failures_total counter
+squid_diskd_operation_failures_total{operation="open"} 0
+squid_diskd_operation_failures_total{operation="read"} 1
+# HELP squid_diskd_queue_full_blocks_total Times squid blocked because the diskd queue was full
+# TYPE squid_diskd_queue_full_blocks_total counter
+squid_diskd_queue_full_blocks_total 1
+# HELP squid_diskd_received_total Messages received from diskd processes
+# TYPE squid_diskd_received_total counter
+squid_diskd_received_total 98
+# HELP squid_aio_serviced_total Async I/O operations serviced
+# TYPE squid_aio_serviced_total counter
+squid_aio_serviced_total{operation="open"} 10
+squid_aio_serviced_total{operation="read"} 48
+# HELP squid_aio_queue_length Async I/O requests waiting in the queue
+# TYPE squid_aio_queue_length gauge
+squid_aio_queue_length 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_store_io_create_select_fail_total", "squid_io_reads_by_size_total", "squid_diskd_operation_failures_total",
+		"squid_diskd_received_total", "squid_diskd_queue_full_blocks_total", "squid_aio_serviced_total", "squid_aio_queue_length"))
+}
+
+func TestStoreIODuplicateSections(t *testing.T) {
+	c, err := NewStoreIOCollector([]string{IOSection, IOSection}, config.Labels{}, &mockStoreIOClient{pages: testStoreIOPages})
+	assert.NoError(t, err)
+
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(`
+# HELP squid_io_reads_total Server side reads by protocol
+# TYPE squid_io_reads_total counter
+squid_io_reads_total{protocol="ftp"} 0
+squid_io_reads_total{protocol="http"} 40
+`), "squid_io_reads_total"))
+}
+
+func TestStoreIOUnknownSection(t *testing.T) {
+	_, err := NewStoreIOCollector([]string{"coss"}, config.Labels{}, &mockStoreIOClient{})
+
+	assert.EqualError(t, err, `unknown store I/O section "coss"`)
+}
@@ -0,0 +1,221 @@
+package collector
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/boynux/squid-exporter/accesslog"
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// Access log fields the TLS collector reads, see Tailer.SetExtraFields
+	BumpModeField = "ssl_bump_mode"
+	TLSErrorField = "tls_error"
+
+	// maxTLSErrors bounds the number of distinct TLS error series
+	maxTLSErrors = 50
+)
+
+var bumpModes = map[string]bool{
+	"none":         true,
+	"client-first": true,
+	"server-first": true,
+	"peek":         true,
+	"stare":        true,
+	"bump":         true,
+	"splice":       true,
+	"terminate":    true,
+}
+
+/*TLSConfig configures the SSL-bump and certificate generator collector */
+type TLSConfig struct {
+	// Helpers are the manager pages of the TLS helpers, e.g. sslcrtd_program
+	Helpers []string
+	// CertDBPath is the security_file_certgen database directory, optional
+	CertDBPath string
+	// CertDBMaxSize is the configured maximum database size in bytes, optional
+	CertDBMaxSize float64
+	Labels        config.Labels
+}
+
+/*TLSCollector exports TLS helper, certificate database and SSL-bump metrics */
+type TLSCollector struct {
+	*pageStatus
+
+	cfg    TLSConfig
+	client HelperClient
+
+	helperActive    *prometheus.Desc
+	helperMax       *prometheus.Desc
+	helperBusy      *prometheus.Desc
+	helperRequests  *prometheus.Desc
+	helperReplies   *prometheus.Desc
+	helperTimedOut  *prometheus.Desc
+	helperQueue     *prometheus.Desc
+	helperSvcTime   *prometheus.Desc
+	certDBSize      *prometheus.Desc
+	certDBMaxSize   *prometheus.Desc
+	certDBCertCount *prometheus.Desc
+
+	bumpModes *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	errorSeen map[string]bool
+}
+
+/*NewTLSCollector creates a TLS collector */
+func NewTLSCollector(c *TLSConfig, client HelperClient) *TLSCollector {
+	helperLabels := append([]string{"helper"}, c.Labels.Keys...)
+	newHelperDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "tls_helper", name), help, helperLabels, nil)
+	}
+	newCertDBDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "tls_certdb", name), help, c.Labels.Keys, nil)
+	}
+
+	return &TLSCollector{
+		pageStatus: newPageStatus(c.Labels, c.Helpers...),
+
+		cfg:    *c,
+		client: client,
+
+		helperActive:   newHelperDesc("active_children", "Number of running TLS helper processes"),
+		helperMax:      newHelperDesc("max_children", "Maximum number of TLS helper processes"),
+		helperBusy:     newHelperDesc("busy_children", "Number of TLS helper processes busy with a request"),
+		helperRequests: newHelperDesc("requests_total", "Requests sent to the TLS helpers"),
+		helperReplies:  newHelperDesc("replies_total", "Replies received from the TLS helpers"),
+		helperTimedOut: newHelperDesc("timedout_requests_total", "Requests to the TLS helpers that timed out"),
+		helperQueue:    newHelperDesc("queue_length", "Requests waiting for a free TLS helper"),
+		helperSvcTime:  newHelperDesc("avg_service_time_seconds", "Average TLS helper service time in seconds"),
+
+		certDBSize:      newCertDBDesc("size_bytes", "Size of the certificate generator database in bytes"),
+		certDBMaxSize:   newCertDBDesc("max_size_bytes", "Configured maximum size of the certificate generator database in bytes"),
+		certDBCertCount: newCertDBDesc("certificates", "Number of valid certificates in the certificate generator database"),
+
+		bumpModes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "tls",
+			Name:      "bump_mode_requests_total",
+			Help:      "Requests by SSL-bump mode, read from the access log",
+		}, append([]string{"mode"}, c.Labels.Keys...)),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "tls",
+			Name:      "errors_total",
+			Help:      "TLS errors by error name, read from the access log",
+		}, append([]string{"error"}, c.Labels.Keys...)),
+		errorSeen: map[string]bool{},
+	}
+}
+
+/*Handle accounts an access log entry, it implements accesslog.Handler */
+func (t *TLSCollector) Handle(e *accesslog.Entry) {
+	if mode := strings.ToLower(e.Field(BumpModeField)); mode != "" {
+		if !bumpModes[mode] {
+			mode = otherLabel
+		}
+		t.bumpModes.WithLabelValues(append([]string{mode}, t.cfg.Labels.Values...)...).Inc()
+	}
+
+	errs := strings.FieldsFunc(e.Field(TLSErrorField), func(r rune) bool { return r == ':' || r == ',' })
+	for _, name := range errs {
+		// Only the tailer goroutine calls Handle, so errorSeen needs no locking.
+		if !t.errorSeen[name] {
+			if len(t.errorSeen) >= maxTLSErrors {
+				name = otherLabel
+			} else {
+				t.errorSeen[name] = true
+			}
+		}
+		t.errors.WithLabelValues(append([]string{name}, t.cfg.Labels.Values...)...).Inc()
+	}
+}
+
+/*Describe implements prometheus.Collector */
+func (t *TLSCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.helperActive
+	ch <- t.helperMax
+	ch <- t.helperBusy
+	ch <- t.helperRequests
+	ch <- t.helperReplies
+	ch <- t.helperTimedOut
+	ch <- t.helperQueue
+	ch <- t.helperSvcTime
+	ch <- t.certDBSize
+	ch <- t.certDBMaxSize
+	ch <- t.certDBCertCount
+	t.describeStatus(ch)
+	t.bumpModes.Describe(ch)
+	t.errors.Describe(ch)
+}
+
+/*Collect implements prometheus.Collector */
+func (t *TLSCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, page := range t.cfg.Helpers {
+		stats, err := t.client.GetHelperStats(page)
+		t.collect(ch, page, err)
+		if err != nil {
+			log.Println("Could not fetch TLS helper stats from squid instance: ", err)
+			continue
+		}
+
+		labels := append([]string{strings.TrimSuffix(page, "_program")}, t.cfg.Labels.Values...)
+		ch <- prometheus.MustNewConstMetric(t.helperActive, prometheus.GaugeValue, stats.Active, labels...)
+		ch <- prometheus.MustNewConstMetric(t.helperMax, prometheus.GaugeValue, stats.Max, labels...)
+		ch <- prometheus.MustNewConstMetric(t.helperBusy, prometheus.GaugeValue, stats.Busy, labels...)
+		ch <- prometheus.MustNewConstMetric(t.helperRequests, prometheus.CounterValue, stats.Requests, labels...)
+		ch <- prometheus.MustNewConstMetric(t.helperReplies, prometheus.CounterValue, stats.Replies, labels...)
+		ch <- prometheus.MustNewConstMetric(t.helperTimedOut, prometheus.CounterValue, stats.TimedOut, labels...)
+		ch <- prometheus.MustNewConstMetric(t.helperQueue, prometheus.GaugeValue, stats.QueueLength, labels...)
+		ch <- prometheus.MustNewConstMetric(t.helperSvcTime, prometheus.GaugeValue, stats.AvgServiceTime/1000, labels...)
+	}
+
+	if t.cfg.CertDBPath != "" {
+		t.collectCertDB(ch)
+	}
+
+	t.bumpModes.Collect(ch)
+	t.errors.Collect(ch)
+}
+
+// collectCertDB reads the size and index files security_file_certgen keeps in its database directory
+func (t *TLSCollector) collectCertDB(ch chan<- prometheus.Metric) {
+	labels := t.cfg.Labels.Values
+
+	content, err := os.ReadFile(filepath.Join(t.cfg.CertDBPath, "size"))
+	if err != nil {
+		log.Println("Could not read certificate database size: ", err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(t.certDBSize, prometheus.GaugeValue, parseFloat(strings.TrimSpace(string(content))), labels...)
+	}
+
+	if t.cfg.CertDBMaxSize > 0 {
+		ch <- prometheus.MustNewConstMetric(t.certDBMaxSize, prometheus.GaugeValue, t.cfg.CertDBMaxSize, labels...)
+	}
+
+	f, err := os.Open(filepath.Join(t.cfg.CertDBPath, "index.txt"))
+	if err != nil {
+		log.Println("Could not read certificate database index: ", err)
+		return
+	}
+	defer f.Close()
+
+	var valid float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Index lines start with the certificate status, V for valid
+		if strings.HasPrefix(scanner.Text(), "V") {
+			valid++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Println("Could not read certificate database index: ", err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(t.certDBCertCount, prometheus.GaugeValue, valid, labels...)
+}
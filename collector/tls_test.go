@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/accesslog"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockHelperClient struct {
+	stats map[string]types.HelperStats
+}
+
+func (m *mockHelperClient) GetHelperStats(page string) (types.HelperStats, error) {
+	return m.stats[page], nil
+}
+
+func TestTLSCollectHelpersAndCertDB(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "size"), []byte("8192\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.txt"), []byte(
+		"V\t301206000000Z\t\t01\tunknown\t/CN=a.example.com\n"+
+			"R\t301206000000Z\t201206000000Z\t02\tunknown\t/CN=b.example.com\n"+
+			"V\t301206000000Z\t\t03\tunknown\t/CN=c.example.com\n"), 0o644))
+
+	c := NewTLSCollector(&TLSConfig{
+		Helpers:       []string{"sslcrtd_program"},
+		CertDBPath:    dir,
+		CertDBMaxSize: 4 * 1024 * 1024,
+	}, &mockHelperClient{stats: map[string]types.HelperStats{
+		"sslcrtd_program": {Active: 5, Max: 10, Busy: 2, Requests: 100, AvgServiceTime: 12},
+	}})
+
+	expected := `
+# HELP squid_tls_helper_busy_children Number of TLS helper processes busy with a request
+# TYPE squid_tls_helper_busy_children gauge
+squid_tls_helper_busy_children{helper="sslcrtd"} 2
+# HELP squid_tls_helper_avg_service_time_seconds Average TLS helper service time in seconds
+# TYPE squid_tls_helper_avg_service_time_seconds gauge
+squid_tls_helper_avg_service_time_seconds{helper="sslcrtd"} 0.012
+# HELP squid_tls_certdb_size_bytes Size of the certificate generator database in bytes
+# TYPE squid_tls_certdb_size_bytes gauge
+squid_tls_certdb_size_bytes 8192
+# HELP squid_tls_certdb_max_size_bytes Configured maximum size of the certificate generator database in bytes
+# TYPE squid_tls_certdb_max_size_bytes gauge
+squid_tls_certdb_max_size_bytes 4.194304e+06
+# HELP squid_tls_certdb_certificates Number of valid certificates in the certificate generator database
+# TYPE squid_tls_certdb_certificates gauge
+squid_tls_certdb_certificates 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_tls_helper_busy_children", "squid_tls_helper_avg_service_time_seconds",
+		"squid_tls_certdb_size_bytes", "squid_tls_certdb_max_size_bytes", "squid_tls_certdb_certificates"))
+}
+
+func TestTLSHandleAccessLog(t *testing.T) {
+	c := NewTLSCollector(&TLSConfig{}, nil)
+
+	entries := []accesslog.Entry{
+		{Fields: map[string]string{BumpModeField: "bump", TLSErrorField: "X509_V_ERR_CERT_HAS_EXPIRED:SQUID_X509_V_ERR_DOMAIN_MISMATCH"}},
+		{Fields: map[string]string{BumpModeField: "splice", TLSErrorField: "-"}},
+		{Fields: map[string]string{BumpModeField: "-", TLSErrorField: "-"}},
+		{Fields: map[string]string{BumpModeField: "Something", TLSErrorField: "X509_V_ERR_CERT_HAS_EXPIRED"}},
+	}
+	for i := range entries {
+		c.Handle(&entries[i])
+	}
+
+	expected := `
+# HELP squid_tls_bump_mode_requests_total Requests by SSL-bump mode, read from the access log
+# TYPE squid_tls_bump_mode_requests_total counter
+squid_tls_bump_mode_requests_total{mode="bump"} 1
+squid_tls_bump_mode_requests_total{mode="other"} 1
+squid_tls_bump_mode_requests_total{mode="splice"} 1
+# HELP squid_tls_errors_total TLS errors by error name, read from the access log
+# TYPE squid_tls_errors_total counter
+squid_tls_errors_total{error="SQUID_X509_V_ERR_DOMAIN_MISMATCH"} 1
+squid_tls_errors_total{error="X509_V_ERR_CERT_HAS_EXPIRED"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"squid_tls_bump_mode_requests_total", "squid_tls_errors_total"))
+}
@@ -0,0 +1,159 @@
+package collector
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/boynux/squid-exporter/accesslog"
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/publicsuffix"
+)
+
+/*TopDomainsConfig configures the per destination domain aggregation */
+type TopDomainsConfig struct {
+	Count  int
+	Window time.Duration
+	Allow  []string
+	Deny   []string
+	Labels config.Labels
+}
+
+/*TopDomains exports traffic of the busiest destination domains over a sliding window */
+type TopDomains struct {
+	cfg    TopDomainsConfig
+	now    func() time.Time
+	pinned map[string]bool
+
+	mu      sync.Mutex
+	domains *talkerWindow
+
+	requests *prometheus.Desc
+	bytes    *prometheus.Desc
+	hits     *prometheus.Desc
+	misses   *prometheus.Desc
+}
+
+/*NewTopDomains creates a destination domain aggregator */
+func NewTopDomains(c *TopDomainsConfig) *TopDomains {
+	window := c.Window.String()
+	labels := append([]string{"domain"}, c.Labels.Keys...)
+
+	pinned := map[string]bool{}
+	for _, d := range c.Allow {
+		pinned[normalizeDomain(d)] = true
+	}
+
+	return &TopDomains{
+		cfg:     *c,
+		now:     time.Now,
+		pinned:  pinned,
+		domains: newTalkerWindow(c.Window),
+
+		requests: prometheus.NewDesc(prometheus.BuildFQName(namespace, "top_domains", "requests"),
+			"Requests to the busiest destination domains over the last "+window, labels, nil),
+		bytes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "top_domains", "bytes"),
+			"Bytes transferred from the busiest destination domains over the last "+window, labels, nil),
+		hits: prometheus.NewDesc(prometheus.BuildFQName(namespace, "top_domains", "hits"),
+			"Cache hits for the busiest destination domains over the last "+window, labels, nil),
+		misses: prometheus.NewDesc(prometheus.BuildFQName(namespace, "top_domains", "misses"),
+			"Cache misses for the busiest destination domains over the last "+window, labels, nil),
+	}
+}
+
+/*Handle accounts an access log entry, it implements accesslog.Handler */
+func (t *TopDomains) Handle(e *accesslog.Entry) {
+	delta := talkerStats{requests: 1, bytes: float64(e.Bytes)}
+	if e.IsHit() {
+		delta.hits = 1
+	} else if strings.Contains(e.Result, "MISS") {
+		delta.misses = 1
+	}
+
+	key := t.domainKey(e.Host())
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.domains.add(now, key, delta)
+}
+
+// domainKey maps a host to the series it is accounted to, allow and deny list
+// entries match the domain itself and all of its subdomains. The most specific
+// allow list entry wins.
+func (t *TopDomains) domainKey(host string) string {
+	for _, d := range t.cfg.Deny {
+		if matchDomain(host, normalizeDomain(d)) {
+			return otherLabel
+		}
+	}
+
+	key := ""
+	for d := range t.pinned {
+		if matchDomain(host, d) && len(d) > len(key) {
+			key = d
+		}
+	}
+	if key != "" {
+		return key
+	}
+
+	return registrableDomain(host)
+}
+
+/*Describe implements prometheus.Collector */
+func (t *TopDomains) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.requests
+	ch <- t.bytes
+	ch <- t.hits
+	ch <- t.misses
+}
+
+/*Collect implements prometheus.Collector */
+func (t *TopDomains) Collect(ch chan<- prometheus.Metric) {
+	now := t.now()
+
+	t.mu.Lock()
+	domains := topTalkers(t.domains.sum(now), t.cfg.Count, t.pinned)
+	t.mu.Unlock()
+
+	for _, d := range domains {
+		labels := append([]string{d.key}, t.cfg.Labels.Values...)
+		ch <- prometheus.MustNewConstMetric(t.requests, prometheus.GaugeValue, d.requests, labels...)
+		ch <- prometheus.MustNewConstMetric(t.bytes, prometheus.GaugeValue, d.bytes, labels...)
+		ch <- prometheus.MustNewConstMetric(t.hits, prometheus.GaugeValue, d.hits, labels...)
+		ch <- prometheus.MustNewConstMetric(t.misses, prometheus.GaugeValue, d.misses, labels...)
+	}
+}
+
+// registrableDomain collapses a host name to the domain directly below its
+// public suffix, e.g. img.news.example.co.uk becomes example.co.uk.
+func registrableDomain(host string) string {
+	host = normalizeDomain(host)
+	if host == "" {
+		return otherLabel
+	}
+	if net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		// The host is a public suffix itself or not a valid name.
+		return host
+	}
+
+	return domain
+}
+
+func normalizeDomain(d string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+}
+
+func matchDomain(host, domain string) bool {
+	host = normalizeDomain(host)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
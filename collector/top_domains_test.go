@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/accesslog"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"www.example.com", "example.com"},
+		{"img.news.example.co.uk", "example.co.uk"},
+		{"Example.COM.", "example.com"},
+		{"co.uk", "co.uk"},
+		{"10.1.2.3", "10.1.2.3"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"", "other"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, registrableDomain(tc.host), tc.host)
+	}
+}
+
+func TestTopDomainsCollect(t *testing.T) {
+	td := NewTopDomains(&TopDomainsConfig{
+		Count:  1,
+		Window: time.Minute,
+		Allow:  []string{"mail.example.org"},
+		Deny:   []string{"tracker.net"},
+	})
+
+	entries := []accesslog.Entry{
+		{URL: "http://www.example.com/a", Result: "TCP_HIT", Bytes: 100},
+		{URL: "http://cdn.example.com/b", Result: "TCP_MISS", Bytes: 300},
+		{URL: "mail.example.org:443", Result: "TCP_TUNNEL", Bytes: 10},
+		{URL: "http://www.example.org/", Result: "TCP_MISS", Bytes: 50},
+		{URL: "http://a.tracker.net/pixel", Result: "TCP_MISS", Bytes: 1000},
+	}
+	for i := range entries {
+		td.Handle(&entries[i])
+	}
+
+	expected := `
+# HELP squid_top_domains_bytes Bytes transferred from the busiest destination domains over the last 1m0s
+# TYPE squid_top_domains_bytes gauge
+squid_top_domains_bytes{domain="example.com"} 400
+squid_top_domains_bytes{domain="mail.example.org"} 10
+squid_top_domains_bytes{domain="other"} 1050
+# HELP squid_top_domains_hits Cache hits for the busiest destination domains over the last 1m0s
+# TYPE squid_top_domains_hits gauge
+squid_top_domains_hits{domain="example.com"} 1
+squid_top_domains_hits{domain="mail.example.org"} 0
+squid_top_domains_hits{domain="other"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(td, strings.NewReader(expected), "squid_top_domains_bytes", "squid_top_domains_hits"))
+}
@@ -0,0 +1,345 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/boynux/squid-exporter/accesslog"
+	"github.com/boynux/squid-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	TopTalkersSourceAccessLog  = "accesslog"
+	TopTalkersSourceClientList = "client_list"
+
+	otherLabel = "other"
+
+	// windowSlots is the number of slots the sliding window is split into
+	windowSlots = 12
+	// maxTrackedKeys bounds the memory used per slot, extra keys are rolled into other
+	maxTrackedKeys = 10000
+)
+
+type talkerStats struct {
+	requests float64
+	bytes    float64
+	hits     float64
+	misses   float64
+}
+
+func (s *talkerStats) merge(o *talkerStats) {
+	s.requests += o.requests
+	s.bytes += o.bytes
+	s.hits += o.hits
+	s.misses += o.misses
+}
+
+type talkerSlot struct {
+	start time.Time
+	stats map[string]*talkerStats
+}
+
+// talkerWindow accumulates per key traffic over a sliding window
+type talkerWindow struct {
+	slots []talkerSlot
+	width time.Duration
+}
+
+func newTalkerWindow(window time.Duration) *talkerWindow {
+	width := window / windowSlots
+	if width < time.Second {
+		width = time.Second
+	}
+
+	return &talkerWindow{
+		slots: make([]talkerSlot, windowSlots),
+		width: width,
+	}
+}
+
+func (w *talkerWindow) add(now time.Time, key string, delta talkerStats) {
+	start := now.Truncate(w.width)
+	slot := &w.slots[(start.UnixNano()/int64(w.width))%int64(len(w.slots))]
+
+	if !slot.start.Equal(start) {
+		slot.start = start
+		slot.stats = map[string]*talkerStats{}
+	}
+
+	s, ok := slot.stats[key]
+	if !ok {
+		if len(slot.stats) >= maxTrackedKeys {
+			key = otherLabel
+		}
+		if s, ok = slot.stats[key]; !ok {
+			s = &talkerStats{}
+			slot.stats[key] = s
+		}
+	}
+
+	s.merge(&delta)
+}
+
+func (w *talkerWindow) sum(now time.Time) map[string]*talkerStats {
+	oldest := now.Truncate(w.width).Add(-w.width * time.Duration(len(w.slots)-1))
+	total := map[string]*talkerStats{}
+
+	for _, slot := range w.slots {
+		if slot.stats == nil || slot.start.Before(oldest) {
+			continue
+		}
+		for k, v := range slot.stats {
+			if _, ok := total[k]; !ok {
+				total[k] = &talkerStats{}
+			}
+			total[k].merge(v)
+		}
+	}
+
+	return total
+}
+
+type rankedTalker struct {
+	key string
+	talkerStats
+}
+
+// topTalkers returns the count biggest entries by bytes then requests, with
+// the remaining ones rolled into a single other entry. Pinned keys are always
+// returned and do not count towards count.
+func topTalkers(stats map[string]*talkerStats, count int, pinned map[string]bool) []rankedTalker {
+	ranked := make([]rankedTalker, 0, len(stats))
+	var always []rankedTalker
+	other := rankedTalker{key: otherLabel}
+
+	for k, v := range stats {
+		switch {
+		case k == otherLabel:
+			other.merge(v)
+		case pinned[k]:
+			always = append(always, rankedTalker{k, *v})
+		default:
+			ranked = append(ranked, rankedTalker{k, *v})
+		}
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].bytes != ranked[j].bytes {
+			return ranked[i].bytes > ranked[j].bytes
+		}
+		if ranked[i].requests != ranked[j].requests {
+			return ranked[i].requests > ranked[j].requests
+		}
+		return ranked[i].key < ranked[j].key
+	})
+
+	if len(ranked) > count {
+		for _, r := range ranked[count:] {
+			other.merge(&r.talkerStats)
+		}
+		ranked = ranked[:count]
+	}
+
+	sort.Slice(always, func(i, j int) bool { return always[i].key < always[j].key })
+	ranked = append(ranked, always...)
+
+	if other.requests > 0 || other.bytes > 0 {
+		ranked = append(ranked, other)
+	}
+
+	return ranked
+}
+
+/*TopTalkersConfig configures the per client and per user top-N aggregation */
+type TopTalkersConfig struct {
+	Source     string
+	Count      int
+	Window     time.Duration
+	IPv4Prefix int
+	IPv6Prefix int
+	HashUsers  bool
+	HashKey    string
+	Labels     config.Labels
+}
+
+/*TopTalkers exports traffic of the busiest clients and users over a sliding window */
+type TopTalkers struct {
+	cfg     TopTalkersConfig
+	client  ClientListClient
+	now     func() time.Time
+	hashKey []byte
+
+	mu       sync.Mutex
+	clients  *talkerWindow
+	users    *talkerWindow
+	previous map[string]float64
+
+	clientRequests *prometheus.Desc
+	clientBytes    *prometheus.Desc
+	userRequests   *prometheus.Desc
+	userBytes      *prometheus.Desc
+}
+
+/*NewTopTalkers creates a top-N aggregator, client is only used with the client_list source */
+func NewTopTalkers(c *TopTalkersConfig, client ClientListClient) *TopTalkers {
+	window := c.Window.String()
+	clientLabels := append([]string{"client"}, c.Labels.Keys...)
+	userLabels := append([]string{"user"}, c.Labels.Keys...)
+
+	return &TopTalkers{
+		cfg:     *c,
+		client:  client,
+		now:     time.Now,
+		hashKey: userHashKey(c),
+		clients: newTalkerWindow(c.Window),
+		users:   newTalkerWindow(c.Window),
+
+		clientRequests: prometheus.NewDesc(prometheus.BuildFQName(namespace, "top_clients", "requests"),
+			"Requests made by the busiest clients over the last "+window, clientLabels, nil),
+		clientBytes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "top_clients", "bytes"),
+			"Bytes transferred to the busiest clients over the last "+window, clientLabels, nil),
+		userRequests: prometheus.NewDesc(prometheus.BuildFQName(namespace, "top_users", "requests"),
+			"Requests made by the busiest users over the last "+window, userLabels, nil),
+		userBytes: prometheus.NewDesc(prometheus.BuildFQName(namespace, "top_users", "bytes"),
+			"Bytes transferred to the busiest users over the last "+window, userLabels, nil),
+	}
+}
+
+/*Handle accounts an access log entry, it implements accesslog.Handler */
+func (t *TopTalkers) Handle(e *accesslog.Entry) {
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delta := talkerStats{requests: 1, bytes: float64(e.Bytes)}
+
+	t.clients.add(now, aggregateAddress(e.Client, t.cfg.IPv4Prefix, t.cfg.IPv6Prefix), delta)
+	if e.HasUser() {
+		t.users.add(now, t.userKey(e.User), delta)
+	}
+}
+
+func (t *TopTalkers) userKey(user string) string {
+	if !t.cfg.HashUsers {
+		return user
+	}
+
+	mac := hmac.New(sha256.New, t.hashKey)
+	mac.Write([]byte(user))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// userHashKey returns the configured key usernames are hashed with. A plain
+// hash of a username is reversed by hashing a list of likely names, so without
+// a configured key a random one is used for the lifetime of the process.
+func userHashKey(c *TopTalkersConfig) []byte {
+	if !c.HashUsers {
+		return nil
+	}
+	if c.HashKey != "" {
+		return []byte(c.HashKey)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Could not generate a key to hash usernames: %v", err)
+	}
+
+	return key
+}
+
+// refreshClientList accounts the requests made since the previous client_list fetch
+func (t *TopTalkers) refreshClientList() {
+	clients, err := t.client.GetClientList()
+	if err != nil {
+		log.Println("Could not fetch client list from squid instance: ", err)
+		return
+	}
+
+	now := t.now()
+	current := map[string]float64{}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, c := range clients {
+		current[c.Address] = c.HTTPRequests
+
+		// Counters of a client start over when squid forgets about it.
+		delta := c.HTTPRequests
+		if prev, ok := t.previous[c.Address]; ok && prev <= c.HTTPRequests {
+			delta = c.HTTPRequests - prev
+		}
+
+		// The first fetch only establishes the baseline.
+		if t.previous != nil && delta > 0 {
+			t.clients.add(now, aggregateAddress(c.Address, t.cfg.IPv4Prefix, t.cfg.IPv6Prefix), talkerStats{requests: delta})
+		}
+	}
+
+	t.previous = current
+}
+
+/*Describe implements prometheus.Collector */
+func (t *TopTalkers) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.clientRequests
+	ch <- t.clientBytes
+	ch <- t.userRequests
+	ch <- t.userBytes
+}
+
+/*Collect implements prometheus.Collector */
+func (t *TopTalkers) Collect(ch chan<- prometheus.Metric) {
+	if t.cfg.Source == TopTalkersSourceClientList {
+		t.refreshClientList()
+	}
+
+	now := t.now()
+
+	t.mu.Lock()
+	clients := topTalkers(t.clients.sum(now), t.cfg.Count, nil)
+	users := topTalkers(t.users.sum(now), t.cfg.Count, nil)
+	t.mu.Unlock()
+
+	for _, c := range clients {
+		labels := append([]string{c.key}, t.cfg.Labels.Values...)
+		ch <- prometheus.MustNewConstMetric(t.clientRequests, prometheus.GaugeValue, c.requests, labels...)
+		ch <- prometheus.MustNewConstMetric(t.clientBytes, prometheus.GaugeValue, c.bytes, labels...)
+	}
+
+	for _, u := range users {
+		labels := append([]string{u.key}, t.cfg.Labels.Values...)
+		ch <- prometheus.MustNewConstMetric(t.userRequests, prometheus.GaugeValue, u.requests, labels...)
+		ch <- prometheus.MustNewConstMetric(t.userBytes, prometheus.GaugeValue, u.bytes, labels...)
+	}
+}
+
+// aggregateAddress collapses an IP address into its network prefix, anything
+// that is not an IP address (e.g. with log_fqdn on) is returned as is.
+func aggregateAddress(addr string, v4Prefix, v6Prefix int) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return addr
+	}
+
+	bits, prefix := 128, v6Prefix
+	if v4 := ip.To4(); v4 != nil {
+		ip, bits, prefix = v4, 32, v4Prefix
+	}
+
+	if prefix <= 0 || prefix >= bits {
+		return ip.String()
+	}
+
+	return ip.Mask(net.CIDRMask(prefix, bits)).String() + "/" + strconv.Itoa(prefix)
+}
@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/accesslog"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockClientListClient struct {
+	clients types.ClientInfos
+}
+
+func (m *mockClientListClient) GetClientList() (types.ClientInfos, error) {
+	return m.clients, nil
+}
+
+func TestAggregateAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		v4   int
+		v6   int
+		want string
+	}{
+		{"192.168.1.77", 24, 64, "192.168.1.0/24"},
+		{"192.168.1.77", 32, 64, "192.168.1.77"},
+		{"2001:db8:1:2:3::4", 24, 64, "2001:db8:1:2::/64"},
+		{"client.example.com", 24, 64, "client.example.com"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, aggregateAddress(tc.addr, tc.v4, tc.v6))
+	}
+}
+
+func TestTalkerWindowExpires(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	w := newTalkerWindow(time.Minute)
+
+	w.add(now, "a", talkerStats{requests: 1, bytes: 100})
+	w.add(now.Add(30*time.Second), "a", talkerStats{requests: 1, bytes: 100})
+	assert.Equal(t, float64(2), w.sum(now.Add(30 * time.Second))["a"].requests)
+
+	sum := w.sum(now.Add(2 * time.Minute))
+	assert.NotContains(t, sum, "a")
+}
+
+func TestTopTalkersRollsIntoOther(t *testing.T) {
+	stats := map[string]*talkerStats{
+		"a": {requests: 1, bytes: 300},
+		"b": {requests: 5, bytes: 200},
+		"c": {requests: 2, bytes: 100},
+	}
+
+	ranked := topTalkers(stats, 2, nil)
+
+	assert.Equal(t, []rankedTalker{
+		{"a", talkerStats{requests: 1, bytes: 300}},
+		{"b", talkerStats{requests: 5, bytes: 200}},
+		{"other", talkerStats{requests: 2, bytes: 100}},
+	}, ranked)
+
+	ranked = topTalkers(stats, 1, map[string]bool{"c": true})
+
+	assert.Equal(t, []rankedTalker{
+		{"a", talkerStats{requests: 1, bytes: 300}},
+		{"c", talkerStats{requests: 2, bytes: 100}},
+		{"other", talkerStats{requests: 5, bytes: 200}},
+	}, ranked)
+}
+
+func TestTopTalkersCollectAccessLog(t *testing.T) {
+	tt := NewTopTalkers(&TopTalkersConfig{
+		Source:     TopTalkersSourceAccessLog,
+		Count:      1,
+		Window:     time.Minute,
+		IPv4Prefix: 24,
+		HashUsers:  true,
+		HashKey:    "secret",
+	}, nil)
+
+	tt.Handle(&accesslog.Entry{Client: "10.0.0.1", User: "alice", Bytes: 10})
+	tt.Handle(&accesslog.Entry{Client: "10.0.0.2", User: "-", Bytes: 20})
+	tt.Handle(&accesslog.Entry{Client: "10.0.1.1", User: "-", Bytes: 5})
+
+	expected := `
+# HELP squid_top_clients_bytes Bytes transferred to the busiest clients over the last 1m0s
+# TYPE squid_top_clients_bytes gauge
+squid_top_clients_bytes{client="10.0.0.0/24"} 30
+squid_top_clients_bytes{client="other"} 5
+`
+	assert.NoError(t, testutil.CollectAndCompare(tt, strings.NewReader(expected), "squid_top_clients_bytes"))
+
+	expected = `
+# HELP squid_top_users_requests Requests made by the busiest users over the last 1m0s
+# TYPE squid_top_users_requests gauge
+squid_top_users_requests{user="4360c67bc8102511"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(tt, strings.NewReader(expected), "squid_top_users_requests"))
+}
+
+func TestTopTalkersCollectClientList(t *testing.T) {
+	client := &mockClientListClient{clients: types.ClientInfos{
+		{Address: "10.0.0.1", HTTPRequests: 100},
+	}}
+	tt := NewTopTalkers(&TopTalkersConfig{
+		Source: TopTalkersSourceClientList,
+		Count:  5,
+		Window: time.Minute,
+	}, client)
+
+	tt.refreshClientList()
+	client.clients = types.ClientInfos{
+		{Address: "10.0.0.1", HTTPRequests: 130},
+		{Address: "10.0.0.2", HTTPRequests: 4},
+	}
+
+	expected := `
+# HELP squid_top_clients_requests Requests made by the busiest clients over the last 1m0s
+# TYPE squid_top_clients_requests gauge
+squid_top_clients_requests{client="10.0.0.1"} 30
+squid_top_clients_requests{client="10.0.0.2"} 4
+`
+	assert.NoError(t, testutil.CollectAndCompare(tt, strings.NewReader(expected), "squid_top_clients_requests"))
+}
+
+func TestTopTalkersUserKeyWithoutHashKey(t *testing.T) {
+	a := NewTopTalkers(&TopTalkersConfig{HashUsers: true}, nil)
+	b := NewTopTalkers(&TopTalkersConfig{HashUsers: true}, nil)
+
+	assert.Equal(t, a.userKey("alice"), a.userKey("alice"))
+	assert.NotEqual(t, a.userKey("alice"), b.userKey("alice"))
+	assert.Equal(t, "alice", NewTopTalkers(&TopTalkersConfig{}, nil).userKey("alice"))
+}
@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockVersionClient struct {
+	mockSquidClient
+	version    string
+	server     string
+	infoCalls  int
+	serverRead int
+}
+
+func (m *mockVersionClient) GetInfos() (types.Counters, error) {
+	m.infoCalls++
+
+	info := types.Counter{Key: "squid_info", Value: 1}
+	if m.version != "" {
+		info.VarLabels = append(info.VarLabels, types.VarLabel{Key: "Squid_Object_Cache_Version", Value: m.version})
+	}
+
+	return types.Counters{info}, m.err
+}
+
+func (m *mockVersionClient) ServerVersion() string {
+	m.serverRead++
+	return m.server
+}
+
+func TestExporterVersion(t *testing.T) {
+	tests := []struct {
+		version   string
+		server    string
+		expected  string
+		supported string
+	}{
+		{"6.1", "", "6.1", "1"},
+		{"4.0.21-20170621-r2", "", "4.0.21-20170621-r2", "1"},
+		{"3.5.27", "", "3.5.27", "1"},
+		{"", "squid/5.7", "5.7", "1"},
+		{"2.7.STABLE9", "", "unknown", "0"},
+		{"9.0", "", "9.0", "0"},
+	}
+
+	for _, tc := range tests {
+		client := &mockVersionClient{version: tc.version, server: tc.server}
+		e := New(&CollectorConfig{Hostname: "localhost", Labels: config.Labels{}})
+		e.client = client
+
+		expected := `
+# HELP squid_version_info Squid version read from the info page or the Server header
+# TYPE squid_version_info gauge
+squid_version_info{version="` + tc.expected + `"} 1
+# HELP squid_version_supported Is the squid version supported by the exporter? Metrics of unsupported versions may be missing
+# TYPE squid_version_supported gauge
+squid_version_supported ` + tc.supported + `
+`
+		assert.NoError(t, testutil.GatherAndCompare(newRegistry(e), strings.NewReader(expected), "squid_version_info", "squid_version_supported"), tc.version)
+
+		// The version is taken from the info page of every scrape
+		_, err := newRegistry(e).Gather()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, client.infoCalls, tc.version)
+		if tc.server != "" {
+			assert.Equal(t, 2, client.serverRead, tc.version)
+		}
+	}
+}
+
+func TestExporterVersionChange(t *testing.T) {
+	client := &mockVersionClient{version: "5.9"}
+	e := New(&CollectorConfig{Hostname: "localhost", Labels: config.Labels{}})
+	e.client = client
+
+	expected := func(version string) string {
+		return `
+# HELP squid_version_info Squid version read from the info page or the Server header
+# TYPE squid_version_info gauge
+squid_version_info{version="` + version + `"} 1
+`
+	}
+	assert.NoError(t, testutil.GatherAndCompare(newRegistry(e), strings.NewReader(expected("5.9")), "squid_version_info"))
+
+	// An upgraded squid is noticed on the next scrape
+	client.version = "6.10"
+	assert.NoError(t, testutil.GatherAndCompare(newRegistry(e), strings.NewReader(expected("6.10")), "squid_version_info"))
+
+	// Without a version in the info page the Server header is used
+	client.version, client.server = "", "squid/7.1"
+	assert.NoError(t, testutil.GatherAndCompare(newRegistry(e), strings.NewReader(expected("7.1")), "squid_version_info"))
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/boynux/squid-exporter/collector"
+	"github.com/boynux/squid-exporter/squidtest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	commandDump    = "dump"
+	commandParse   = "parse"
+	commandMetrics = "metrics"
+)
+
+func init() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags] [command] [flags]\n\n", os.Args[0])
+		fmt.Fprintln(out, "Commands, without one the exporter is served:")
+		fmt.Fprintln(out, "  dump <page>   print a cache manager page as squid sends it")
+		fmt.Fprintln(out, "  parse <page>  print the values the exporter decodes from a page as JSON")
+		fmt.Fprintln(out, "  metrics       print the metrics of one scrape, exits non-zero when it fails")
+		fmt.Fprintln(out, "\nFlags, before or after the command:")
+		flag.PrintDefaults()
+	}
+}
+
+// pageParser decodes a page with the client the exporter uses for it
+type pageParser func(cor *collector.CacheObjectRequest, page string) (interface{}, error)
+
+// pageParsers are the pages the parse command knows
+var pageParsers = map[string]pageParser{
+	"counters": func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetCounters()
+	},
+	"info": func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetInfos()
+	},
+	"service_times": func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetServiceTimes()
+	},
+	"mem": func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheMemoryClient(cor).GetMems()
+	},
+	"client_list": func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetClientList()
+	},
+	"delay": func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetDelayPools()
+	},
+	"events": func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetEvents()
+	},
+	"adaptation": func(cor *collector.CacheObjectRequest, page string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetAdaptationServices(page)
+	},
+	collector.StoreIOSection: func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetStoreIO()
+	},
+	collector.IOSection: func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetIO()
+	},
+	collector.DiskdSection: func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetDiskd()
+	},
+	collector.AIOCountsSection: func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetAIOCounts()
+	},
+	collector.StoreDigestSection: func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetStoreDigest()
+	},
+	collector.RefreshSection: func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetRefresh()
+	},
+	collector.ForwardSection: func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetForward()
+	},
+	collector.HTTPHeadersSection: func(cor *collector.CacheObjectRequest, _ string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetHTTPHeaders()
+	},
+	collector.ViaHeadersSection: func(cor *collector.CacheObjectRequest, page string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetHeaderValues(page)
+	},
+	collector.ForwHeadersSection: func(cor *collector.CacheObjectRequest, page string) (interface{}, error) {
+		return collector.NewCacheObjectClient(cor).GetHeaderValues(page)
+	},
+}
+
+// helperPage tells helper pages apart, they are named after the helper program, e.g. sslcrtd_program
+func helperPage(page string) bool {
+	return strings.HasSuffix(page, "_program")
+}
+
+// checkCommand validates the command and the arguments given after the flags
+func checkCommand(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	switch args[0] {
+	case commandDump:
+		if len(args) != 2 {
+			return errors.New("usage: dump <page>")
+		}
+	case commandParse:
+		if len(args) != 2 {
+			return errors.New("usage: parse <page>")
+		}
+		if _, ok := pageParsers[args[1]]; !ok && !helperPage(args[1]) {
+			var pages []string
+			for page := range pageParsers {
+				pages = append(pages, page)
+			}
+			sort.Strings(pages)
+			return fmt.Errorf("no parser for page %q, known pages are %s and helper pages like sslcrtd_program", args[1], strings.Join(pages, ", "))
+		}
+	case commandMetrics:
+		if len(args) != 1 {
+			return errors.New("usage: metrics")
+		}
+	default:
+		return fmt.Errorf("unknown command %q, commands are dump, parse and metrics", args[0])
+	}
+
+	return nil
+}
+
+// runDump writes page to w as squid sent it, or with its addresses and host
+// names masked when scrub is set
+func runDump(w io.Writer, cor *collector.CacheObjectRequest, page string, scrub bool) error {
+	body, err := collector.NewCacheObjectClient(cor).Fetch(page)
+	if err != nil {
+		return fmt.Errorf("error getting %s: %v", page, err)
+	}
+	defer body.Close()
+
+	if !scrub {
+		_, err = io.Copy(w, body)
+		return err
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, squidtest.Scrub(string(content)))
+	return err
+}
+
+// runParse writes the values decoded from page to w as JSON
+func runParse(w io.Writer, cor *collector.CacheObjectRequest, page string) error {
+	parse, ok := pageParsers[page]
+	if !ok && helperPage(page) {
+		parse = func(cor *collector.CacheObjectRequest, page string) (interface{}, error) {
+			return collector.NewCacheObjectClient(cor).GetHelperStats(page)
+		}
+	}
+	if parse == nil {
+		return fmt.Errorf("no parser for page %q", page)
+	}
+
+	values, err := parse(cor, page)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(values)
+}
+
+// runMetrics writes the metrics of one scrape of collectors to w. It fails
+// when squid could not be reached, a page could not be fetched or a page
+// could not be parsed.
+func runMetrics(w io.Writer, collectors ...prometheus.Collector) error {
+	registry := prometheus.NewRegistry()
+	for _, c := range collectors {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+
+	families, err := registry.Gather()
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, mf := range families {
+		var sum float64
+		var failedPages []string
+		for _, m := range mf.GetMetric() {
+			sum += m.GetGauge().GetValue() + m.GetCounter().GetValue()
+
+			if mf.GetName() == "squid_exporter_page_up" && m.GetGauge().GetValue() == 0 {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "page" {
+						failedPages = append(failedPages, l.GetValue())
+					}
+				}
+			}
+		}
+
+		switch {
+		case mf.GetName() == "squid_up" && sum < float64(len(mf.GetMetric())):
+			errs = append(errs, errors.New("squid could not be scraped"))
+		case len(failedPages) > 0:
+			errs = append(errs, fmt.Errorf("squid pages could not be fetched: %s", strings.Join(failedPages, ", ")))
+		case mf.GetName() == "squid_exporter_parse_failures_total" && sum > 0:
+			errs = append(errs, errors.New("squid pages could not be parsed"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
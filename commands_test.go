@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/collector"
+	"github.com/boynux/squid-exporter/config"
+	"github.com/boynux/squid-exporter/squidtest"
+	"github.com/boynux/squid-exporter/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCommandSquid(t *testing.T) (*squidtest.Server, *collector.CacheObjectRequest) {
+	s, err := squidtest.NewFixtureServer("6.10")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { s.Close() })
+
+	s.SetAuth("manager", "secret")
+	return s, &collector.CacheObjectRequest{Hostname: s.Hostname(), Port: s.Port(), Login: "manager", Password: "secret"}
+}
+
+func TestCheckCommand(t *testing.T) {
+	assert.NoError(t, checkCommand(nil))
+	assert.NoError(t, checkCommand([]string{"dump", "info"}))
+	assert.NoError(t, checkCommand([]string{"parse", "counters"}))
+	assert.NoError(t, checkCommand([]string{"parse", "sslcrtd_program"}))
+	assert.NoError(t, checkCommand([]string{"metrics"}))
+
+	assert.EqualError(t, checkCommand([]string{"dump"}), "usage: dump <page>")
+	assert.EqualError(t, checkCommand([]string{"metrics", "info"}), "usage: metrics")
+	assert.EqualError(t, checkCommand([]string{"serve"}), `unknown command "serve", commands are dump, parse and metrics`)
+	assert.Contains(t, checkCommand([]string{"parse", "objects"}).Error(), `no parser for page "objects", known pages are adaptation, client_list,`)
+}
+
+func TestRunDump(t *testing.T) {
+	_, cor := newCommandSquid(t)
+	pages, _ := squidtest.Fixture("6.10")
+
+	var out bytes.Buffer
+	assert.NoError(t, runDump(&out, cor, "info", false))
+	assert.Equal(t, pages["info"].Body, out.String())
+
+	out.Reset()
+	assert.NoError(t, runDump(&out, cor, "client_list", true))
+	assert.Equal(t, squidtest.Scrub(pages["client_list"].Body), out.String())
+	assert.NotContains(t, out.String(), "192.168.0.10")
+
+	cor.Password = "wrong"
+	assert.EqualError(t, runDump(&out, cor, "info", false), "error getting info: Non success code 401 while fetching metrics")
+}
+
+func TestRunParse(t *testing.T) {
+	_, cor := newCommandSquid(t)
+
+	var out bytes.Buffer
+	assert.NoError(t, runParse(&out, cor, "events"))
+
+	var events types.EventQueue
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &events))
+	assert.Equal(t, "storeDirClean", events.LastRun)
+	assert.Len(t, events.Events, 4)
+
+	out.Reset()
+	assert.NoError(t, runParse(&out, cor, "sslcrtd_program"))
+	assert.Contains(t, out.String(), `"Program": "/usr/lib/squid/security_file_certgen"`)
+
+	assert.EqualError(t, runParse(&out, cor, "objects"), `no parser for page "objects"`)
+}
+
+func TestRunMetrics(t *testing.T) {
+	s, cor := newCommandSquid(t)
+	newExporter := func() *collector.Exporter {
+		return collector.New(&collector.CollectorConfig{
+			Hostname: s.Hostname(),
+			Port:     s.Port(),
+			Login:    cor.Login,
+			Password: cor.Password,
+			Labels:   config.Labels{},
+		})
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, runMetrics(&out, newExporter(), collector.NewParseFailures(config.Labels{})))
+	assert.Contains(t, out.String(), "squid_client_http_requests_total 48000\n")
+	assert.Contains(t, out.String(), `squid_up{host="127.0.0.1"} 1`)
+
+	s.SetPage("counters", squidtest.Page{Status: 500})
+	out.Reset()
+	assert.EqualError(t, runMetrics(&out, newExporter()), "squid could not be scraped")
+	assert.True(t, strings.Contains(out.String(), `squid_up{host="127.0.0.1"} 0`), out.String())
+}
+
+func TestRunMetricsPageFailure(t *testing.T) {
+	s, cor := newCommandSquid(t)
+	events := collector.NewEventsCollector(config.Labels{}, collector.NewCacheObjectClient(cor))
+
+	var out bytes.Buffer
+	assert.NoError(t, runMetrics(&out, events))
+
+	// A collector failing to fetch its page fails the command as well
+	s.SetPage("events", squidtest.Page{Status: 500})
+	out.Reset()
+	assert.EqualError(t, runMetrics(&out, events), "squid pages could not be fetched: events")
+	assert.Contains(t, out.String(), `squid_exporter_page_up{page="events"} 0`)
+}
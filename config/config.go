@@ -7,23 +7,50 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	defaultListenAddress       = "127.0.0.1:9301"
-	defaultWebConfigPath       = ""
-	defaultListenPort          = 9301
-	defaultMetricsPath         = "/metrics"
-	defaultSquidHostname       = "localhost"
-	defaultSquidPort           = 3128
-	defaultExtractServiceTimes = true
-	defaultExtractMemPools     = true
-	defaultUseProxyHeader      = false
+	defaultListenAddress          = "127.0.0.1:9301"
+	defaultWebConfigPath          = ""
+	defaultListenPort             = 9301
+	defaultMetricsPath            = "/metrics"
+	defaultSquidHostname          = "localhost"
+	defaultSquidPort              = 3128
+	defaultExtractServiceTimes    = true
+	defaultExtractMemPools        = true
+	defaultUseProxyHeader         = false
+	defaultProxyHeaderVersion     = 1
+	defaultHealthInterval         = 0
+	defaultReadyWindow            = 2 * time.Minute
+	defaultScrapeMaxStale         = 5 * time.Minute
+	defaultTopTalkersSource       = "accesslog"
+	defaultTopTalkersCount        = 10
+	defaultTopTalkersWindow       = 5 * time.Minute
+	defaultTopTalkersIPv4Mask     = 32
+	defaultTopTalkersIPv6Mask     = 64
+	defaultTLSHelper              = "sslcrtd_program"
+	defaultAdaptationPage         = "adaptation"
+	defaultObjectsMaxLines        = 100000
+	defaultForwardMaxHeaderValues = 20
+	defaultProbeTimeout           = 10 * time.Second
+	defaultRetries                = 2
+	defaultRetryBackoff           = 100 * time.Millisecond
+	defaultBreakerThreshold       = 5
+	defaultBreakerCooldown        = 30 * time.Second
+	defaultKeepAliveMaxIdle       = 4
+	defaultKeepAliveIdleTimeout   = 30 * time.Second
+	defaultMaxConnections         = 8
 )
 
 const (
 	squidExporterListenKey        = "SQUID_EXPORTER_LISTEN"
 	squidExporterWebConfigPathKey = "SQUID_EXPORTER_WEB_CONFIG_PATH"
+	squidExporterSystemdSocketKey = "SQUID_EXPORTER_SYSTEMD_SOCKET"
+	squidExporterHealthInterval   = "SQUID_EXPORTER_HEALTH_INTERVAL"
+	squidExporterReadyWindow      = "SQUID_EXPORTER_READY_WINDOW"
+	squidExporterScrapeInterval   = "SQUID_EXPORTER_SCRAPE_INTERVAL"
+	squidExporterScrapeMaxStale   = "SQUID_EXPORTER_SCRAPE_MAX_STALE"
 	squidExporterMetricsPathKey   = "SQUID_EXPORTER_METRICS_PATH"
 	squidHostnameKey              = "SQUID_HOSTNAME"
 	squidPortKey                  = "SQUID_PORT"
@@ -33,6 +60,62 @@ const (
 	squidExtractServiceTimes      = "SQUID_EXTRACTSERVICETIMES"
 	squidExtractMemPools          = "SQUID_EXTRACTMEMPOOLS"
 	squidUseProxyHeader           = "SQUID_USE_PROXY_HEADER"
+	squidProxyHeaderVersion       = "SQUID_PROXY_HEADER_VERSION"
+	squidProxyHeaderSource        = "SQUID_PROXY_HEADER_SOURCE"
+	squidProxyHeaderDestination   = "SQUID_PROXY_HEADER_DESTINATION"
+	squidProxyHeaderTLVs          = "SQUID_PROXY_HEADER_TLVS"
+	squidRetries                  = "SQUID_RETRIES"
+	squidRetryBackoff             = "SQUID_RETRY_BACKOFF"
+	squidBreakerThreshold         = "SQUID_BREAKER_THRESHOLD"
+	squidBreakerCooldown          = "SQUID_BREAKER_COOLDOWN"
+	squidKeepAliveMaxIdle         = "SQUID_KEEP_ALIVE_MAX_IDLE"
+	squidKeepAliveIdleTimeout     = "SQUID_KEEP_ALIVE_IDLE_TIMEOUT"
+	squidMaxConnections           = "SQUID_MAX_CONNECTIONS"
+	squidAccessLog                = "SQUID_ACCESS_LOG"
+	squidTopTalkers               = "SQUID_TOP_TALKERS"
+	squidTopTalkersSource         = "SQUID_TOP_TALKERS_SOURCE"
+	squidTopTalkersCount          = "SQUID_TOP_TALKERS_COUNT"
+	squidTopTalkersWindow         = "SQUID_TOP_TALKERS_WINDOW"
+	squidTopTalkersIPv4Prefix     = "SQUID_TOP_TALKERS_IPV4_PREFIX"
+	squidTopTalkersIPv6Prefix     = "SQUID_TOP_TALKERS_IPV6_PREFIX"
+	squidTopTalkersHashUsers      = "SQUID_TOP_TALKERS_HASH_USERS"
+	squidTopTalkersHashKey        = "SQUID_TOP_TALKERS_HASH_KEY"
+	squidTopDomains               = "SQUID_TOP_DOMAINS"
+	squidTopDomainsCount          = "SQUID_TOP_DOMAINS_COUNT"
+	squidTopDomainsWindow         = "SQUID_TOP_DOMAINS_WINDOW"
+	squidTopDomainsAllow          = "SQUID_TOP_DOMAINS_ALLOW"
+	squidTopDomainsDeny           = "SQUID_TOP_DOMAINS_DENY"
+	squidClientList               = "SQUID_CLIENT_LIST"
+	squidClientListSubnets        = "SQUID_CLIENT_LIST_SUBNETS"
+	squidDelayPools               = "SQUID_DELAY_POOLS"
+	squidDelayPoolsMaxBuckets     = "SQUID_DELAY_POOLS_MAX_BUCKETS"
+	squidAccessLogExtraFields     = "SQUID_ACCESS_LOG_EXTRA_FIELDS"
+	squidTLS                      = "SQUID_TLS"
+	squidTLSHelpers               = "SQUID_TLS_HELPERS"
+	squidTLSCertDBPath            = "SQUID_TLS_CERTDB_PATH"
+	squidTLSCertDBMaxMiB          = "SQUID_TLS_CERTDB_MAX_SIZE_MB"
+	squidAdaptation               = "SQUID_ADAPTATION"
+	squidAdaptationPage           = "SQUID_ADAPTATION_PAGE"
+	squidStoreIOSections          = "SQUID_STORE_IO_SECTIONS"
+	squidObjectsPages             = "SQUID_OBJECTS_PAGES"
+	squidObjectsMaxLines          = "SQUID_OBJECTS_MAX_LINES"
+	squidStoreDigest              = "SQUID_STORE_DIGEST"
+	squidRefreshPatterns          = "SQUID_REFRESH_PATTERNS"
+	squidEvents                   = "SQUID_EVENTS"
+	squidForwardSections          = "SQUID_FORWARD_SECTIONS"
+	squidForwardHeaders           = "SQUID_FORWARD_HEADERS"
+	squidForwardMaxHeaderValues   = "SQUID_FORWARD_MAX_HEADER_VALUES"
+	squidProbeTargets             = "SQUID_PROBE_TARGETS"
+	squidProbeProxy               = "SQUID_PROBE_PROXY"
+	squidProbeTimeout             = "SQUID_PROBE_TIMEOUT"
+	squidProbeLogin               = "SQUID_PROBE_LOGIN"
+	squidProbePassword            = "SQUID_PROBE_PASSWORD"
+	squidProbeInsecure            = "SQUID_PROBE_INSECURE_SKIP_VERIFY"
+	squidAuthProbeSchemes         = "SQUID_AUTH_PROBE_SCHEMES"
+	squidAuthProbeTarget          = "SQUID_AUTH_PROBE_TARGET"
+	squidAuthProbeLogin           = "SQUID_AUTH_PROBE_LOGIN"
+	squidAuthProbePassword        = "SQUID_AUTH_PROBE_PASSWORD"
+	squidAuthProbeNegotiateCmd    = "SQUID_AUTH_PROBE_NEGOTIATE_COMMAND"
 )
 
 var (
@@ -44,9 +127,18 @@ type Labels struct {
 	Values []string
 }
 
+/*StringList is a flag that accepts comma separated values and can be repeated */
+type StringList []string
+
 /*Config configurations for exporter */
 type Config struct {
 	ListenAddress       string
+	ListenAddresses     StringList
+	SystemdSocket       bool
+	HealthInterval      time.Duration
+	ReadyWindow         time.Duration
+	ScrapeInterval      time.Duration
+	ScrapeMaxStale      time.Duration
 	WebConfigPath       string
 	MetricPath          string
 	Labels              Labels
@@ -60,6 +152,84 @@ type Config struct {
 	Pidfile       string
 
 	UseProxyHeader bool
+
+	ProxyHeaderVersion     int
+	ProxyHeaderSource      string
+	ProxyHeaderDestination string
+	ProxyHeaderTLVs        StringList
+
+	Retries          int
+	RetryBackoff     time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	KeepAliveMaxIdle     int
+	KeepAliveIdleTimeout time.Duration
+	MaxConnections       int
+
+	AccessLog            string
+	AccessLogExtraFields StringList
+
+	TopTalkers           bool
+	TopTalkersSource     string
+	TopTalkersCount      int
+	TopTalkersWindow     time.Duration
+	TopTalkersIPv4Prefix int
+	TopTalkersIPv6Prefix int
+	TopTalkersHashUsers  bool
+	TopTalkersHashKey    string
+
+	TopDomains       bool
+	TopDomainsCount  int
+	TopDomainsWindow time.Duration
+	TopDomainsAllow  StringList
+	TopDomainsDeny   StringList
+
+	ClientList        bool
+	ClientListSubnets StringList
+
+	DelayPools           bool
+	DelayPoolsMaxBuckets int
+
+	TLS             bool
+	TLSHelpers      StringList
+	TLSCertDBPath   string
+	TLSCertDBMaxMiB int
+
+	Adaptation     bool
+	AdaptationPage string
+
+	StoreIOSections StringList
+
+	ObjectsPages    StringList
+	ObjectsMaxLines int
+
+	StoreDigest     bool
+	RefreshPatterns bool
+
+	Events bool
+
+	ForwardSections        StringList
+	ForwardHeaders         StringList
+	ForwardMaxHeaderValues int
+
+	ProbeTargets       StringList
+	ProbeProxy         string
+	ProbeTimeout       time.Duration
+	ProbeLogin         string
+	ProbePassword      string
+	ProbeSkipTLSVerify bool
+
+	AuthProbeSchemes          StringList
+	AuthProbeTarget           string
+	AuthProbeLogin            string
+	AuthProbePassword         string
+	AuthProbeNegotiateCommand string
+
+	DumpScrub bool
+
+	// Args are the arguments left after the flags, the command and its page
+	Args []string
 }
 
 /*NewConfig creates a new config object from command line args */
@@ -68,6 +238,18 @@ func NewConfig() *Config {
 
 	flag.StringVar(&c.ListenAddress, "listen",
 		loadEnvStringVar(squidExporterListenKey, defaultListenAddress), "Address and Port to bind exporter, in host:port format")
+	flag.Var(&c.ListenAddresses, "web.listen-address",
+		"Addresses to bind exporter, in host:port format. Comma separated or repeated, overrides -listen")
+	flag.BoolVar(&c.SystemdSocket, "web.systemd-socket",
+		loadEnvBoolVar(squidExporterSystemdSocketKey, false), "Use systemd socket activation listeners instead of port listeners")
+	flag.DurationVar(&c.HealthInterval, "health.interval",
+		loadEnvDurationVar(squidExporterHealthInterval, defaultHealthInterval), "Interval of extra background checks of the squid cache manager, 0 takes readiness from the metrics scrapes only")
+	flag.DurationVar(&c.ReadyWindow, "health.ready-window",
+		loadEnvDurationVar(squidExporterReadyWindow, defaultReadyWindow), "The exporter is ready when the last successful check is at most this old")
+	flag.DurationVar(&c.ScrapeInterval, "scrape.interval",
+		loadEnvDurationVar(squidExporterScrapeInterval, 0), "Scrape squid in the background at this interval and serve cached metrics, 0 scrapes on every request")
+	flag.DurationVar(&c.ScrapeMaxStale, "scrape.max-stale",
+		loadEnvDurationVar(squidExporterScrapeMaxStale, defaultScrapeMaxStale), "How long the last good background scrape is served while squid fails")
 	flag.StringVar(&c.WebConfigPath, "web.config.file", loadEnvStringVar(squidExporterWebConfigPathKey, defaultWebConfigPath),
 		"Path to configuration file that can enable TLS or authentication. See: https://github.com/prometheus/exporter-toolkit/blob/master/docs/web-configuration.md")
 	flag.StringVar(&c.MetricPath, "metrics-path",
@@ -93,10 +275,161 @@ func NewConfig() *Config {
 
 	flag.BoolVar(&c.UseProxyHeader, "squid-use-proxy-header",
 		loadEnvBoolVar(squidUseProxyHeader, defaultUseProxyHeader), "Use proxy headers when fetching metrics")
+	flag.IntVar(&c.ProxyHeaderVersion, "squid-proxy-header.version",
+		loadEnvIntVar(squidProxyHeaderVersion, defaultProxyHeaderVersion), "PROXY protocol version of the proxy header, 1 or 2")
+	flag.StringVar(&c.ProxyHeaderSource, "squid-proxy-header.source",
+		loadEnvStringVar(squidProxyHeaderSource, ""), "Source address announced in the proxy header, in host:port format (default the listen address)")
+	flag.StringVar(&c.ProxyHeaderDestination, "squid-proxy-header.destination",
+		loadEnvStringVar(squidProxyHeaderDestination, ""), "Destination address announced in the proxy header, in host:port format (default the squid address)")
+	flag.Var(&c.ProxyHeaderTLVs, "squid-proxy-header.tlvs",
+		"TLVs added to a version 2 proxy header as type=value, the type is a number or one of alpn, authority, crc32c, noop, unique_id, netns. Comma separated or repeated")
+
+	flag.IntVar(&c.Retries, "squid-retry.attempts",
+		loadEnvIntVar(squidRetries, defaultRetries), "How often a failed connection to squid is retried within a scrape, 0 disables retries")
+	flag.DurationVar(&c.RetryBackoff, "squid-retry.backoff",
+		loadEnvDurationVar(squidRetryBackoff, defaultRetryBackoff), "Base delay before retrying, doubled for each further retry and jittered")
+	flag.IntVar(&c.BreakerThreshold, "squid-breaker.threshold",
+		loadEnvIntVar(squidBreakerThreshold, defaultBreakerThreshold), "Consecutive failed requests after which squid is not contacted for a while, 0 disables the circuit breaker")
+	flag.DurationVar(&c.BreakerCooldown, "squid-breaker.cooldown",
+		loadEnvDurationVar(squidBreakerCooldown, defaultBreakerCooldown), "How long the open circuit breaker rejects requests before trying squid again")
+	flag.IntVar(&c.KeepAliveMaxIdle, "squid-keep-alive.max-idle",
+		loadEnvIntVar(squidKeepAliveMaxIdle, defaultKeepAliveMaxIdle), "Idle connections to squid kept open for the next pages, 0 opens a new connection for every page")
+	flag.DurationVar(&c.KeepAliveIdleTimeout, "squid-keep-alive.idle-timeout",
+		loadEnvDurationVar(squidKeepAliveIdleTimeout, defaultKeepAliveIdleTimeout), "How long an idle connection to squid is kept open")
+	flag.IntVar(&c.MaxConnections, "squid-max-connections",
+		loadEnvIntVar(squidMaxConnections, defaultMaxConnections), "Connections to squid open at once, idle ones included, further requests wait for a free one. 0 does not limit them")
+
+	flag.StringVar(&c.AccessLog, "squid-access-log", loadEnvStringVar(squidAccessLog, ""),
+		"Optional path to the squid access log (native format) for log derived metrics")
+	flag.Var(&c.AccessLogExtraFields, "squid-access-log.extra-fields",
+		"Names of the fields a custom logformat appends to the native format, in order, e.g. ssl_bump_mode,tls_error")
+
+	flag.BoolVar(&c.TopTalkers, "top-talkers",
+		loadEnvBoolVar(squidTopTalkers, false), "Export traffic of the busiest clients and users")
+	flag.StringVar(&c.TopTalkersSource, "top-talkers.source",
+		loadEnvStringVar(squidTopTalkersSource, defaultTopTalkersSource), "Source of top talkers data, either accesslog or client_list")
+	flag.IntVar(&c.TopTalkersCount, "top-talkers.count",
+		loadEnvIntVar(squidTopTalkersCount, defaultTopTalkersCount), "Number of clients and users exported, the rest is reported as other")
+	flag.DurationVar(&c.TopTalkersWindow, "top-talkers.window",
+		loadEnvDurationVar(squidTopTalkersWindow, defaultTopTalkersWindow), "Sliding window top talkers are computed over")
+	flag.IntVar(&c.TopTalkersIPv4Prefix, "top-talkers.ipv4-prefix",
+		loadEnvIntVar(squidTopTalkersIPv4Prefix, defaultTopTalkersIPv4Mask), "Prefix length IPv4 clients are aggregated to")
+	flag.IntVar(&c.TopTalkersIPv6Prefix, "top-talkers.ipv6-prefix",
+		loadEnvIntVar(squidTopTalkersIPv6Prefix, defaultTopTalkersIPv6Mask), "Prefix length IPv6 clients are aggregated to")
+	flag.BoolVar(&c.TopTalkersHashUsers, "top-talkers.hash-users",
+		loadEnvBoolVar(squidTopTalkersHashUsers, false), "Replace usernames with an HMAC-SHA256 of them, keyed with -top-talkers.hash-key")
+	flag.StringVar(&c.TopTalkersHashKey, "top-talkers.hash-key",
+		loadEnvStringVar(squidTopTalkersHashKey, ""), "Secret key usernames are hashed with, a random key is used when empty and hashes change on restart")
+
+	flag.BoolVar(&c.TopDomains, "top-domains",
+		loadEnvBoolVar(squidTopDomains, false), "Export traffic of the busiest destination domains")
+	flag.IntVar(&c.TopDomainsCount, "top-domains.count",
+		loadEnvIntVar(squidTopDomainsCount, defaultTopTalkersCount), "Number of domains exported, the rest is reported as other")
+	flag.DurationVar(&c.TopDomainsWindow, "top-domains.window",
+		loadEnvDurationVar(squidTopDomainsWindow, defaultTopTalkersWindow), "Sliding window top domains are computed over")
+	flag.Var(&c.TopDomainsAllow, "top-domains.allow", "Domains that are always exported, comma separated or repeated")
+	flag.Var(&c.TopDomainsDeny, "top-domains.deny", "Domains that are never exported on their own, comma separated or repeated")
+
+	flag.BoolVar(&c.ClientList, "client-list",
+		loadEnvBoolVar(squidClientList, false), "Extract client statistics from the client_list page")
+	flag.Var(&c.ClientListSubnets, "client-list.subnets", "Break client statistics down by these subnets (CIDR), comma separated or repeated")
+
+	flag.BoolVar(&c.DelayPools, "delay-pools",
+		loadEnvBoolVar(squidDelayPools, false), "Extract delay pool bucket levels from the delay page")
+	flag.IntVar(&c.DelayPoolsMaxBuckets, "delay-pools.max-buckets",
+		loadEnvIntVar(squidDelayPoolsMaxBuckets, 0), "Number of individual buckets exported per pool and bucket type, 0 disables them")
+
+	flag.BoolVar(&c.TLS, "tls",
+		loadEnvBoolVar(squidTLS, false), "Extract SSL-bump and TLS certificate generator metrics")
+	flag.Var(&c.TLSHelpers, "tls.helpers", "Manager pages of the TLS helpers (default sslcrtd_program), comma separated or repeated")
+	flag.StringVar(&c.TLSCertDBPath, "tls.certdb-path",
+		loadEnvStringVar(squidTLSCertDBPath, ""), "Optional path to the security_file_certgen database directory")
+	flag.IntVar(&c.TLSCertDBMaxMiB, "tls.certdb-max-size-mb",
+		loadEnvIntVar(squidTLSCertDBMaxMiB, 0), "Maximum size of the certificate database as configured with security_file_certgen -M, in MB")
+
+	flag.BoolVar(&c.Adaptation, "adaptation",
+		loadEnvBoolVar(squidAdaptation, false), "Extract ICAP/eCAP adaptation service metrics")
+	flag.StringVar(&c.AdaptationPage, "adaptation.page",
+		loadEnvStringVar(squidAdaptationPage, defaultAdaptationPage), "Manager page reporting the adaptation services")
+
+	flag.Var(&c.StoreIOSections, "store-io.sections",
+		"Store and disk I/O pages to extract metrics from: store_io, io, diskd, squidaio_counts. Comma separated or repeated")
+
+	flag.Var(&c.ObjectsPages, "objects.pages",
+		"Pages listing cached objects to aggregate, vm_objects and/or objects. Comma separated or repeated")
+	flag.IntVar(&c.ObjectsMaxLines, "objects.max-lines",
+		loadEnvIntVar(squidObjectsMaxLines, defaultObjectsMaxLines), "Maximum number of lines read per objects page and scrape, 0 for no limit")
+
+	flag.BoolVar(&c.StoreDigest, "store-digest",
+		loadEnvBoolVar(squidStoreDigest, false), "Extract local cache digest statistics from the store_digest page")
+	flag.BoolVar(&c.RefreshPatterns, "refresh-patterns",
+		loadEnvBoolVar(squidRefreshPatterns, false), "Extract refresh_pattern usage and freshness decisions from the refresh page")
+
+	flag.BoolVar(&c.Events, "events",
+		loadEnvBoolVar(squidEvents, false), "Extract a summary of the internal event queue from the events page")
+
+	flag.Var(&c.ForwardSections, "forward.sections",
+		"Forwarding and header pages to extract metrics from: forward, http_headers, via_headers, forw_headers. Comma separated or repeated")
+	flag.Var(&c.ForwardHeaders, "forward.headers",
+		"Header fields exported from http_headers, others are reported as other. Comma separated or repeated, defaults to common headers")
+	flag.IntVar(&c.ForwardMaxHeaderValues, "forward.max-header-values",
+		loadEnvIntVar(squidForwardMaxHeaderValues, defaultForwardMaxHeaderValues), "Number of most frequent Via and X-Forwarded-For values exported")
+
+	flag.Var(&c.ProbeTargets, "probe.targets",
+		"URLs fetched through the proxy on every scrape, https URLs are tunneled with CONNECT. Comma separated or repeated")
+	flag.StringVar(&c.ProbeProxy, "probe.proxy",
+		loadEnvStringVar(squidProbeProxy, ""), "Proxy port to probe through, in host:port format (default squid-hostname:squid-port)")
+	flag.DurationVar(&c.ProbeTimeout, "probe.timeout",
+		loadEnvDurationVar(squidProbeTimeout, defaultProbeTimeout), "Timeout of a single probe")
+	flag.StringVar(&c.ProbeLogin, "probe.login",
+		loadEnvStringVar(squidProbeLogin, ""), "Login to authenticate probes to the proxy with")
+	flag.StringVar(&c.ProbePassword, "probe.password",
+		loadEnvStringVar(squidProbePassword, ""), "Password to authenticate probes to the proxy with")
+	flag.BoolVar(&c.ProbeSkipTLSVerify, "probe.insecure-skip-verify",
+		loadEnvBoolVar(squidProbeInsecure, false), "Do not verify the certificates of https probe targets")
+
+	flag.Var(&c.AuthProbeSchemes, "auth-probe.schemes",
+		"Authentication schemes to probe the proxy with: basic, digest, negotiate. Comma separated or repeated")
+	flag.StringVar(&c.AuthProbeTarget, "auth-probe.target",
+		loadEnvStringVar(squidAuthProbeTarget, ""), "http URL fetched through the proxy by the authentication probe")
+	flag.StringVar(&c.AuthProbeLogin, "auth-probe.login",
+		loadEnvStringVar(squidAuthProbeLogin, ""), "Test login for the basic and digest authentication probes")
+	flag.StringVar(&c.AuthProbePassword, "auth-probe.password",
+		loadEnvStringVar(squidAuthProbePassword, ""), "Test password for the basic and digest authentication probes")
+	flag.StringVar(&c.AuthProbeNegotiateCommand, "auth-probe.negotiate-command",
+		loadEnvStringVar(squidAuthProbeNegotiateCmd, ""), "Command printing a base64 SPNEGO token for the proxy host given as argument")
+
+	flag.BoolVar(&c.DumpScrub, "dump.scrub", false,
+		"Mask IP addresses and host names in the page printed by the dump command, for recording test fixtures")
 
 	VersionFlag = flag.Bool("version", false, "Print the version and exit")
 
-	flag.Parse()
+	c.Args = parseInterspersed(flag.CommandLine, os.Args[1:])
+
+	// List flags can be repeated, so environment variables only apply when they are not given at all.
+	// -listen and SQUID_EXPORTER_LISTEN may hold several comma separated addresses as well
+	if len(c.ListenAddresses) == 0 {
+		_ = c.ListenAddresses.Set(c.ListenAddress)
+	}
+	if len(c.ListenAddresses) > 0 {
+		c.ListenAddress = c.ListenAddresses[0]
+	}
+
+	loadEnvListVar(&c.ProxyHeaderTLVs, squidProxyHeaderTLVs)
+	loadEnvListVar(&c.TopDomainsAllow, squidTopDomainsAllow)
+	loadEnvListVar(&c.TopDomainsDeny, squidTopDomainsDeny)
+	loadEnvListVar(&c.ClientListSubnets, squidClientListSubnets)
+	loadEnvListVar(&c.AccessLogExtraFields, squidAccessLogExtraFields)
+	loadEnvListVar(&c.TLSHelpers, squidTLSHelpers)
+	loadEnvListVar(&c.StoreIOSections, squidStoreIOSections)
+	loadEnvListVar(&c.ObjectsPages, squidObjectsPages)
+	loadEnvListVar(&c.ForwardSections, squidForwardSections)
+	loadEnvListVar(&c.ForwardHeaders, squidForwardHeaders)
+	loadEnvListVar(&c.ProbeTargets, squidProbeTargets)
+	loadEnvListVar(&c.AuthProbeSchemes, squidAuthProbeSchemes)
+	if len(c.TLSHelpers) == 0 {
+		c.TLSHelpers = StringList{defaultTLSHelper}
+	}
 
 	return c
 }
@@ -139,6 +472,40 @@ func loadEnvIntVar(key string, def int) int {
 	return def
 }
 
+func loadEnvDurationVar(key string, def time.Duration) time.Duration {
+	valStr := os.Getenv(key)
+	if valStr != "" {
+		val, err := time.ParseDuration(valStr)
+		if err == nil {
+			return val
+		}
+
+		log.Printf("Error parsing  %s='%s'. Duration value expected", key, valStr)
+	}
+
+	return def
+}
+
+func loadEnvListVar(l *StringList, key string) {
+	if val := os.Getenv(key); val != "" && len(*l) == 0 {
+		l.Set(val)
+	}
+}
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+
+	return nil
+}
+
 func (l *Labels) String() string {
 	var lbls []string
 	for i := range l.Keys {
@@ -165,3 +532,25 @@ func (l *Labels) Set(value string) error {
 
 	return nil
 }
+
+// parseInterspersed parses the flags of fs anywhere in args, also after the
+// command, e.g. "dump info -squid-port 3129", and returns the other arguments.
+// Everything after "--" is an argument.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var rest []string
+	for {
+		// The flag set of the command line exits on errors
+		_ = fs.Parse(args)
+
+		consumed := args[:len(args)-fs.NArg()]
+		if len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(rest, fs.Args()...)
+		}
+		if fs.NArg() == 0 {
+			return rest
+		}
+
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
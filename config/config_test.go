@@ -0,0 +1,35 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args     []string
+		port     int
+		scrub    bool
+		expected []string
+	}{
+		{nil, 3128, false, nil},
+		{[]string{"-squid-port", "3129", "dump", "info"}, 3129, false, []string{"dump", "info"}},
+		{[]string{"dump", "info", "-squid-port", "3129", "-dump.scrub"}, 3129, true, []string{"dump", "info"}},
+		{[]string{"dump", "-dump.scrub", "info"}, 3128, true, []string{"dump", "info"}},
+		{[]string{"dump", "--", "-info"}, 3128, false, []string{"dump", "-info"}},
+	}
+
+	for _, tc := range tests {
+		fs := flag.NewFlagSet("squid-exporter", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		port := fs.Int("squid-port", 3128, "")
+		scrub := fs.Bool("dump.scrub", false, "")
+
+		assert.Equal(t, tc.expected, parseInterspersed(fs, tc.args), tc.args)
+		assert.Equal(t, tc.port, *port, tc.args)
+		assert.Equal(t, tc.scrub, *scrub, tc.args)
+	}
+}
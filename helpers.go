@@ -1,7 +1,7 @@
 package main
 
 import (
-	"log"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
@@ -11,52 +11,140 @@ import (
 	proxyproto "github.com/pires/go-proxyproto"
 )
 
-func createProxyHeader(cfg *config.Config) string {
-	la := strings.Split(cfg.ListenAddress, ":")
-	if len(la) < 2 {
-		log.Printf("Cannot parse listen address (%s). Failed to create proxy header\n", cfg.ListenAddress)
-		return ""
+// proxyTLVTypes maps the names accepted for PROXY v2 TLVs to their types
+var proxyTLVTypes = map[string]proxyproto.PP2Type{
+	"alpn":      proxyproto.PP2_TYPE_ALPN,
+	"authority": proxyproto.PP2_TYPE_AUTHORITY,
+	"crc32c":    proxyproto.PP2_TYPE_CRC32C,
+	"noop":      proxyproto.PP2_TYPE_NOOP,
+	"unique_id": proxyproto.PP2_TYPE_UNIQUE_ID,
+	"netns":     proxyproto.PP2_TYPE_NETNS,
+}
+
+// createProxyHeader builds the PROXY protocol header sent ahead of every request to squid
+func createProxyHeader(cfg *config.Config) ([]byte, error) {
+	version := cfg.ProxyHeaderVersion
+	if version == 0 {
+		version = 1
+	}
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", version)
+	}
+	if len(cfg.ProxyHeaderTLVs) > 0 && version != 2 {
+		return nil, fmt.Errorf("TLVs need PROXY protocol version 2")
 	}
 
-	spt, err := strconv.Atoi(la[1])
+	destination := cfg.ProxyHeaderDestination
+	if destination == "" {
+		destination = net.JoinHostPort(cfg.SquidHostname, strconv.Itoa(cfg.SquidPort))
+	}
+	dst, err := resolveTCPAddr(destination, nil)
 	if err != nil {
-		log.Printf("Failed to create proxy header: %v\n", err.Error())
-		return ""
+		return nil, fmt.Errorf("invalid PROXY destination address %q: %v", destination, err)
 	}
 
-	sip, err := net.LookupIP(la[0])
+	source := cfg.ProxyHeaderSource
+	if source == "" {
+		source = cfg.ListenAddress
+	}
+	src, err := resolveTCPAddr(source, dst.IP)
 	if err != nil {
-		log.Printf("Failed to create proxy header: %v\n", err.Error())
-		return ""
+		return nil, fmt.Errorf("invalid PROXY source address %q: %v", source, err)
 	}
 
-	dip, err := net.LookupIP(cfg.SquidHostname)
-	if err != nil {
-		log.Printf("Failed to create proxy header: %v\n", err.Error())
-		return ""
+	transport := proxyproto.TCPv4
+	if src.IP.To4() == nil || dst.IP.To4() == nil {
+		if src.IP.To4() != nil || dst.IP.To4() != nil {
+			return nil, fmt.Errorf("PROXY source %s and destination %s are of different address families", src, dst)
+		}
+		transport = proxyproto.TCPv6
 	}
 
 	ph := &proxyproto.Header{
-		Version:           1,
+		Version:           byte(version),
 		Command:           proxyproto.PROXY,
-		TransportProtocol: proxyproto.TCPv4,
-		SourceAddr: &net.TCPAddr{
-			IP:   sip[0],
-			Port: spt,
-		},
+		TransportProtocol: transport,
+		SourceAddr:        src,
+		DestinationAddr:   dst,
+	}
+
+	if len(cfg.ProxyHeaderTLVs) > 0 {
+		tlvs, err := parseProxyTLVs(cfg.ProxyHeaderTLVs)
+		if err != nil {
+			return nil, err
+		}
+		if err := ph.SetTLVs(tlvs); err != nil {
+			return nil, err
+		}
+	}
 
-		DestinationAddr: &net.TCPAddr{
-			IP:   dip[0],
-			Port: cfg.SquidPort,
-		},
+	return ph.Format()
+}
+
+// resolveTCPAddr parses a host:port address, resolving host names. When like is set
+// an address of the same family is preferred, an empty or unspecified host becomes
+// the unspecified address of that family.
+func resolveTCPAddr(address string, like net.IP) (*net.TCPAddr, error) {
+	host, p, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
 	}
-	phs, err := ph.Format()
 
+	port, err := strconv.Atoi(p)
 	if err != nil {
-		log.Printf("Failed to create proxy header: %v\n", err.Error())
+		return nil, err
+	}
+
+	wantV4 := like == nil || like.To4() != nil
+
+	var ips []net.IP
+	switch ip := net.ParseIP(host); {
+	case host == "" || (ip != nil && ip.IsUnspecified()):
+		if wantV4 {
+			ips = []net.IP{net.IPv4zero}
+		} else {
+			ips = []net.IP{net.IPv6unspecified}
+		}
+	case ip != nil:
+		ips = []net.IP{ip}
+	default:
+		if ips, err = net.LookupIP(host); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ip := range ips {
+		if (ip.To4() != nil) == wantV4 {
+			return &net.TCPAddr{IP: ip, Port: port}, nil
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no address found for %q", host)
+	}
+
+	return &net.TCPAddr{IP: ips[0], Port: port}, nil
+}
+
+// parseProxyTLVs parses type=value pairs, the type is a name from proxyTLVTypes or a number
+func parseProxyTLVs(values []string) ([]proxyproto.TLV, error) {
+	var tlvs []proxyproto.TLV
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid TLV %q, expected type=value", v)
+		}
+
+		t, ok := proxyTLVTypes[strings.ToLower(name)]
+		if !ok {
+			n, err := strconv.ParseUint(name, 0, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TLV type %q", name)
+			}
+			t = proxyproto.PP2Type(n)
+		}
+
+		tlvs = append(tlvs, proxyproto.TLV{Type: t, Value: []byte(value)})
 	}
 
-	// proxyproto adds crlf to the end of the header string, but we will add this later
-	// we are triming it here.
-	return strings.TrimSuffix(string(phs), "\r\n")
+	return tlvs, nil
 }
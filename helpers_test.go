@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"net"
 	"testing"
 
+	proxyproto "github.com/pires/go-proxyproto"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/boynux/squid-exporter/config"
@@ -15,8 +19,138 @@ func TestCreatProxyHelper(t *testing.T) {
 		SquidPort:     3128,
 	}
 
-	expectedHProxyString := "PROXY TCP4 192.0.2.1 127.0.0.1 3192 3128"
+	expectedHProxyString := "PROXY TCP4 192.0.2.1 127.0.0.1 3192 3128\r\n"
 
-	p := createProxyHeader(cfg)
-	assert.Equal(t, expectedHProxyString, p, "Proxy headers do not match!")
+	p, err := createProxyHeader(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedHProxyString, string(p), "Proxy headers do not match!")
+}
+
+func TestCreateProxyHeaderV1(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.Config
+		expected string
+	}{
+		{
+			name:     "ipv6",
+			cfg:      config.Config{ListenAddress: "[2001:db8::1]:9301", SquidHostname: "::1", SquidPort: 3128},
+			expected: "PROXY TCP6 2001:db8::1 ::1 9301 3128\r\n",
+		},
+		{
+			name:     "listen without host",
+			cfg:      config.Config{ListenAddress: ":9301", SquidHostname: "127.0.0.1", SquidPort: 3128},
+			expected: "PROXY TCP4 0.0.0.0 127.0.0.1 9301 3128\r\n",
+		},
+		{
+			name:     "listen without host to ipv6 squid",
+			cfg:      config.Config{ListenAddress: ":9301", SquidHostname: "::1", SquidPort: 3128},
+			expected: "PROXY TCP6 :: ::1 9301 3128\r\n",
+		},
+		{
+			name: "explicit addresses",
+			cfg: config.Config{ListenAddress: ":9301", SquidHostname: "localhost", SquidPort: 3128,
+				ProxyHeaderSource: "198.51.100.7:40000", ProxyHeaderDestination: "203.0.113.9:8080"},
+			expected: "PROXY TCP4 198.51.100.7 203.0.113.9 40000 8080\r\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := createProxyHeader(&tc.cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(p))
+		})
+	}
+}
+
+func TestCreateProxyHeaderV2(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.Config
+		transport proxyproto.AddressFamilyAndProtocol
+		src, dst  string
+		tlvs      []proxyproto.TLV
+	}{
+		{
+			name:      "ipv4",
+			cfg:       config.Config{ListenAddress: "192.0.2.1:9301", SquidHostname: "127.0.0.1", SquidPort: 3128},
+			transport: proxyproto.TCPv4,
+			src:       "192.0.2.1:9301",
+			dst:       "127.0.0.1:3128",
+		},
+		{
+			name:      "ipv6",
+			cfg:       config.Config{ListenAddress: "[2001:db8::1]:9301", SquidHostname: "::1", SquidPort: 3128},
+			transport: proxyproto.TCPv6,
+			src:       "[2001:db8::1]:9301",
+			dst:       "[::1]:3128",
+		},
+		{
+			name: "tlvs",
+			cfg: config.Config{ListenAddress: "192.0.2.1:9301", SquidHostname: "127.0.0.1", SquidPort: 3128,
+				ProxyHeaderTLVs: config.StringList{"authority=squid.example.com", "0xE0=exporter"}},
+			transport: proxyproto.TCPv4,
+			src:       "192.0.2.1:9301",
+			dst:       "127.0.0.1:3128",
+			tlvs: []proxyproto.TLV{
+				{Type: proxyproto.PP2_TYPE_AUTHORITY, Value: []byte("squid.example.com")},
+				{Type: 0xE0, Value: []byte("exporter")},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.ProxyHeaderVersion = 2
+			p, err := createProxyHeader(&tc.cfg)
+			assert.NoError(t, err)
+
+			h, err := proxyproto.Read(bufio.NewReader(bytes.NewReader(p)))
+			assert.NoError(t, err)
+			assert.Equal(t, byte(2), h.Version)
+			assert.Equal(t, tc.transport, h.TransportProtocol)
+			assert.Equal(t, tc.src, h.SourceAddr.String())
+			assert.Equal(t, tc.dst, h.DestinationAddr.String())
+
+			tlvs, err := h.TLVs()
+			assert.NoError(t, err)
+			assert.Equal(t, len(tc.tlvs), len(tlvs))
+			for i := range tc.tlvs {
+				assert.Equal(t, tc.tlvs[i], tlvs[i])
+			}
+		})
+	}
+}
+
+func TestCreateProxyHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		err  string
+	}{
+		{"version", config.Config{ListenAddress: ":9301", SquidHostname: "127.0.0.1", SquidPort: 3128, ProxyHeaderVersion: 3},
+			"unsupported PROXY protocol version 3"},
+		{"tlvs with v1", config.Config{ListenAddress: ":9301", SquidHostname: "127.0.0.1", SquidPort: 3128, ProxyHeaderTLVs: config.StringList{"noop=x"}},
+			"TLVs need PROXY protocol version 2"},
+		{"mixed families", config.Config{ListenAddress: "[2001:db8::1]:9301", SquidHostname: "127.0.0.1", SquidPort: 3128},
+			"PROXY source [2001:db8::1]:9301 and destination 127.0.0.1:3128 are of different address families"},
+		{"invalid source", config.Config{ListenAddress: "192.0.2.1", SquidHostname: "127.0.0.1", SquidPort: 3128},
+			`invalid PROXY source address "192.0.2.1": address 192.0.2.1: missing port in address`},
+		{"invalid tlv", config.Config{ListenAddress: ":9301", SquidHostname: "127.0.0.1", SquidPort: 3128, ProxyHeaderVersion: 2, ProxyHeaderTLVs: config.StringList{"bogus=x"}},
+			`invalid TLV type "bogus"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := createProxyHeader(&tc.cfg)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestResolveTCPAddrPrefersFamily(t *testing.T) {
+	addr, err := resolveTCPAddr("localhost:80", net.ParseIP("127.0.0.1"))
+	assert.NoError(t, err)
+	assert.NotNil(t, addr.IP.To4())
 }
@@ -3,11 +3,13 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
 
+	"github.com/boynux/squid-exporter/accesslog"
 	"github.com/boynux/squid-exporter/collector"
 	"github.com/boynux/squid-exporter/config"
 	kitlog "github.com/go-kit/log"
@@ -29,25 +31,88 @@ func main() {
 		log.Println(version.Print("squid_exporter"))
 		os.Exit(0)
 	}
+	if err := checkCommand(cfg.Args); err != nil {
+		log.Fatal(err)
+	}
+	var command string
+	if len(cfg.Args) > 0 {
+		command = cfg.Args[0]
+	}
+
 	collector.ExtractServiceTimes = cfg.ExtractServiceTimes
 	collector.ExtractMemPools = cfg.ExtractMemPools
 
 	headers := []string{}
 
+	var proxyHeader []byte
 	if cfg.UseProxyHeader {
-		headers = append(headers, createProxyHeader(cfg))
+		var err error
+		if proxyHeader, err = createProxyHeader(cfg); err != nil {
+			log.Fatalf("Failed to create proxy header: %v", err)
+		}
 	}
 
+	// Collectors reading the cache manager, they are scraped in the background when enabled
+	var squidCollectors []prometheus.Collector
+
+	retry := collector.NewRetrier(&collector.RetryConfig{
+		Retries:          cfg.Retries,
+		Backoff:          cfg.RetryBackoff,
+		FailureThreshold: cfg.BreakerThreshold,
+		Cooldown:         cfg.BreakerCooldown,
+		Labels:           cfg.Labels,
+	})
+	prometheus.MustRegister(retry)
+
+	pool := collector.NewConnPool(&collector.ConnPoolConfig{
+		MaxIdle:     cfg.KeepAliveMaxIdle,
+		IdleTimeout: cfg.KeepAliveIdleTimeout,
+		MaxOpen:     cfg.MaxConnections,
+		Labels:      cfg.Labels,
+	})
+	prometheus.MustRegister(pool)
+
+	parseFailures := collector.NewParseFailures(cfg.Labels)
+	prometheus.MustRegister(parseFailures)
+
+	cor := &collector.CacheObjectRequest{
+		Hostname:      cfg.SquidHostname,
+		Port:          cfg.SquidPort,
+		Login:         cfg.Login,
+		Password:      cfg.Password,
+		Headers:       headers,
+		ProxyHeader:   proxyHeader,
+		Pool:          pool,
+		Retry:         retry,
+		ParseFailures: parseFailures,
+	}
+
+	// Background checks fetch without retries, they must not trip the breaker
+	// or use up the retry budget of the scrapes
+	healthRequest := *cor
+	healthRequest.Retry = nil
+	healthRequest.ParseFailures = nil
+	health := collector.NewHealthChecker(&collector.HealthConfig{
+		Target:      net.JoinHostPort(cfg.SquidHostname, strconv.Itoa(cfg.SquidPort)),
+		Interval:    cfg.HealthInterval,
+		ReadyWindow: cfg.ReadyWindow,
+	}, collector.NewCacheObjectClient(&healthRequest))
+
 	log.Println("Scraping metrics from", fmt.Sprintf("%s:%d", cfg.SquidHostname, cfg.SquidPort))
 	e := collector.New(&collector.CollectorConfig{
-		Hostname: cfg.SquidHostname,
-		Port:     cfg.SquidPort,
-		Login:    cfg.Login,
-		Password: cfg.Password,
-		Labels:   cfg.Labels,
-		Headers:  headers,
+		Hostname:      cfg.SquidHostname,
+		Port:          cfg.SquidPort,
+		Login:         cfg.Login,
+		Password:      cfg.Password,
+		Labels:        cfg.Labels,
+		Headers:       headers,
+		ProxyHeader:   proxyHeader,
+		Pool:          pool,
+		Retry:         retry,
+		ParseFailures: parseFailures,
+		Health:        health,
 	})
-	prometheus.MustRegister(e)
+	squidCollectors = append(squidCollectors, e)
 
 	if cfg.Pidfile != "" {
 		procExporter := collectors.NewProcessCollector(collectors.ProcessCollectorOpts{
@@ -67,8 +132,228 @@ func main() {
 		prometheus.MustRegister(procExporter)
 	}
 
+	switch command {
+	case commandDump:
+		if err := runDump(os.Stdout, cor, cfg.Args[1], cfg.DumpScrub); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	case commandParse:
+		if err := runParse(os.Stdout, cor, cfg.Args[1]); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	var logHandlers []accesslog.Handler
+
+	if cfg.TopTalkers {
+		if cfg.TopTalkersSource != collector.TopTalkersSourceAccessLog && cfg.TopTalkersSource != collector.TopTalkersSourceClientList {
+			log.Fatalf("Unknown top talkers source %q", cfg.TopTalkersSource)
+		}
+
+		topTalkers := collector.NewTopTalkers(&collector.TopTalkersConfig{
+			Source:     cfg.TopTalkersSource,
+			Count:      cfg.TopTalkersCount,
+			Window:     cfg.TopTalkersWindow,
+			IPv4Prefix: cfg.TopTalkersIPv4Prefix,
+			IPv6Prefix: cfg.TopTalkersIPv6Prefix,
+			HashUsers:  cfg.TopTalkersHashUsers,
+			HashKey:    cfg.TopTalkersHashKey,
+			Labels:     cfg.Labels,
+		}, collector.NewCacheObjectClient(cor))
+		prometheus.MustRegister(topTalkers)
+
+		if cfg.TopTalkersSource == collector.TopTalkersSourceAccessLog {
+			logHandlers = append(logHandlers, topTalkers)
+		}
+	}
+
+	if cfg.TopDomains {
+		topDomains := collector.NewTopDomains(&collector.TopDomainsConfig{
+			Count:  cfg.TopDomainsCount,
+			Window: cfg.TopDomainsWindow,
+			Allow:  cfg.TopDomainsAllow,
+			Deny:   cfg.TopDomainsDeny,
+			Labels: cfg.Labels,
+		})
+		prometheus.MustRegister(topDomains)
+		logHandlers = append(logHandlers, topDomains)
+	}
+
+	if cfg.ClientList {
+		clientList, err := collector.NewClientListCollector(&collector.ClientListConfig{
+			Subnets: cfg.ClientListSubnets,
+			Labels:  cfg.Labels,
+		}, collector.NewCacheObjectClient(cor))
+		if err != nil {
+			log.Fatal(err)
+		}
+		squidCollectors = append(squidCollectors, clientList)
+	}
+
+	if cfg.DelayPools {
+		squidCollectors = append(squidCollectors, collector.NewDelayPoolsCollector(&collector.DelayPoolsConfig{
+			MaxBuckets: cfg.DelayPoolsMaxBuckets,
+			Labels:     cfg.Labels,
+		}, collector.NewCacheObjectClient(cor)))
+	}
+
+	if len(cfg.StoreIOSections) > 0 {
+		storeIO, err := collector.NewStoreIOCollector(cfg.StoreIOSections, cfg.Labels, collector.NewCacheObjectClient(cor))
+		if err != nil {
+			log.Fatal(err)
+		}
+		squidCollectors = append(squidCollectors, storeIO)
+	}
+
+	var digestSections []string
+	if cfg.StoreDigest {
+		digestSections = append(digestSections, collector.StoreDigestSection)
+	}
+	if cfg.RefreshPatterns {
+		digestSections = append(digestSections, collector.RefreshSection)
+	}
+	if len(digestSections) > 0 {
+		digest, err := collector.NewDigestCollector(digestSections, cfg.Labels, collector.NewCacheObjectClient(cor))
+		if err != nil {
+			log.Fatal(err)
+		}
+		squidCollectors = append(squidCollectors, digest)
+	}
+
+	if len(cfg.ForwardSections) > 0 {
+		forward, err := collector.NewForwardCollector(&collector.ForwardConfig{
+			Sections:        cfg.ForwardSections,
+			Headers:         cfg.ForwardHeaders,
+			MaxHeaderValues: cfg.ForwardMaxHeaderValues,
+			Labels:          cfg.Labels,
+		}, collector.NewCacheObjectClient(cor))
+		if err != nil {
+			log.Fatal(err)
+		}
+		squidCollectors = append(squidCollectors, forward)
+	}
+
+	probeProxy := cfg.ProbeProxy
+	if probeProxy == "" {
+		probeProxy = net.JoinHostPort(cfg.SquidHostname, strconv.Itoa(cfg.SquidPort))
+	}
+
+	if len(cfg.ProbeTargets) > 0 {
+		probe, err := collector.NewProbeCollector(&collector.ProbeConfig{
+			Proxy:              probeProxy,
+			Targets:            cfg.ProbeTargets,
+			Timeout:            cfg.ProbeTimeout,
+			Login:              cfg.ProbeLogin,
+			Password:           cfg.ProbePassword,
+			InsecureSkipVerify: cfg.ProbeSkipTLSVerify,
+			Labels:             cfg.Labels,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		prometheus.MustRegister(probe)
+	}
+
+	if len(cfg.AuthProbeSchemes) > 0 {
+		if cfg.AuthProbeTarget == "" {
+			log.Fatal("The authentication probe needs a target URL")
+		}
+
+		authProbe, err := collector.NewAuthProbeCollector(&collector.AuthProbeConfig{
+			Proxy:            probeProxy,
+			Target:           cfg.AuthProbeTarget,
+			Schemes:          cfg.AuthProbeSchemes,
+			Timeout:          cfg.ProbeTimeout,
+			Login:            cfg.AuthProbeLogin,
+			Password:         cfg.AuthProbePassword,
+			NegotiateCommand: cfg.AuthProbeNegotiateCommand,
+			Labels:           cfg.Labels,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		prometheus.MustRegister(authProbe)
+	}
+
+	if cfg.Events {
+		squidCollectors = append(squidCollectors, collector.NewEventsCollector(cfg.Labels, collector.NewCacheObjectClient(cor)))
+	}
+
+	if len(cfg.ObjectsPages) > 0 {
+		squidCollectors = append(squidCollectors, collector.NewObjectsCollector(&collector.ObjectsConfig{
+			Pages:    cfg.ObjectsPages,
+			MaxLines: cfg.ObjectsMaxLines,
+			Labels:   cfg.Labels,
+		}, collector.NewCacheObjectClient(cor)))
+	}
+
+	if cfg.TLS {
+		tlsCollector := collector.NewTLSCollector(&collector.TLSConfig{
+			Helpers:       cfg.TLSHelpers,
+			CertDBPath:    cfg.TLSCertDBPath,
+			CertDBMaxSize: float64(cfg.TLSCertDBMaxMiB) * 1024 * 1024,
+			Labels:        cfg.Labels,
+		}, collector.NewCacheObjectClient(cor))
+		squidCollectors = append(squidCollectors, tlsCollector)
+
+		// SSL-bump modes and TLS errors are only available from the access log
+		if cfg.AccessLog != "" {
+			logHandlers = append(logHandlers, tlsCollector)
+		}
+	}
+
+	if cfg.Adaptation {
+		adaptation := collector.NewAdaptationCollector(&collector.AdaptationConfig{
+			Page:   cfg.AdaptationPage,
+			Labels: cfg.Labels,
+		}, collector.NewCacheObjectClient(cor))
+		squidCollectors = append(squidCollectors, adaptation)
+
+		// ICAP transaction times are only available from the access log
+		if cfg.AccessLog != "" {
+			logHandlers = append(logHandlers, adaptation)
+		}
+	}
+
+	// A single scrape of the cache manager, the access log is not followed
+	if command == commandMetrics {
+		if err := runMetrics(os.Stdout, append(squidCollectors, parseFailures)...); err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if len(logHandlers) > 0 {
+		if cfg.AccessLog == "" {
+			log.Fatal("Access log derived metrics require -squid-access-log")
+		}
+
+		log.Println("Following access log", cfg.AccessLog)
+		tailer := accesslog.NewTailer(cfg.AccessLog, logHandlers...)
+		tailer.SetExtraFields(cfg.AccessLogExtraFields)
+		go tailer.Run(make(chan struct{}))
+	}
+
+	if cfg.ScrapeInterval > 0 {
+		cached := collector.NewCachedCollector(&collector.CachedCollectorConfig{
+			Interval: cfg.ScrapeInterval,
+			MaxStale: cfg.ScrapeMaxStale,
+			Labels:   cfg.Labels,
+		}, squidCollectors...)
+		prometheus.MustRegister(cached)
+		go cached.Run(make(chan struct{}))
+	} else {
+		prometheus.MustRegister(squidCollectors...)
+	}
+
+	go health.Run(make(chan struct{}))
+
 	// Serve metrics
 	http.Handle(cfg.MetricPath, promhttp.Handler())
+	http.Handle("/-/healthy", health.HealthyHandler())
+	http.Handle("/-/ready", health.ReadyHandler())
 
 	if cfg.MetricPath != "/" {
 		landingConfig := web.LandingConfig{
@@ -81,6 +366,10 @@ func main() {
 					Address: cfg.MetricPath,
 					Text:    "Metrics",
 				},
+				{
+					Address: "/-/ready",
+					Text:    "Readiness",
+				},
 			},
 		}
 		landingPage, err := web.NewLandingPage(landingConfig)
@@ -90,10 +379,10 @@ func main() {
 		http.Handle("/", landingPage)
 	}
 
-	systemdSocket := false
+	listenAddresses := []string(cfg.ListenAddresses)
 	toolkitFlags := &web.FlagConfig{
-		WebListenAddresses: &[]string{cfg.ListenAddress},
-		WebSystemdSocket:   &systemdSocket,
+		WebListenAddresses: &listenAddresses,
+		WebSystemdSocket:   &cfg.SystemdSocket,
 		WebConfigFile:      &cfg.WebConfigPath,
 	}
 	logger := kitlog.NewLogfmtLogger(kitlog.StdlibWriter{})
@@ -0,0 +1,166 @@
+/*
+Package squidmgr fetches and parses the pages of the squid cache manager.
+
+The parse functions work on any io.Reader, so saved pages can be parsed as
+well, e.g. the output of `squidclient mgr:info`:
+
+	info, err := squidmgr.ParseInfo(os.Stdin)
+
+Client fetches the pages from a running squid:
+
+	client := squidmgr.NewClient(&squidmgr.Config{Hostname: "localhost", Port: 3128})
+	counters, err := client.Counters()
+*/
+package squidmgr
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+/*Fetcher returns the body of a cache manager page, the caller closes it */
+type Fetcher interface {
+	Fetch(page string) (io.ReadCloser, error)
+}
+
+/*Config is the address and credentials of the cache manager */
+type Config struct {
+	Hostname string
+	Port     int
+	Login    string
+	Password string
+	// Timeout bounds connecting and reading a page, 10 seconds by default
+	Timeout time.Duration
+}
+
+/*Client fetches and parses cache manager pages */
+type Client struct {
+	Fetcher
+}
+
+// connFetcher opens a connection for every page
+type connFetcher struct {
+	cfg Config
+}
+
+/*NewClient creates a client opening a connection to squid for every page */
+func NewClient(c *Config) *Client {
+	cfg := *c
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &Client{Fetcher: &connFetcher{cfg}}
+}
+
+// request is the cache manager request for page, with basic auth when login is set
+func request(page string, login string, password string) string {
+	lines := []string{
+		fmt.Sprintf("GET cache_object://localhost/%s HTTP/1.0", page),
+		"Host: localhost",
+		"User-Agent: squidclient/3.5.12",
+	}
+	if login != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(login + ":" + password))
+		lines = append(lines, "Proxy-Authorization: Basic "+auth, "Authorization: Basic "+auth)
+	}
+	lines = append(lines, "Accept: */*", "\r\n")
+
+	return strings.Join(lines, "\r\n")
+}
+
+// closeConn closes the connection along with the response body
+type closeConn struct {
+	io.Reader
+	conn net.Conn
+}
+
+func (c *closeConn) Close() error {
+	return c.conn.Close()
+}
+
+func (f *connFetcher) Fetch(page string) (io.ReadCloser, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(f.cfg.Hostname, strconv.Itoa(f.cfg.Port)), f.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(f.cfg.Timeout))
+
+	if _, err := io.WriteString(conn, request(page, f.cfg.Login, f.cfg.Password)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("Non success code %d while fetching %s", resp.StatusCode, page)
+	}
+
+	return &closeConn{Reader: resp.Body, conn: conn}, nil
+}
+
+// parse fetches page and parses it with fn
+func parse[T any](c *Client, page string, fn func(io.Reader) (T, error)) (T, error) {
+	body, err := c.Fetch(page)
+	if err != nil {
+		var zero T
+		return zero, fmt.Errorf("error getting %s: %v", page, err)
+	}
+	defer body.Close()
+
+	v, err := fn(body)
+	if err != nil {
+		return v, &ReadError{Page: page, Err: err}
+	}
+
+	return v, nil
+}
+
+/*Counters fetches the counters page */
+func (c *Client) Counters() (Counters, error) {
+	return parse(c, "counters", ParseCounters)
+}
+
+/*Info fetches the info page */
+func (c *Client) Info() (Info, error) {
+	return parse(c, "info", ParseInfo)
+}
+
+/*ServiceTimes fetches the service_times page */
+func (c *Client) ServiceTimes() (ServiceTimes, error) {
+	return parse(c, "service_times", ParseServiceTimes)
+}
+
+/*MemPools fetches the mem page */
+func (c *Client) MemPools() (MemPools, error) {
+	return parse(c, "mem", ParseMemPools)
+}
+
+/*Version fetches the info page and parses the squid version */
+func (c *Client) Version() (Version, error) {
+	info, err := c.Info()
+	if err != nil {
+		return Version{}, err
+	}
+
+	return ParseVersion(info.Version)
+}
+
+/*StoreDirs fetches the storedir page */
+func (c *Client) StoreDirs() (StoreDirs, error) {
+	return parse(c, "storedir", ParseStoreDirs)
+}
@@ -0,0 +1,49 @@
+package squidmgr
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveOnce answers a single cache manager request with status and body
+func serveOnce(t *testing.T, status string, body string) (*Config, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	requests := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		requests <- line
+		fmt.Fprintf(conn, "HTTP/1.0 %s\r\n\r\n%s", status, body)
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return &Config{Hostname: addr.IP.String(), Port: addr.Port}, requests
+}
+
+func TestClientInfo(t *testing.T) {
+	cfg, requests := serveOnce(t, "200 OK", testInfoPage)
+
+	info, err := NewClient(cfg).Info()
+	assert.NoError(t, err)
+	assert.Equal(t, "6.1", info.Version)
+	assert.Equal(t, "GET cache_object://localhost/info HTTP/1.0\r\n", <-requests)
+}
+
+func TestClientError(t *testing.T) {
+	cfg, _ := serveOnce(t, "401 Unauthorized", "")
+
+	_, err := NewClient(cfg).Counters()
+	assert.EqualError(t, err, "error getting counters: Non success code 401 while fetching counters")
+}
@@ -0,0 +1,53 @@
+package squidmgr
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*Counter is a single "name = value" line of the counters page */
+type Counter struct {
+	Name  string
+	Value float64
+}
+
+/*Counters is the counters page, in page order */
+type Counters []Counter
+
+/*ParseCounterLine parses a line of the counters page */
+func ParseCounterLine(line string) (Counter, error) {
+	if equal := strings.Index(line, "="); equal >= 0 {
+		if key := strings.TrimSpace(line[:equal]); len(key) > 0 {
+			value := ""
+			if len(line) > equal {
+				value = strings.TrimSpace(line[equal+1:])
+			}
+
+			// Remove additional formating string from `sample_time`
+			if slices := strings.Split(value, " "); len(slices) > 0 {
+				value = slices[0]
+			}
+
+			if i, err := strconv.ParseFloat(value, 64); err == nil {
+				return Counter{Name: key, Value: i}, nil
+			}
+		}
+	}
+
+	return Counter{}, errors.New("counter - could not parse line: " + line)
+}
+
+/*ParseCounters parses the counters page, lines that are no counters are skipped */
+func ParseCounters(r io.Reader) (Counters, error) {
+	var counters Counters
+
+	err := ScanPage(r, func(line string) {
+		if c, err := ParseCounterLine(line); err == nil {
+			counters = append(counters, c)
+		}
+	})
+
+	return counters, err
+}
@@ -0,0 +1,44 @@
+package squidmgr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCounterLine(t *testing.T) {
+	tests := []struct {
+		s string
+		c Counter
+		e string
+	}{
+		{"swap.files_cleaned=1", Counter{Name: "swap.files_cleaned", Value: 1}, ""},
+		{"client.http_requests=1", Counter{Name: "client.http_requests", Value: 1}, ""},
+		{"sample_time = 1700000000.000000 (Tue, 14 Nov 2023 22:13:20 GMT)\n", Counter{Name: "sample_time", Value: 1700000000}, ""},
+		{"# test for invalid metric line", Counter{}, "counter - could not parse line: # test for invalid metric line"},
+	}
+
+	for _, tc := range tests {
+		c, err := ParseCounterLine(tc.s)
+
+		if tc.e != "" {
+			assert.EqualError(t, err, tc.e)
+		}
+		assert.Equal(t, tc.c, c)
+	}
+}
+
+func TestParseCounters(t *testing.T) {
+	counters, err := ParseCounters(strings.NewReader("sample_time = 1700000000.000000 (Tue, 14 Nov 2023 22:13:20 GMT)\n" +
+		"client_http.requests = 120\n" +
+		"\n" +
+		"client_http.hits = 30\n"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, Counters{
+		{Name: "sample_time", Value: 1700000000},
+		{Name: "client_http.requests", Value: 120},
+		{Name: "client_http.hits", Value: 30},
+	}, counters)
+}
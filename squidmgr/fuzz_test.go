@@ -0,0 +1,78 @@
+package squidmgr
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/boynux/squid-exporter/squidtest"
+)
+
+// addFixtureSeeds adds page of every squid version with fixtures to the corpus
+func addFixtureSeeds(f *testing.F, page string, extra ...string) {
+	for _, version := range squidtest.Versions() {
+		pages, err := squidtest.Fixture(version)
+		if err != nil {
+			f.Fatal(err)
+		}
+		if p, ok := pages[page]; ok {
+			f.Add(p.Body)
+		}
+	}
+
+	for _, seed := range extra {
+		f.Add(seed)
+	}
+}
+
+// fuzzParse fails on a parser panic, ScanPage hides them from the exporter
+func fuzzParse[T any](f *testing.F, parse ...func(io.Reader) (T, error)) {
+	f.Fuzz(func(t *testing.T, page string) {
+		for _, fn := range parse {
+			_, err := fn(strings.NewReader(page))
+
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				t.Fatal(parseErr)
+			}
+		}
+	})
+}
+
+func FuzzParseCounters(f *testing.F) {
+	addFixtureSeeds(f, "counters", "a = 1\n", "= \n", " = x = y\n")
+	fuzzParse(f, ParseCounters)
+}
+
+func FuzzParseInfo(f *testing.F) {
+	addFixtureSeeds(f, "info", testInfoPage, "Hits as % of all requests:\t5min:\n", "x:\n")
+	fuzzParse(f, ParseInfo)
+}
+
+func FuzzParseServiceTimes(f *testing.F) {
+	addFixtureSeeds(f, "service_times", "HTTP Requests (All): %\n", ":%5\n")
+	fuzzParse(f, ParseServiceTimes)
+}
+
+func FuzzParseMemPools(f *testing.F) {
+	addFixtureSeeds(f, "mem", testMemPage, "Pool Obj Size\nx 1 2 3\n")
+	fuzzParse(f, ParseMemPools)
+}
+
+func FuzzParseStoreDirs(f *testing.F) {
+	addFixtureSeeds(f, "storedir", testStoreDirPage, "Store Directory #\n", "Store Directory #0 (ufs)\nFilemap bits in use: of\n")
+	fuzzParse(f, ParseStoreDirs)
+}
+
+func FuzzParseVersion(f *testing.F) {
+	for _, seed := range []string{"6.10", "Version 3.5.28", "squid/4.0.21-20170621-r2", "7", "-", "squid/"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		if v, err := ParseVersion(s); err == nil {
+			Supported(v)
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package squidmgr
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*InfoDetail is a text value of the info page, e.g. Service_Name */
+type InfoDetail struct {
+	Name  string
+	Value string
+}
+
+/*InfoValue is a numeric value of the info page */
+type InfoValue struct {
+	Name  string
+	Value float64
+}
+
+/*InfoAverage is a value of the info page averaged over 5 and 60 minutes, NaN when squid reports none */
+type InfoAverage struct {
+	Name     string
+	FiveMin  float64
+	SixtyMin float64
+}
+
+/*Info is the info page */
+type Info struct {
+	// Version is the squid version, e.g. 6.1
+	Version string
+	// Details are Squid_Object_Cache_Version, Build_Info and Service_Name, in page order
+	Details  []InfoDetail
+	Values   []InfoValue
+	Averages []InfoAverage
+}
+
+// infoKey turns the description of an info line into a name, e.g. Number_of_clients_accessing_cache
+func infoKey(key string) string {
+	key = strings.Replace(key, " ", "_", -1)
+	key = strings.Replace(key, "(", "", -1)
+	key = strings.Replace(key, ")", "", -1)
+	key = strings.Replace(key, ",", "", -1)
+	key = strings.Replace(key, "/", "", -1)
+
+	return key
+}
+
+func parseInfoNumber(value string) float64 {
+	value = strings.Replace(value, "%", "", -1)
+	value = strings.Replace(value, ",", "", -1)
+
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	return math.NaN()
+}
+
+// decode adds a line of the info page to i and reports whether it was understood
+func (i *Info) decode(line string) bool {
+	if strings.HasSuffix(line, ":\n") { // A header line isn't a metric
+		return true
+	}
+
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		// The last lines are formatted like "value metricName"
+		lineTrimed := strings.TrimSpace(line)
+
+		if idx := strings.Index(lineTrimed, " "); idx >= 0 {
+			key := strings.TrimSpace(lineTrimed[idx+1:])
+			key = strings.Replace(key, " ", "_", -1)
+			key = strings.Replace(key, "-", "_", -1)
+
+			if f, err := strconv.ParseFloat(strings.TrimSpace(lineTrimed[:idx]), 64); err == nil {
+				i.Values = append(i.Values, InfoValue{Name: key, Value: f})
+				return true
+			}
+		}
+		return false
+	}
+
+	key := infoKey(strings.TrimSpace(line[:idx]))
+	if key == "" {
+		return false
+	}
+	value := strings.TrimSpace(line[idx+1:])
+
+	switch key {
+	case "Squid_Object_Cache":
+		// The value is like "Version 6.1"
+		key = key + "_Version"
+		if fields := strings.Fields(value); len(fields) > 1 {
+			value = fields[1]
+		}
+		i.Version = value
+		i.Details = append(i.Details, InfoDetail{Name: key, Value: value})
+		return true
+	case "Build_Info", "Service_Name":
+		i.Details = append(i.Details, InfoDetail{Name: key, Value: value})
+		return true
+	case "Start_Time", "Current_Time":
+		return true
+	}
+
+	slices := strings.Split(value, " ")
+	if len(slices) >= 4 && slices[0] == "5min:" && slices[2] == "60min:" {
+		// Averages are like "Hits as % of bytes sent: 5min: -0.0%, 60min: -0.0%"
+		i.Averages = append(i.Averages, InfoAverage{
+			Name:     key,
+			FiveMin:  parseInfoNumber(slices[1]),
+			SixtyMin: parseInfoNumber(slices[3]),
+		})
+		return true
+	}
+
+	// Remove additional information in value metric
+	if f := parseInfoNumber(slices[0]); !math.IsNaN(f) {
+		i.Values = append(i.Values, InfoValue{Name: key, Value: f})
+		return true
+	}
+
+	return false
+}
+
+/*ParseInfo parses the info page, lines that are not understood are skipped */
+func ParseInfo(r io.Reader) (Info, error) {
+	var info Info
+
+	err := ScanPage(r, func(line string) {
+		info.decode(line)
+	})
+
+	return info, err
+}
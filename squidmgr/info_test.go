@@ -0,0 +1,61 @@
+package squidmgr
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testInfoPage = `Squid Object Cache: Version 6.1
+Build Info: 
+Service Name: squid
+Start Time:	Wed, 01 May 2024 10:00:00 GMT
+Current Time:	Wed, 01 May 2024 12:00:00 GMT
+Connection information for squid:
+	Number of clients accessing cache:	3
+	Number of HTTP requests received:	120
+Cache information for squid:
+	Hits as % of all requests:	5min: 10.0%, 60min: 12.5%
+	Hits as % of bytes sent:	5min: -, 60min: 4.0%
+	Storage Swap size:	1024 KB
+Resource usage for squid:
+	CPU Usage:	0.50%
+Internal Data Structures:
+	   120 StoreEntries
+	    10 StoreEntries with MemObjects
+`
+
+func TestParseInfo(t *testing.T) {
+	info, err := ParseInfo(strings.NewReader(testInfoPage))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "6.1", info.Version)
+	assert.Equal(t, []InfoDetail{
+		{Name: "Squid_Object_Cache_Version", Value: "6.1"},
+		{Name: "Build_Info", Value: ""},
+		{Name: "Service_Name", Value: "squid"},
+	}, info.Details)
+	assert.Equal(t, []InfoValue{
+		{Name: "Number_of_clients_accessing_cache", Value: 3},
+		{Name: "Number_of_HTTP_requests_received", Value: 120},
+		{Name: "Storage_Swap_size", Value: 1024},
+		{Name: "CPU_Usage", Value: 0.5},
+		{Name: "StoreEntries", Value: 120},
+		{Name: "StoreEntries_with_MemObjects", Value: 10},
+	}, info.Values)
+
+	assert.Len(t, info.Averages, 2)
+	assert.Equal(t, InfoAverage{Name: "Hits_as_%_of_all_requests", FiveMin: 10, SixtyMin: 12.5}, info.Averages[0])
+	assert.True(t, math.IsNaN(info.Averages[1].FiveMin))
+	assert.Equal(t, 4.0, info.Averages[1].SixtyMin)
+}
+
+func TestParseInfoTruncatedVersion(t *testing.T) {
+	info, err := ParseInfo(strings.NewReader("Squid Object Cache:\nCPU Usage:\t5min:\n"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "", info.Version)
+	assert.Empty(t, info.Averages)
+}
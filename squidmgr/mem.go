@@ -0,0 +1,111 @@
+package squidmgr
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*MemPool is a row of the mem page */
+type MemPool struct {
+	// Kid is the worker the table belongs to, kid1 for the first table
+	Kid  string
+	Pool string
+
+	ObjSizeBytes         float64
+	ChunksKBPerChunk     float64
+	ObjsPerChunk         float64
+	AllocBytes           float64
+	InuseBytes           float64
+	IdleBytes            float64
+	FragmentationPct     float64
+	AllocationRatePerSec float64
+}
+
+/*MemPools is the mem page, in page order */
+type MemPools []MemPool
+
+// memField parses a column of a mem pool row, 0 when it is not a number
+func memField(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// parseMemLine parses a row of a mem pool table, the pool name may span two columns
+func parseMemLine(line string, kid string) (MemPool, bool) {
+	if strings.HasSuffix(line, ":\n") || strings.HasPrefix(line, "by kid") || strings.HasPrefix(line, "Total Pools") || strings.HasPrefix(line, "Cumulative") {
+		return MemPool{}, false
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 18 {
+		return MemPool{}, false
+	}
+
+	// j is the first numeric column, after the pool name
+	j := 0
+	for i := 0; i < len(fields); i++ {
+		if j == 0 && len(fields[i]) > 0 && unicode.IsDigit(rune(fields[i][0])) {
+			j = i
+		}
+	}
+	if j == 0 {
+		j = 1
+	}
+	if len(fields) < 18+j {
+		return MemPool{}, false
+	}
+	if _, err := strconv.ParseFloat(fields[len(fields)-1], 64); err != nil {
+		return MemPool{}, false
+	}
+
+	pool := fields[0]
+	if j != 1 {
+		pool = fields[0] + "_" + fields[1]
+	}
+
+	inuse := memField(fields[8+j-1])
+	allocated, err := strconv.ParseFloat(fields[3+j-1], 64)
+	if err != nil {
+		allocated = 1
+	}
+	fragmentation := math.Round((1-inuse/allocated)*100*10) / 10
+
+	return MemPool{
+		Kid:                  kid,
+		Pool:                 pool,
+		ObjSizeBytes:         memField(fields[1+j-1]),
+		ChunksKBPerChunk:     memField(fields[3+j-1]),
+		ObjsPerChunk:         memField(fields[2+j-1]),
+		AllocBytes:           memField(fields[3+j-1]),
+		InuseBytes:           inuse,
+		IdleBytes:            memField(fields[13+j-1]),
+		FragmentationPct:     fragmentation,
+		AllocationRatePerSec: memField(fields[18+j-1]),
+	}, true
+}
+
+/*ParseMemPools parses the mem page, every "Obj Size" header starts the table of the next kid */
+func ParseMemPools(r io.Reader) (MemPools, error) {
+	var pools MemPools
+
+	kids := 0
+	kid := "kid"
+	err := ScanPage(r, func(line string) {
+		if strings.Contains(line, "Obj Size") {
+			kids++
+			kid = "kid" + strconv.Itoa(kids)
+		}
+
+		if p, ok := parseMemLine(line, kid); ok {
+			pools = append(pools, p)
+		}
+	})
+
+	return pools, err
+}
@@ -0,0 +1,104 @@
+package squidmgr
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testMemPage = `by kid1 {
+Current memory usage:
+Pool	 Obj Size	Chunks		Allocated
+mem_node 4136 2 400 4 5 6 7 100 9 10 11 12 50 14 15 16 17 3.5
+Total Pools created: 1
+} by kid1
+by kid2 {
+Pool	 Obj Size	Chunks		Allocated
+Short Strings 36 2 200 4 5 6 7 50 9 10 11 12 20 14 15 16 17 1
+short row 1 2 3
+} by kid2
+`
+
+func TestParseMemPools(t *testing.T) {
+	pools, err := ParseMemPools(strings.NewReader(testMemPage))
+
+	assert.NoError(t, err)
+	assert.Equal(t, MemPools{
+		{
+			Kid: "kid1", Pool: "mem_node",
+			ObjSizeBytes: 4136, ChunksKBPerChunk: 400, ObjsPerChunk: 2, AllocBytes: 400,
+			InuseBytes: 100, IdleBytes: 50, FragmentationPct: 75, AllocationRatePerSec: 3.5,
+		},
+		{
+			Kid: "kid2", Pool: "Short_Strings",
+			ObjSizeBytes: 36, ChunksKBPerChunk: 200, ObjsPerChunk: 2, AllocBytes: 200,
+			InuseBytes: 50, IdleBytes: 20, FragmentationPct: 75, AllocationRatePerSec: 1,
+		},
+	}, pools)
+}
+
+// largeMemPage is a mem page of an SMP squid with kids tables of n pools each, larger than any real one
+func largeMemPage(kids int, n int) string {
+	var b strings.Builder
+	for k := 1; k <= kids; k++ {
+		fmt.Fprintf(&b, "by kid%d {\nCurrent memory usage:\nPool\t Obj Size\tChunks\t\tAllocated\n", k)
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, "pool_%d \t %d\t 2\t 400\t 4\t 5\t 6\t 7\t %d\t 9\t 10\t 11\t 12\t 50\t 14\t 15\t 16\t 17\t 3.5\n", i, 16+i%512, i%400)
+		}
+		fmt.Fprintf(&b, "Total Pools created: %d\n} by kid%d\n", n, k)
+	}
+
+	return b.String()
+}
+
+// readLinesChan is the goroutine and channel pipeline pages were parsed with before ScanPage
+func readLinesChan(reader *bufio.Reader, lines chan<- string) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			break
+		}
+		lines <- line
+	}
+	close(lines)
+}
+
+func BenchmarkParseMemPoolsChannel(b *testing.B) {
+	page := largeMemPage(8, 10000)
+	b.SetBytes(int64(len(page)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		lines := make(chan string)
+		go readLinesChan(bufio.NewReader(strings.NewReader(page)), lines)
+
+		var pools MemPools
+		kids := 0
+		kid := "kid"
+		for line := range lines {
+			if strings.Contains(line, "Obj Size") {
+				kids++
+				kid = "kid" + strconv.Itoa(kids)
+			}
+			if pool, ok := parseMemLine(line, kid); ok {
+				pools = append(pools, pool)
+			}
+		}
+	}
+}
+
+func BenchmarkParseMemPoolsScanner(b *testing.B) {
+	page := largeMemPage(8, 10000)
+	b.SetBytes(int64(len(page)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseMemPools(strings.NewReader(page)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package squidmgr
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	/*MaxLineLength bounds a single line of a manager page */
+	MaxLineLength = 64 * 1024
+	/*MaxPageSize bounds a whole manager page read by ScanPage */
+	MaxPageSize = 64 * 1024 * 1024
+)
+
+/*ErrPageTooLarge is returned when a page exceeds the maximum size */
+var ErrPageTooLarge = errors.New("page exceeds the maximum size")
+
+// pageLimitReader fails reads beyond the page size instead of truncating the page
+type pageLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *pageLimitReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Only an error when there is more to read.
+		if n, err := l.r.Read(make([]byte, 1)); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, ErrPageTooLarge
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+
+	return n, err
+}
+
+/*NewPageScanner scans r line by line keeping the newlines, maxSize 0 does not bound the page size */
+func NewPageScanner(r io.Reader, maxSize int64) *bufio.Scanner {
+	if maxSize > 0 {
+		r = &pageLimitReader{r: r, remaining: maxSize}
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), MaxLineLength)
+	scanner.Split(scanLines)
+
+	return scanner
+}
+
+// scanLines is bufio.ScanLines keeping the newline, the parsers were written for it
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+/*ParseError is a panic of a parser on a line, the rest of the page is not parsed */
+type ParseError struct {
+	Line  string
+	Panic interface{}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parser failed on line %q: %v", strings.TrimRight(e.Line, "\n"), e.Panic)
+}
+
+/*ReadError is an error reading a page squid served, e.g. a parser panic or a page over the size limit */
+type ReadError struct {
+	Page string
+	Err  error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("error reading %s: %v", e.Page, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+/*ParseLine passes line to fn and returns a panic of fn as a *ParseError */
+func ParseLine(line string, fn func(line string)) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &ParseError{Line: line, Panic: r}
+		}
+	}()
+
+	fn(line)
+	return nil
+}
+
+/*ScanPage passes every line of r to fn, in the calling goroutine. A panic of fn stops the scan with a *ParseError */
+func ScanPage(r io.Reader, fn func(line string)) error {
+	scanner := NewPageScanner(r, MaxPageSize)
+	for scanner.Scan() {
+		if err := ParseLine(scanner.Text(), fn); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
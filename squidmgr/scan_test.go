@@ -0,0 +1,47 @@
+package squidmgr
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanPage(t *testing.T) {
+	var lines []string
+	err := ScanPage(strings.NewReader("a = 1\n\nb = 2"), func(line string) {
+		lines = append(lines, line)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a = 1\n", "\n", "b = 2"}, lines)
+
+	err = ScanPage(strings.NewReader(strings.Repeat("x", MaxLineLength+1)+"\n"), func(string) {})
+	assert.Equal(t, bufio.ErrTooLong, err)
+}
+
+func TestPageScannerMaxSize(t *testing.T) {
+	scanner := NewPageScanner(strings.NewReader("0123456789\n"), 11)
+	for scanner.Scan() {
+	}
+	assert.NoError(t, scanner.Err())
+
+	scanner = NewPageScanner(strings.NewReader("0123456789\n0123456789\n"), 11)
+	for scanner.Scan() {
+	}
+	assert.Equal(t, ErrPageTooLarge, scanner.Err())
+}
+
+func TestScanPageRecoversPanic(t *testing.T) {
+	var lines []string
+	err := ScanPage(strings.NewReader("a = 1\nboom\nb = 2\n"), func(line string) {
+		if line == "boom\n" {
+			panic("index out of range")
+		}
+		lines = append(lines, line)
+	})
+
+	assert.Equal(t, &ParseError{Line: "boom\n", Panic: "index out of range"}, err)
+	assert.EqualError(t, err, `parser failed on line "boom": index out of range`)
+	assert.Equal(t, []string{"a = 1\n"}, lines)
+}
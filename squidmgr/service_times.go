@@ -0,0 +1,77 @@
+package squidmgr
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*ServiceTime is a single line of the service_times page */
+type ServiceTime struct {
+	// Name is the request type with underscores, e.g. HTTP_Requests_All
+	Name string
+	// Percentile is the percentile of the line, e.g. 95, empty for lines without one
+	Percentile string
+	// FiveMin is the service time in seconds over the last 5 minutes
+	FiveMin float64
+}
+
+/*ServiceTimes is the service_times page, in page order */
+type ServiceTimes []ServiceTime
+
+/*Key is the name of the service time qualified by its percentile, e.g. HTTP_Requests_All_95 */
+func (s ServiceTime) Key() string {
+	if s.Percentile == "" {
+		return s.Name
+	}
+
+	return s.Name + "_" + s.Percentile
+}
+
+/*ParseServiceTimeLine parses a line of the service_times page, header lines give an empty ServiceTime */
+func ParseServiceTimeLine(line string) (ServiceTime, error) {
+	if strings.HasSuffix(line, ":\n") { // A header line isn't a metric
+		return ServiceTime{}, nil
+	}
+	if equal := strings.Index(line, ":"); equal >= 0 {
+		if key := strings.TrimSpace(line[:equal]); len(key) > 0 {
+			value := ""
+			if len(line) > equal {
+				value = strings.TrimSpace(line[equal+1:])
+			}
+			key = strings.Replace(key, " ", "_", -1)
+			key = strings.Replace(key, "(", "", -1)
+			key = strings.Replace(key, ")", "", -1)
+
+			percentile := ""
+			if equalTwo := strings.Index(value, "%"); equalTwo >= 0 {
+				if keyTwo := strings.TrimSpace(value[:equalTwo]); len(keyTwo) > 0 {
+					if len(value) > equalTwo {
+						value = strings.Split(strings.TrimSpace(value[equalTwo+1:]), " ")[0]
+					}
+					percentile = keyTwo
+				}
+			}
+
+			if value, err := strconv.ParseFloat(value, 64); err == nil {
+				return ServiceTime{Name: key, Percentile: percentile, FiveMin: value}, nil
+			}
+		}
+	}
+
+	return ServiceTime{}, errors.New("service times - could not parse line: " + line)
+}
+
+/*ParseServiceTimes parses the service_times page, lines that are no service times are skipped */
+func ParseServiceTimes(r io.Reader) (ServiceTimes, error) {
+	var serviceTimes ServiceTimes
+
+	err := ScanPage(r, func(line string) {
+		if s, err := ParseServiceTimeLine(line); err == nil && s.Name != "" {
+			serviceTimes = append(serviceTimes, s)
+		}
+	})
+
+	return serviceTimes, err
+}
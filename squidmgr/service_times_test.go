@@ -0,0 +1,40 @@
+package squidmgr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServiceTimeLine(t *testing.T) {
+	tests := []struct {
+		s   string
+		st  ServiceTime
+		key string
+	}{
+		{"	HTTP Requests (All):  70%   10.00000  9.50000\n", ServiceTime{Name: "HTTP_Requests_All", Percentile: "70", FiveMin: 10}, "HTTP_Requests_All_70"},
+		{"	Not-Modified Replies:  5%   12.00000  10.00000\n", ServiceTime{Name: "Not-Modified_Replies", Percentile: "5", FiveMin: 12}, "Not-Modified_Replies_5"},
+		{"	ICP Queries:          85%   900.00000  1200.00000\n", ServiceTime{Name: "ICP_Queries", Percentile: "85", FiveMin: 900}, "ICP_Queries_85"},
+	}
+
+	for _, tc := range tests {
+		st, err := ParseServiceTimeLine(tc.s)
+
+		assert.NoError(t, err)
+		assert.Equal(t, tc.st, st)
+		assert.Equal(t, tc.key, st.Key())
+	}
+}
+
+func TestParseServiceTimes(t *testing.T) {
+	serviceTimes, err := ParseServiceTimes(strings.NewReader("Service Time Percentiles            5 min    60 min:\n" +
+		"HTTP Requests (All):   5%   0.00000  0.00000\n" +
+		"HTTP Requests (All):  95%   0.25000  0.30000\n"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, ServiceTimes{
+		{Name: "HTTP_Requests_All", Percentile: "5", FiveMin: 0},
+		{Name: "HTTP_Requests_All", Percentile: "95", FiveMin: 0.25},
+	}, serviceTimes)
+}
@@ -0,0 +1,131 @@
+package squidmgr
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*StoreDir is a cache_dir reported on the storedir page, sizes are in KB */
+type StoreDir struct {
+	Index int
+	Type  string
+	Path  string
+
+	MaxSizeKB     float64
+	CurrentSizeKB float64
+	PercentUsed   float64
+
+	FilemapBitsInUse float64
+	FilemapBitsTotal float64
+
+	FilesystemUsedKB    float64
+	FilesystemTotalKB   float64
+	FilesystemInodeUsed float64
+	FilesystemInodes    float64
+
+	Flags         []string
+	RemovalPolicy string
+}
+
+/*StoreDirs is the storedir page */
+type StoreDirs struct {
+	Entries           float64
+	MaxSwapSizeKB     float64
+	CurrentSwapSizeKB float64
+	Dirs              []StoreDir
+}
+
+// leadingNumber parses the number value starts with, e.g. 10240.00 of "10240.00 KB"
+func leadingNumber(value string) float64 {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+
+	f, _ := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+	return f
+}
+
+// usedOfTotal parses "used/total KB (n%)" or "used of total (n%)"
+func usedOfTotal(value string) (float64, float64) {
+	fields := strings.Fields(value)
+	if len(fields) >= 3 && fields[1] == "of" {
+		return leadingNumber(fields[0]), leadingNumber(fields[2])
+	}
+	if len(fields) >= 1 {
+		if used, total, ok := strings.Cut(fields[0], "/"); ok {
+			return leadingNumber(used), leadingNumber(total)
+		}
+	}
+
+	return 0, 0
+}
+
+// decode adds a line of the storedir page to s
+func (s *StoreDirs) decode(line string) {
+	line = strings.TrimSpace(line)
+
+	// "Store Directory #0 (aufs): /var/spool/squid"
+	if rest, ok := strings.CutPrefix(line, "Store Directory #"); ok {
+		var dir StoreDir
+
+		index, rest, _ := strings.Cut(rest, " ")
+		dir.Index, _ = strconv.Atoi(index)
+		if typ, path, ok := strings.Cut(rest, ":"); ok {
+			dir.Type = strings.Trim(typ, "()")
+			dir.Path = strings.TrimSpace(path)
+		}
+
+		s.Dirs = append(s.Dirs, dir)
+		return
+	}
+
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return
+	}
+	key = strings.TrimSpace(key)
+	value = strings.TrimSpace(value)
+
+	if len(s.Dirs) == 0 {
+		switch key {
+		case "Store Entries":
+			s.Entries = leadingNumber(value)
+		case "Maximum Swap Size":
+			s.MaxSwapSizeKB = leadingNumber(value)
+		case "Current Store Swap Size":
+			s.CurrentSwapSizeKB = leadingNumber(value)
+		}
+		return
+	}
+
+	dir := &s.Dirs[len(s.Dirs)-1]
+	switch key {
+	case "Maximum Size":
+		dir.MaxSizeKB = leadingNumber(value)
+	case "Current Size":
+		dir.CurrentSizeKB = leadingNumber(value)
+	case "Percent Used":
+		dir.PercentUsed = leadingNumber(value)
+	case "Filemap bits in use":
+		dir.FilemapBitsInUse, dir.FilemapBitsTotal = usedOfTotal(value)
+	case "Filesystem Space in use":
+		dir.FilesystemUsedKB, dir.FilesystemTotalKB = usedOfTotal(value)
+	case "Filesystem Inodes in use":
+		dir.FilesystemInodeUsed, dir.FilesystemInodes = usedOfTotal(value)
+	case "Flags":
+		dir.Flags = strings.Fields(value)
+	case "Removal policy":
+		dir.RemovalPolicy = value
+	}
+}
+
+/*ParseStoreDirs parses the storedir page */
+func ParseStoreDirs(r io.Reader) (StoreDirs, error) {
+	var dirs StoreDirs
+
+	err := ScanPage(r, dirs.decode)
+
+	return dirs, err
+}
@@ -0,0 +1,56 @@
+package squidmgr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStoreDirPage = `Store Directory Statistics:
+Store Entries          : 1234
+Maximum Swap Size      : 1024000 KB
+Current Store Swap Size: 10240.00 KB
+Current Capacity       : 1.00% used, 99.00% free
+
+Store Directory #0 (aufs): /var/spool/squid
+FS Block Size 4096 Bytes
+First level subdirectories: 16
+Second level subdirectories: 256
+Maximum Size: 1024000 KB
+Current Size: 10240.00 KB
+Percent Used: 1.00%
+Filemap bits in use: 600 of 32768 (2%)
+Filesystem Space in use: 5000000/20000000 KB (25%)
+Filesystem Inodes in use: 10000/1000000 (1%)
+Flags: SELECTED
+Removal policy: lru
+LRU reference age:   1.00 days
+`
+
+func TestParseStoreDirs(t *testing.T) {
+	dirs, err := ParseStoreDirs(strings.NewReader(testStoreDirPage))
+
+	assert.NoError(t, err)
+	assert.Equal(t, StoreDirs{
+		Entries:           1234,
+		MaxSwapSizeKB:     1024000,
+		CurrentSwapSizeKB: 10240,
+		Dirs: []StoreDir{{
+			Index:               0,
+			Type:                "aufs",
+			Path:                "/var/spool/squid",
+			MaxSizeKB:           1024000,
+			CurrentSizeKB:       10240,
+			PercentUsed:         1,
+			FilemapBitsInUse:    600,
+			FilemapBitsTotal:    32768,
+			FilesystemUsedKB:    5000000,
+			FilesystemTotalKB:   20000000,
+			FilesystemInodeUsed: 10000,
+			FilesystemInodes:    1000000,
+			Flags:               []string{"SELECTED"},
+			RemovalPolicy:       "lru",
+		}},
+	}, dirs)
+}
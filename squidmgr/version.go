@@ -0,0 +1,57 @@
+package squidmgr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*Version is a squid release, e.g. 6.1 or 3.5.27 */
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Raw is the version as squid reports it, e.g. 4.0.21-20170621-r2
+	Raw string
+}
+
+/*ParseVersion parses the version of the info page or the Server header, e.g. "6.1", "Version 6.1" or "squid/6.1" */
+func ParseVersion(s string) (Version, error) {
+	raw := strings.TrimSpace(s)
+	raw = strings.TrimPrefix(raw, "Version ")
+	if i := strings.LastIndex(raw, "/"); i >= 0 {
+		raw = raw[i+1:]
+	}
+	if fields := strings.Fields(raw); len(fields) > 0 {
+		raw = fields[0]
+	}
+
+	v := Version{Raw: raw}
+
+	// Suffixes like -VCS or -20170621-r2 belong to the last number.
+	numbers, _, _ := strings.Cut(raw, "-")
+	parts := strings.Split(numbers, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("unknown squid version %q", s)
+	}
+
+	fields := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("unknown squid version %q", s)
+		}
+		*fields[i] = n
+	}
+
+	return v, nil
+}
+
+/*Supported reports whether the exporter supports a squid version, squid 3.5 to 7 */
+func Supported(v Version) bool {
+	if v.Major == 3 {
+		return v.Minor >= 5
+	}
+
+	return v.Major >= 4 && v.Major <= 7
+}
@@ -0,0 +1,51 @@
+package squidmgr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		s string
+		v Version
+		e string
+	}{
+		{"6.1", Version{Major: 6, Minor: 1, Raw: "6.1"}, ""},
+		{"Version 3.5.27", Version{Major: 3, Minor: 5, Patch: 27, Raw: "3.5.27"}, ""},
+		{"squid/4.0.21-20170621-r2", Version{Major: 4, Minor: 0, Patch: 21, Raw: "4.0.21-20170621-r2"}, ""},
+		{"7.0.0-VCS", Version{Major: 7, Raw: "7.0.0-VCS"}, ""},
+		{"2.7.STABLE9", Version{}, `unknown squid version "2.7.STABLE9"`},
+		{"", Version{}, `unknown squid version ""`},
+	}
+
+	for _, tc := range tests {
+		v, err := ParseVersion(tc.s)
+
+		if tc.e != "" {
+			assert.EqualError(t, err, tc.e)
+		} else {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, tc.v, v)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	tests := []struct {
+		v         Version
+		supported bool
+	}{
+		{Version{Major: 3, Minor: 5}, true},
+		{Version{Major: 3, Minor: 1}, false},
+		{Version{Major: 4}, true},
+		{Version{Major: 5}, true},
+		{Version{Major: 7}, true},
+		{Version{Major: 8}, false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.supported, Supported(tc.v), tc.v)
+	}
+}
@@ -0,0 +1,75 @@
+package squidtest
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// fixtures holds a directory of synthetic pages per squid version, kid pages
+// live in kidN subdirectories. They follow the layouts the parsers were
+// written for and share one template, they are not captures of a real squid.
+//
+//go:embed fixtures
+var fixtures embed.FS
+
+/*Versions lists the squid versions with synthetic fixtures, oldest first */
+func Versions() []string {
+	entries, _ := fixtures.ReadDir("fixtures")
+
+	var versions []string
+	for _, e := range entries {
+		if e.IsDir() {
+			versions = append(versions, e.Name())
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versionLess(versions[i], versions[j])
+	})
+
+	return versions
+}
+
+// versionLess orders versions numerically, 4.17 before 6.10
+func versionLess(a string, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if len(as[i]) != len(bs[i]) {
+			return len(as[i]) < len(bs[i])
+		}
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+
+	return len(as) < len(bs)
+}
+
+/*Fixture returns the synthetic pages of a squid version keyed by page name, e.g. info or kid1/counters */
+func Fixture(version string) (map[string]Page, error) {
+	root := path.Join("fixtures", version)
+	if _, err := fs.Stat(fixtures, root); err != nil {
+		return nil, fmt.Errorf("no fixtures for squid %s", version)
+	}
+
+	pages := map[string]Page{}
+	err := fs.WalkDir(fixtures, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(p) != ".txt" {
+			return err
+		}
+
+		body, err := fixtures.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(p, root+"/"), ".txt")
+		pages[name] = Page{Body: string(body)}
+
+		return nil
+	})
+
+	return pages, err
+}
@@ -0,0 +1,72 @@
+package squidtest
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	ipv4Pattern    = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`)
+	ipv6Pattern    = regexp.MustCompile(`[0-9A-Fa-f]*:[0-9A-Fa-f:]+`)
+	urlHostPattern = regexp.MustCompile(`://[^/:\s]+`)
+	namePattern    = regexp.MustCompile(`(?m)^(Name:\s+)(\S+)`)
+)
+
+// scrubber replaces every distinct address or host name of a page with the
+// same reserved address or example host
+type scrubber struct {
+	seen map[string]string
+}
+
+// replace returns the replacement of value, the nth distinct value is
+// replaced with format(n)
+func (s *scrubber) replace(value string, format func(n int) string) string {
+	if r, ok := s.seen[value]; ok {
+		return r
+	}
+
+	r := format(len(s.seen) + 1)
+	s.seen[value] = r
+
+	return r
+}
+
+func (s *scrubber) host(host string) string {
+	if host == "localhost" || net.ParseIP(host) != nil {
+		return host
+	}
+
+	return s.replace(host, func(n int) string { return fmt.Sprintf("host%d.example.com", n) })
+}
+
+/*Scrub masks the IP addresses, client names and URL hosts of a recorded page so it can be kept as a fixture. Anything else, e.g. user names in URLs, is kept, review the result before committing it */
+func Scrub(page string) string {
+	// IPv4 addresses become addresses of 198.18.0.0/15, IPv6 addresses of
+	// 2001:db8::/32, client names and URL hosts hostN.example.com. A value is
+	// replaced the same way everywhere on the page and the layout is kept.
+	s := &scrubber{seen: map[string]string{}}
+
+	page = ipv4Pattern.ReplaceAllStringFunc(page, func(ip string) string {
+		if net.ParseIP(ip) == nil {
+			return ip
+		}
+		return s.replace(ip, func(n int) string { return fmt.Sprintf("198.18.%d.%d", n/256, n%256) })
+	})
+	page = ipv6Pattern.ReplaceAllStringFunc(page, func(ip string) string {
+		if net.ParseIP(ip) == nil {
+			return ip
+		}
+		return s.replace(ip, func(n int) string { return fmt.Sprintf("2001:db8::%x", n) })
+	})
+	page = urlHostPattern.ReplaceAllStringFunc(page, func(host string) string {
+		return "://" + s.host(strings.TrimPrefix(host, "://"))
+	})
+	page = namePattern.ReplaceAllStringFunc(page, func(line string) string {
+		m := namePattern.FindStringSubmatch(line)
+		return m[1] + s.host(m[2])
+	})
+
+	return page
+}
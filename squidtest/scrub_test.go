@@ -0,0 +1,31 @@
+package squidtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrub(t *testing.T) {
+	page := "Cache Clients:\n" +
+		"Address: 10.1.2.3\n" +
+		"Name:    laptop.corp.internal\n" +
+		"Address: fe80::1\n" +
+		"Name:    fe80::1\n" +
+		"Start Time:\tWed, 01 May 2024 08:00:00 GMT\n" +
+		"KEY 0123 GET http://intranet.corp.internal/index.html\n" +
+		"\tpeer 10.1.2.3:3128 via cache_object://localhost/info\n" +
+		"Squid Object Cache: Version 6.10\n"
+
+	expected := "Cache Clients:\n" +
+		"Address: 198.18.0.1\n" +
+		"Name:    host4.example.com\n" +
+		"Address: 2001:db8::2\n" +
+		"Name:    2001:db8::2\n" +
+		"Start Time:\tWed, 01 May 2024 08:00:00 GMT\n" +
+		"KEY 0123 GET http://host3.example.com/index.html\n" +
+		"\tpeer 198.18.0.1:3128 via cache_object://localhost/info\n" +
+		"Squid Object Cache: Version 6.10\n"
+
+	assert.Equal(t, expected, Scrub(page))
+}
@@ -0,0 +1,327 @@
+/*
+Package squidtest runs a fake squid cache manager for tests.
+
+The server answers cache_object://localhost/<page> and /squid-internal-mgr/<page>
+requests with synthetic pages of several squid versions, kid pages of SMP
+squids are requested as kidN/<page>. The pages are written after the page
+layouts the parsers expect, they are not captures of a running squid:
+
+	s, err := squidtest.NewFixtureServer("6.10")
+	defer s.Close()
+
+	e := collector.New(&collector.CollectorConfig{Hostname: s.Hostname(), Port: s.Port()})
+
+Pages can be replaced to simulate failures, slow answers and reset connections.
+*/
+package squidtest
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*Page is the answer of the fake cache manager for a page */
+type Page struct {
+	Body string
+	// Status is the HTTP status code, 200 when 0
+	Status int
+	// Delay is waited before answering
+	Delay time.Duration
+	// Reset closes the connection instead of answering
+	Reset bool
+}
+
+/*Request is a cache manager request received by the server */
+type Request struct {
+	// Form is cache_object or squid-internal-mgr
+	Form string
+	Page string
+	// Kid is the worker of a kid page, e.g. kid1, empty for the whole squid
+	Kid        string
+	Authorized bool
+	KeepAlive  bool
+}
+
+/*Server is a fake squid cache manager listening on localhost */
+type Server struct {
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	version  string
+	pages    map[string]Page
+	login    string
+	password string
+	requests []Request
+	conns    map[net.Conn]struct{}
+}
+
+/*NewServer starts a server answering pages as squid version, pages are keyed by name, e.g. info or kid1/counters */
+func NewServer(version string, pages map[string]Page) (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: l,
+		version:  version,
+		pages:    map[string]Page{},
+		conns:    map[net.Conn]struct{}{},
+	}
+	for name, page := range pages {
+		s.pages[name] = page
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+/*NewFixtureServer starts a server answering the synthetic pages of a squid version */
+func NewFixtureServer(version string) (*Server, error) {
+	pages, err := Fixture(version)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewServer(version, pages)
+}
+
+/*Hostname is the address the server listens on */
+func (s *Server) Hostname() string {
+	return s.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+/*Port is the port the server listens on */
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+/*SetAuth requires basic auth or a page@password request for every page, an empty login disables it */
+func (s *Server) SetAuth(login string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.login = login
+	s.password = password
+}
+
+/*SetPage adds or replaces a page */
+func (s *Server) SetPage(name string, page Page) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pages[name] = page
+}
+
+/*Requests returns the requests received so far, in order */
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request{}, s.requests...)
+}
+
+/*Close stops the server and closes the open connections */
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// handle answers the requests of a connection until it is closed or a
+// request does not keep it alive
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, headers, err := readRequest(r)
+		if err != nil {
+			return
+		}
+
+		if !s.answer(conn, line, headers) {
+			return
+		}
+	}
+}
+
+// readRequest reads the request line and the headers of a request. Extra
+// headers configured in the exporter are sent ahead of the request line, so
+// lines are skipped until one looks like a request line.
+func readRequest(r *bufio.Reader) (string, map[string]string, error) {
+	var line string
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+
+		fields := strings.Fields(l)
+		if len(fields) == 3 && strings.HasPrefix(fields[2], "HTTP/") {
+			line = strings.TrimSpace(l)
+			break
+		}
+	}
+
+	headers := map[string]string{}
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+
+		l = strings.TrimSpace(l)
+		if l == "" {
+			return line, headers, nil
+		}
+		if key, value, ok := strings.Cut(l, ":"); ok {
+			headers[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+}
+
+// parseTarget splits a request target into its form, the page path and the
+// password of a cache_object://localhost/page@password request
+func parseTarget(target string) (form string, path string, password string, ok bool) {
+	if rest, found := strings.CutPrefix(target, "cache_object://"); found {
+		_, path, _ = strings.Cut(rest, "/")
+		path, password, _ = strings.Cut(path, "@")
+		return "cache_object", path, password, true
+	}
+
+	if rest, found := strings.CutPrefix(target, "http://"); found {
+		_, target, _ = strings.Cut(rest, "/")
+		target = "/" + target
+	}
+	if path, found := strings.CutPrefix(target, "/squid-internal-mgr/"); found {
+		return "squid-internal-mgr", path, "", true
+	}
+
+	return "", "", "", false
+}
+
+// authorized reports whether the request carries the configured credentials
+func (s *Server) authorized(headers map[string]string, password string) bool {
+	if s.login == "" {
+		return true
+	}
+	if password != "" {
+		return password == s.password
+	}
+
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(s.login+":"+s.password))
+	return headers["authorization"] == expected || headers["proxy-authorization"] == expected
+}
+
+// answer writes the response to a request and reports whether the
+// connection stays open for the next one
+func (s *Server) answer(conn net.Conn, line string, headers map[string]string) bool {
+	fields := strings.Fields(line)
+	form, path, password, ok := parseTarget(fields[1])
+	path, _, _ = strings.Cut(path, "?")
+
+	req := Request{
+		Form:      form,
+		Page:      path,
+		KeepAlive: fields[2] == "HTTP/1.1" && !strings.EqualFold(headers["connection"], "close"),
+	}
+	if kid, page, found := strings.Cut(path, "/"); found && strings.HasPrefix(kid, "kid") {
+		req.Kid, req.Page = kid, page
+	}
+
+	s.mu.Lock()
+	req.Authorized = s.authorized(headers, password)
+	page, exists := s.pages[path]
+	version := s.version
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		page = Page{Status: http.StatusBadRequest, Body: "Invalid URL\n"}
+	case !req.Authorized:
+		page = Page{Status: http.StatusUnauthorized, Body: "Cache Access Denied\n"}
+	case !exists:
+		page = Page{Status: http.StatusNotFound, Body: "Invalid or unknown cache manager action\n"}
+	}
+
+	time.Sleep(page.Delay)
+	if page.Reset {
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		return false
+	}
+
+	status := page.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	server := "squid"
+	if version != "" {
+		server += "/" + version
+	}
+
+	// Like squid, a closing connection ends the body instead of a content length
+	var b strings.Builder
+	if req.KeepAlive {
+		fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+		fmt.Fprintf(&b, "Content-Length: %d\r\nConnection: keep-alive\r\n", len(page.Body))
+	} else {
+		fmt.Fprintf(&b, "HTTP/1.0 %d %s\r\n", status, http.StatusText(status))
+		b.WriteString("Connection: close\r\n")
+	}
+	if status == http.StatusUnauthorized {
+		b.WriteString("WWW-Authenticate: Basic realm=\"squid\"\r\n")
+	}
+	fmt.Fprintf(&b, "Server: %s\r\nContent-Type: text/plain;charset=utf-8\r\n\r\n%s", server, page.Body)
+
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return false
+	}
+
+	return req.KeepAlive
+}
@@ -0,0 +1,131 @@
+package squidtest
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boynux/squid-exporter/squidmgr"
+	"github.com/stretchr/testify/assert"
+)
+
+func newServer(t *testing.T, version string) *Server {
+	s, err := NewFixtureServer(version)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// get sends a raw request and returns the whole response
+func get(t *testing.T, s *Server, request string) string {
+	conn, err := net.Dial("tcp", net.JoinHostPort(s.Hostname(), fmt.Sprint(s.Port())))
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, request)
+	resp, _ := io.ReadAll(conn)
+
+	return string(resp)
+}
+
+func TestVersions(t *testing.T) {
+	assert.Equal(t, []string{"3.5.28", "4.17", "5.9", "6.10"}, Versions())
+
+	for _, version := range Versions() {
+		pages, err := Fixture(version)
+		assert.NoError(t, err)
+		for _, page := range []string{"counters", "info", "service_times", "mem"} {
+			assert.Contains(t, pages, page, version)
+		}
+	}
+
+	_, err := Fixture("2.7")
+	assert.EqualError(t, err, "no fixtures for squid 2.7")
+}
+
+func TestServerCacheObject(t *testing.T) {
+	s := newServer(t, "4.17")
+
+	client := squidmgr.NewClient(&squidmgr.Config{Hostname: s.Hostname(), Port: s.Port()})
+	version, err := client.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, "4.17", version.Raw)
+
+	assert.Equal(t, []Request{{Form: "cache_object", Page: "info", Authorized: true}}, s.Requests())
+}
+
+func TestServerInternalManager(t *testing.T) {
+	s := newServer(t, "6.10")
+
+	resp := get(t, s, "GET /squid-internal-mgr/kid1/counters HTTP/1.0\r\nHost: localhost\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.0 200 OK\r\n"), resp)
+	assert.Contains(t, resp, "Server: squid/6.10\r\n")
+	assert.Contains(t, resp, "client_http.requests = 24000\n")
+
+	resp = get(t, s, "GET http://localhost:3128/squid-internal-mgr/unknown HTTP/1.0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.0 404 Not Found\r\n"), resp)
+
+	resp = get(t, s, "GET /index.html HTTP/1.0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.0 400 Bad Request\r\n"), resp)
+
+	assert.Equal(t, []Request{
+		{Form: "squid-internal-mgr", Page: "counters", Kid: "kid1", Authorized: true},
+		{Form: "squid-internal-mgr", Page: "unknown", Authorized: true},
+		{Authorized: true},
+	}, s.Requests())
+}
+
+func TestServerAuth(t *testing.T) {
+	s := newServer(t, "5.9")
+	s.SetAuth("manager", "secret")
+
+	_, err := squidmgr.NewClient(&squidmgr.Config{Hostname: s.Hostname(), Port: s.Port()}).Counters()
+	assert.EqualError(t, err, "error getting counters: Non success code 401 while fetching counters")
+
+	_, err = squidmgr.NewClient(&squidmgr.Config{Hostname: s.Hostname(), Port: s.Port(), Login: "manager", Password: "secret"}).Counters()
+	assert.NoError(t, err)
+
+	resp := get(t, s, "GET cache_object://localhost/counters@secret HTTP/1.0\r\n\r\n")
+	assert.True(t, strings.HasPrefix(resp, "HTTP/1.0 200 OK\r\n"), resp)
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	s := newServer(t, "6.10")
+	s.SetPage("small", Page{Body: "one\n"})
+
+	resp := get(t, s, "GET cache_object://localhost/small HTTP/1.1\r\nConnection: keep-alive\r\n\r\n"+
+		"GET cache_object://localhost/small HTTP/1.1\r\nConnection: close\r\n\r\n")
+
+	assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 4\r\nConnection: keep-alive\r\n"+
+		"Server: squid/6.10\r\nContent-Type: text/plain;charset=utf-8\r\n\r\none\n"+
+		"HTTP/1.0 200 OK\r\nConnection: close\r\n"+
+		"Server: squid/6.10\r\nContent-Type: text/plain;charset=utf-8\r\n\r\none\n", resp)
+}
+
+func TestServerFailures(t *testing.T) {
+	s := newServer(t, "6.10")
+	s.SetPage("info", Page{Status: 500, Body: "broken\n"})
+	s.SetPage("counters", Page{Reset: true})
+	s.SetPage("mem", Page{Delay: 50 * time.Millisecond, Body: "slow\n"})
+
+	client := squidmgr.NewClient(&squidmgr.Config{Hostname: s.Hostname(), Port: s.Port()})
+
+	_, err := client.Info()
+	assert.EqualError(t, err, "error getting info: Non success code 500 while fetching info")
+
+	_, err = client.Counters()
+	assert.Error(t, err)
+
+	start := time.Now()
+	_, err = client.MemPools()
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
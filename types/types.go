@@ -24,3 +24,89 @@ type MemInstance struct {
 }
 
 type MemInstances []MemInstance
+
+/*ClientInfo maps a single client entry of the squid client_list page */
+type ClientInfo struct {
+	Address      string
+	Name         string
+	Connections  float64
+	ICPRequests  float64
+	HTTPRequests float64
+	ICPResults   map[string]float64
+	HTTPResults  map[string]float64
+}
+
+/*ClientInfos is a list of clients reported by squid */
+type ClientInfos []ClientInfo
+
+/*DelayBucket is the current level of a single delay pool bucket */
+type DelayBucket struct {
+	ID    string
+	Level float64
+}
+
+/*DelayPoolBucket maps one bucket type (aggregate, network, individual, ...) of a squid delay pool */
+type DelayPoolBucket struct {
+	Pool     string
+	Class    string
+	Type     string
+	Disabled bool
+	Max      float64
+	Restore  float64
+	Current  []DelayBucket
+}
+
+/*DelayPools is a list of delay pool buckets reported by squid */
+type DelayPools []DelayPoolBucket
+
+/*HelperStats maps the statistics squid reports for a helper program */
+type HelperStats struct {
+	Program        string
+	Active         float64
+	Max            float64
+	ShuttingDown   float64
+	Requests       float64
+	Replies        float64
+	TimedOut       float64
+	QueueLength    float64
+	AvgServiceTime float64
+	Busy           float64
+}
+
+/*AdaptationService maps the state of an ICAP or eCAP service reported by squid */
+type AdaptationService struct {
+	Name         string
+	URI          string
+	Up           bool
+	Suspended    bool
+	OptionsValid bool
+	Fetching     bool
+	Failures     float64
+	Connections  float64
+}
+
+/*AdaptationServices is a list of adaptation services */
+type AdaptationServices []AdaptationService
+
+/*StoreObject holds the attributes of a cached object needed for aggregation */
+type StoreObject struct {
+	StoreStatus string
+	MemStatus   string
+	SwapStatus  string
+	Size        float64
+	Timestamp   float64
+}
+
+/*Event is an internal squid event waiting in the scheduler queue */
+type Event struct {
+	Name string
+	// NextExecution is the number of seconds until the event runs, negative when it is overdue
+	NextExecution float64
+	Weight        float64
+}
+
+/*EventQueue holds the scheduler state reported on the events page */
+type EventQueue struct {
+	LastRun string
+	Events  []Event
+}